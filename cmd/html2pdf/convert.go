@@ -0,0 +1,180 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/kohkimakimoto/html2pdf/html2pdf"
+	"os"
+	"strings"
+)
+
+// convertMain runs the convert command that builds a pdf from the files without a script.
+func convertMain(args []string) (status int) {
+	defer func() {
+		if err := recover(); err != nil {
+			printError(err)
+			status = 1
+		}
+	}()
+
+	var optLogLevel, optOutput, optCover, optFormat, optCachedir, optWkhtmltopdf string
+	var optPageSize, optOrientation, optMargin, optTitle string
+	var optTOC, optGrayscale, optDryRun, optNoStrict bool
+	var optOptions, optPageOptions, optTOCOptions keyValuesFlag
+
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	fs.StringVar(&optLogLevel, "l", "info", "")
+	fs.StringVar(&optLogLevel, "log-level", "info", "")
+	fs.StringVar(&optOutput, "o", "-", "")
+	fs.StringVar(&optOutput, "output", "-", "")
+	fs.StringVar(&optCover, "cover", "", "")
+	fs.BoolVar(&optTOC, "toc", false, "")
+	fs.StringVar(&optPageSize, "page-size", "", "")
+	fs.StringVar(&optOrientation, "orientation", "", "")
+	fs.StringVar(&optMargin, "margin", "", "")
+	fs.StringVar(&optTitle, "title", "", "")
+	fs.BoolVar(&optGrayscale, "grayscale", false, "")
+	fs.Var(&optOptions, "option", "")
+	fs.Var(&optPageOptions, "page-option", "")
+	fs.Var(&optTOCOptions, "toc-option", "")
+	fs.BoolVar(&optDryRun, "dry-run", false, "")
+	fs.StringVar(&optFormat, "format", "text", "")
+	fs.BoolVar(&optNoStrict, "no-strict", false, "")
+	fs.StringVar(&optCachedir, "cache-dir", "", "")
+	fs.StringVar(&optWkhtmltopdf, "wkhtmltopdf", "", "")
+
+	fs.Usage = func() {
+		fmt.Println(`Usage: ` + html2pdf.Name + ` convert [OPTIONS...] INPUT...
+
+  Convert html files or urls to a pdf without writing a script.
+  INPUT '-' reads html from stdin.
+
+Options:
+  -l, -log-level=LEVEL       Log level (quiet|error|warning|info|debug). Default is 'info'.
+  -o, -output=FILE           Output pdf file. Default is '-' that writes the pdf to stdout.
+  -cover=INPUT               Add a cover.
+  -toc                       Add a table of contents.
+  -page-size=SIZE            Page size like A4 and Letter.
+  -orientation=ORIENTATION   Orientation (Landscape|Portrait).
+  -margin=LENGTH             Margins of all sides like 10mm.
+  -title=TITLE               Title of the pdf.
+  -grayscale                 Generate the pdf in grayscale.
+  -option=KEY=VALUE          Set an option like the 'options' of the DSL (e.g. margin_top=20mm).
+  -page-option=KEY=VALUE     Set a page option to all the pages like the 'pages' of the DSL (e.g. header.center=[page]).
+  -toc-option=KEY=VALUE      Set a toc option like the 'toc' of the DSL. It implies -toc.
+  -dry-run                   Print the wkhtmltopdf command without running it.
+  -format=FORMAT             Output format of -dry-run (text|json). Default is 'text'.
+  -no-strict                 Ignore unknown keys in the options instead of rejecting them.
+  -cache-dir=DIR             Cache directory. Default is $HTML2PDF_CACHE_DIR or $XDG_CACHE_HOME/html2pdf.
+  -wkhtmltopdf=PATH          Use the wkhtmltopdf instead of the bundled one. Default is $HTML2PDF_WKHTMLTOPDF.
+  -h, -help                  Show help
+`)
+	}
+
+	// parse the flags that are mixed with the inputs.
+	inputs := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				return 0
+			}
+			return 1
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		inputs = append(inputs, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(inputs) == 0 {
+		fs.Usage()
+		return 1
+	}
+
+	// the convenient flags are shorthands of the options.
+	options := []string{}
+	if optPageSize != "" {
+		options = append(options, "page_size="+optPageSize)
+	}
+	if optOrientation != "" {
+		options = append(options, "orientation="+optOrientation)
+	}
+	if optMargin != "" {
+		for _, side := range []string{"top", "bottom", "left", "right"} {
+			options = append(options, "margin_"+side+"="+optMargin)
+		}
+	}
+	if optTitle != "" {
+		options = append(options, "title="+optTitle)
+	}
+	if optGrayscale {
+		options = append(options, "grayscale=true")
+	}
+	options = append(options, optOptions...)
+
+	app := newAppFromEnv()
+	app.LogLevel = optLogLevel
+	app.Strict = !optNoStrict
+	if optCachedir != "" {
+		app.SetCachedir(optCachedir)
+	}
+	if optWkhtmltopdf != "" {
+		app.WkhtmltopdfCmd = optWkhtmltopdf
+	}
+	if optOutput == "-" || optDryRun {
+		// stdout is used by the pdf or the dry-run result.
+		app.LogOutput = os.Stderr
+	}
+
+	defer app.Close()
+
+	if err := app.Init(); err != nil {
+		printError(err)
+		return 1
+	}
+
+	_, err := app.LoadConvertConfig(&html2pdf.ConvertConfig{
+		Inputs:      inputs,
+		Output:      optOutput,
+		Cover:       optCover,
+		TOC:         optTOC,
+		Options:     options,
+		PageOptions: optPageOptions,
+		TOCOptions:  optTOCOptions,
+		Stdin:       os.Stdin,
+	})
+	if err != nil {
+		printError(err)
+		return 1
+	}
+
+	if optDryRun {
+		if err := app.WriteDryRun(os.Stdout, optFormat); err != nil {
+			printError(err)
+			return 1
+		}
+
+		return status
+	}
+
+	if err := app.Run(); err != nil {
+		printError(err)
+		return 1
+	}
+
+	return status
+}
+
+// keyValuesFlag is a flag of "key=value" that can be specified multiple times.
+// Unlike stringsFlag, it doesn't split the value by commas.
+type keyValuesFlag []string
+
+func (f *keyValuesFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *keyValuesFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
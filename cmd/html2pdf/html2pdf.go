@@ -6,9 +6,23 @@ import (
 	"github.com/kohkimakimoto/html2pdf/html2pdf"
 	"github.com/kohkimakimoto/html2pdf/support/color"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "convert":
+			os.Exit(convertMain(os.Args[2:]))
+		case "serve":
+			os.Exit(serveMain(os.Args[2:]))
+		case "schema":
+			os.Exit(schemaMain(os.Args[2:]))
+		}
+	}
+
 	os.Exit(realMain())
 }
 
@@ -21,29 +35,60 @@ func realMain() (status int) {
 	}()
 
 	// parse flags...
-	var optLogLevel, optVarJson, optVarJsonFile string
-	var optVersion bool
+	var optLogLevel, optVarJson, optVarJsonFile, optFormat, optCachedir, optWkhtmltopdf string
+	var optVersion, optList, optDryRun, optWatch, optNoStrict, optForce bool
+	var optTargets stringsFlag
+	var optJobs int
 
 	flag.StringVar(&optLogLevel, "l", "info", "")
 	flag.StringVar(&optLogLevel, "log-level", "info", "")
 	flag.StringVar(&optVarJson, "var", "", "")
 	flag.StringVar(&optVarJsonFile, "var-file", "", "")
+	flag.Var(&optTargets, "t", "")
+	flag.Var(&optTargets, "target", "")
+	flag.BoolVar(&optList, "list", false, "")
+	flag.BoolVar(&optDryRun, "dry-run", false, "")
+	flag.IntVar(&optJobs, "j", 0, "")
+	flag.IntVar(&optJobs, "jobs", 0, "")
+	flag.BoolVar(&optWatch, "w", false, "")
+	flag.BoolVar(&optWatch, "watch", false, "")
+	flag.StringVar(&optFormat, "format", "text", "")
+	flag.BoolVar(&optNoStrict, "no-strict", false, "")
+	flag.BoolVar(&optForce, "f", false, "")
+	flag.BoolVar(&optForce, "force", false, "")
+	flag.StringVar(&optCachedir, "cache-dir", "", "")
+	flag.StringVar(&optWkhtmltopdf, "wkhtmltopdf", "", "")
 
 	flag.BoolVar(&optVersion, "v", false, "")
 	flag.BoolVar(&optVersion, "version", false, "")
 
 	flag.Usage = func() {
-		fmt.Println(`Usage: ` + html2pdf.Name + ` [OPTIONS...] [SCRIPT_FILE]
+		fmt.Println(`Usage: ` + html2pdf.Name + ` [OPTIONS...] [SCRIPT_FILE|MANIFEST_FILE]
+       ` + html2pdf.Name + ` convert [OPTIONS...] INPUT...
+       ` + html2pdf.Name + ` serve [OPTIONS...]
+       ` + html2pdf.Name + ` schema [OPTIONS...] [CONFIG_FILE...]
 
   ` + html2pdf.Name + ` -- ` + html2pdf.Usage + `
   version ` + html2pdf.Version + ` (` + html2pdf.CommitHash + `)
 
 Options:
   -l, -log-level=LEVEL       Log level (quiet|error|warning|info|debug). Default is 'info'.
+  -cache-dir=DIR             Cache directory. Default is $HTML2PDF_CACHE_DIR or $XDG_CACHE_HOME/html2pdf.
+  -dry-run                   Print the wkhtmltopdf commands without running them.
+  -f, -force                 Rebuild the pdf configs even if they are up to date.
+  -format=FORMAT             Output format of -dry-run (text|json). Default is 'text'.
   -h, -help                  Show help
+  -j, -jobs=N                Render N pdf configs concurrently. It overrides the 'jobs' settings in the script.
+  -list                      List the pdf configs without rendering them.
+  -no-strict                 Ignore unknown keys in the pdf configs instead of rejecting them.
+  -t, -target=NAME           Build only the pdf configs that match the name or glob pattern.
+                             It can be specified multiple times or separated by commas.
   -v, -version               Print the version
   -var=JSON                  JSON string to input variables.
   -var-file=JSON_FILE        JSON file to input variables.
+  -w, -watch                 Keep running and rebuild the pdf configs when the script or their files are changed.
+  -wkhtmltopdf=PATH          Use the wkhtmltopdf instead of the bundled one. It overrides $HTML2PDF_WKHTMLTOPDF
+                             and the 'wkhtmltopdf' settings in the script.
 `)
 	}
 	flag.Parse()
@@ -66,32 +111,102 @@ Options:
 	flag.CommandLine.Parse(os.Args[indexOfScript+1:])
 
 	// finished parsing flags, start initializing app.
-	app := html2pdf.NewApp()
-	// defer app.Close()
+	newApp := func() (*html2pdf.App, error) {
+		app := newAppFromEnv()
 
-	app.LogLevel = optLogLevel
+		app.LogLevel = optLogLevel
+		app.Targets = optTargets
+		if optCachedir != "" {
+			app.SetCachedir(optCachedir)
+		}
+		// the components are validated when the script defines them, so -no-strict is set before loading.
+		// it is set again after loading to override the 'strict' settings.
+		if optNoStrict {
+			app.Strict = false
+		}
 
-	if err := app.Init(); err != nil {
-		printError(err)
-		status = 1
+		if err := app.Init(); err != nil {
+			return app, err
+		}
+
+		if optVarJsonFile != "" {
+			if err := app.LoadVariableFromJSONFile(optVarJsonFile); err != nil {
+				return app, err
+			}
+		}
+
+		if optVarJson != "" {
+			if err := app.LoadVariableFromJSON(optVarJson); err != nil {
+				return app, err
+			}
+		}
+		if html2pdf.IsManifestFile(scriptFile) {
+			if err := app.LoadManifestFile(scriptFile); err != nil {
+				return app, err
+			}
+		} else if err := app.LoadScriptFile(scriptFile); err != nil {
+			return app, err
+		}
+
+		if optJobs > 0 {
+			app.Jobs = optJobs
+		}
+		if optNoStrict {
+			app.Strict = false
+		}
+		app.Force = optForce
+		if optWkhtmltopdf != "" {
+			app.WkhtmltopdfCmd = optWkhtmltopdf
+		}
+
+		return app, nil
 	}
 
-	if optVarJsonFile != "" {
-		if err := app.LoadVariableFromJSONFile(optVarJsonFile); err != nil {
+	if optWatch {
+		files := []string{scriptFile}
+		if optVarJsonFile != "" {
+			files = append(files, optVarJsonFile)
+		}
+
+		stop := make(chan struct{})
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			close(stop)
+		}()
+
+		if err := html2pdf.NewWatcher(newApp, files).Run(stop); err != nil {
 			printError(err)
 			return 1
 		}
+
+		return status
 	}
 
-	if optVarJson != "" {
-		if err := app.LoadVariableFromJSON(optVarJson); err != nil {
+	app, err := newApp()
+	defer app.Close()
+	if err != nil {
+		printError(err)
+		return 1
+	}
+
+	if optDryRun {
+		if err := app.WriteDryRun(os.Stdout, optFormat); err != nil {
 			printError(err)
 			return 1
 		}
+
+		return status
 	}
-	if err := app.LoadScriptFile(scriptFile); err != nil {
-		printError(err)
-		return 1
+
+	if optList {
+		if err := app.List(os.Stdout); err != nil {
+			printError(err)
+			return 1
+		}
+
+		return status
 	}
 
 	if err := app.Run(); err != nil {
@@ -102,7 +217,83 @@ Options:
 	return status
 }
 
+// newAppFromEnv creates an app that is configured by the environment variables.
+// The library doesn't read them, so the command reads them here, and the flags and the scripts override them.
+func newAppFromEnv() *html2pdf.App {
+	app := html2pdf.NewApp()
+
+	if dir := os.Getenv(html2pdf.CachedirEnv); dir != "" {
+		app.SetCachedir(dir)
+	}
+	if cmd := os.Getenv(html2pdf.WkhtmltopdfEnv); cmd != "" {
+		app.WkhtmltopdfCmd = cmd
+	}
+
+	return app
+}
+
 func printError(err interface{}) {
 	fmt.Fprintf(os.Stderr, color.FgRB(html2pdf.Name+" aborted!\n"))
+	if e, ok := err.(error); ok {
+		err = describeError(e)
+	}
 	fmt.Fprintf(os.Stderr, color.FgRB("%v\n", err))
 }
+
+// describeError formats the config errors to show where the invalid values are, like:
+//
+//	build.lua:12: pdf 'a.pdf'
+//	    pages[3].page_offset: 'x' (uint expected)
+func describeError(err error) string {
+	switch e := err.(type) {
+	case *html2pdf.RunError:
+		if len(e.Errors) == 1 {
+			return describeError(e.Errors[0])
+		}
+
+		msgs := []string{fmt.Sprintf("%d pdf configs failed:", len(e.Errors))}
+		for _, err := range e.Errors {
+			msgs = append(msgs, describeError(err))
+		}
+		return strings.Join(msgs, "\n")
+	case *html2pdf.TargetPdfError:
+		switch ce := e.Err.(type) {
+		case *html2pdf.ConfigError, html2pdf.ConfigErrors:
+			return describeError(ce)
+		}
+	case html2pdf.ConfigErrors:
+		msgs := []string{}
+		for _, err := range e {
+			msgs = append(msgs, describeError(err))
+		}
+		return strings.Join(msgs, "\n")
+	case *html2pdf.ConfigError:
+		location := e.Source
+		if e.Target != "" {
+			location = fmt.Sprintf("pdf '%s'", e.Target)
+			if e.Source != "" {
+				location = e.Source + ": " + location
+			}
+		}
+		return fmt.Sprintf("%s\n    %s: %v", location, e.Path, e.Err)
+	}
+
+	return err.Error()
+}
+
+// stringsFlag is a flag that can be specified multiple times.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*f = append(*f, s)
+		}
+	}
+
+	return nil
+}
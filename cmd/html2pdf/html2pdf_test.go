@@ -0,0 +1,280 @@
+package main
+
+import (
+	"flag"
+	"github.com/kohkimakimoto/html2pdf/support/testutil"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runMain runs the command with the args like the command line, and returns the exit status and the output.
+// The output has stdout and stderr.
+func runMain(t *testing.T, args ...string) (int, string) {
+	f, err := ioutil.TempFile("", "html2pdf_stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	stdout, stderr, osArgs, commandLine := os.Stdout, os.Stderr, os.Args, flag.CommandLine
+	defer func() {
+		os.Stdout, os.Stderr, os.Args, flag.CommandLine = stdout, stderr, osArgs, commandLine
+	}()
+
+	os.Stdout = f
+	os.Stderr = f
+	os.Args = append([]string{"html2pdf"}, args...)
+	flag.CommandLine = flag.NewFlagSet("html2pdf", flag.ContinueOnError)
+
+	status := realMain()
+
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return status, string(b)
+}
+
+// newScriptFile creates a tmpdir that has the script file.
+func newScriptFile(t *testing.T, script string) (string, string) {
+	tmpdir, err := ioutil.TempDir("", "html2pdf_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(tmpdir, "html2pdf.lua")
+	if err := ioutil.WriteFile(file, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return tmpdir, file
+}
+
+func TestDryRun(t *testing.T) {
+	tmpdir, file := newScriptFile(t, `
+pdf "a.pdf" {
+    options = { title = "Report" },
+    pages = {
+        { input = "https://example.com/a", username = "user", password = "secret", cookies = { session = "abc123" } },
+        { input_content = "<p>b</p>" },
+    },
+}
+`)
+	defer os.RemoveAll(tmpdir)
+
+	wkdir, wk := testutil.NewFakeWkhtmltopdf(t)
+	defer os.RemoveAll(wkdir)
+	cachedir := filepath.Join(tmpdir, "cache")
+
+	status, out := runMain(t, "-cache-dir="+cachedir, "-wkhtmltopdf="+wk, "-dry-run", file)
+	if status != 0 {
+		t.Fatalf("expected the status 0, but got %d", status)
+	}
+
+	for _, expected := range []string{
+		"==> a.pdf",
+		"    output_file: a.pdf",
+		"    " + wk + " --title Report page https://example.com/a --cookie session '******' --password '******' --username user page " + filepath.Join(cachedir, "tmp"),
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected the output contains %q, but got %q", expected, out)
+		}
+	}
+	if strings.Contains(out, "secret") || strings.Contains(out, "abc123") {
+		t.Errorf("expected the secrets are masked, but got %q", out)
+	}
+
+	// the temporary files of input_content are kept after the command exits to run the printed command.
+	tmpfiles, _ := filepath.Glob(filepath.Join(cachedir, "tmp", "*"))
+	if len(tmpfiles) != 1 {
+		t.Fatalf("expected the temporary file is kept, but got %v", tmpfiles)
+	}
+	if b, err := ioutil.ReadFile(tmpfiles[0]); err != nil || string(b) != "<p>b</p>" {
+		t.Errorf("expected the content of input_content, but got %q (%v)", b, err)
+	}
+	if !strings.Contains(out, "    tmpfile: "+tmpfiles[0]+"\n") || !strings.Contains(out, "page "+tmpfiles[0]+" -") {
+		t.Errorf("expected the output has the temporary file, but got %q", out)
+	}
+
+	status, out = runMain(t, "-cache-dir="+cachedir, "-wkhtmltopdf="+wk, "-dry-run", "-format=json", file)
+	if status != 0 {
+		t.Fatalf("expected the status 0, but got %d", status)
+	}
+	if !strings.Contains(out, `"--password",
+      "******"`) || strings.Contains(out, "secret") {
+		t.Errorf("expected the json has the masked password, but got %q", out)
+	}
+}
+
+func TestNoStrict(t *testing.T) {
+	tmpdir, file := newScriptFile(t, `
+local html2pdf = require "html2pdf"
+local a4 = html2pdf.options { page_size = "A4", unknown_key = true }
+
+pdf "a.pdf" {
+    options = a4,
+    pages = { input = "a.html" },
+}
+`)
+	defer os.RemoveAll(tmpdir)
+
+	cachedir := "-cache-dir=" + filepath.Join(tmpdir, "cache")
+
+	if status, _ := runMain(t, cachedir, "-list", file); status != 1 {
+		t.Errorf("expected the unknown key of the component is rejected, but the status is %d", status)
+	}
+
+	status, out := runMain(t, cachedir, "-no-strict", "-list", file)
+	if status != 0 {
+		t.Errorf("expected -no-strict ignores the unknown key of the component, but the status is %d", status)
+	}
+	if !strings.Contains(out, "a.pdf") {
+		t.Errorf("expected a.pdf is listed, but got %q", out)
+	}
+}
+
+func TestJobsFailure(t *testing.T) {
+	cases := []struct {
+		inputs   []string
+		expected []string
+	}{
+		{
+			inputs:   []string{"a.html", "fail.html", "c.html"},
+			expected: []string{"'fail.pdf': wkhtmltopdf failed: exit status 1: failed to load"},
+		},
+		{
+			inputs: []string{"a.html", "fail.html", "c.html", "fail2.html"},
+			expected: []string{
+				"2 pdf configs failed:",
+				"'fail.pdf': wkhtmltopdf failed: exit status 1: failed to load",
+				"'fail2.pdf': wkhtmltopdf failed: exit status 1: failed to load",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		tmpdir, wk := testutil.NewFakeWkhtmltopdf(t)
+
+		script := ""
+		for _, input := range c.inputs {
+			output := filepath.Join(tmpdir, strings.TrimSuffix(input, ".html")+".pdf")
+			script += `pdf "` + filepath.Base(output) + `" { output_file = "` + output + `", pages = { input = "` + input + `" } }
+`
+		}
+		file := filepath.Join(tmpdir, "html2pdf.lua")
+		if err := ioutil.WriteFile(file, []byte(script), 0644); err != nil {
+			t.Fatal(err)
+		}
+		status, out := runMain(t, "-cache-dir="+filepath.Join(tmpdir, "cache"), "-wkhtmltopdf="+wk, "-jobs", "2", file)
+		if status != 1 {
+			t.Errorf("%v: expected the status 1, but got %d", c.inputs, status)
+		}
+		for _, expected := range c.expected {
+			if !strings.Contains(out, expected) {
+				t.Errorf("%v: expected the output contains %q, but got %q", c.inputs, expected, out)
+			}
+		}
+		if len(c.expected) == 1 && strings.Contains(out, "pdf configs failed") {
+			t.Errorf("%v: expected a single error isn't aggregated, but got %q", c.inputs, out)
+		}
+
+		// the other pdf configs are rendered.
+		for _, name := range []string{"a.pdf", "c.pdf"} {
+			if b, err := ioutil.ReadFile(filepath.Join(tmpdir, name)); err != nil || !strings.HasPrefix(string(b), "%PDF") {
+				t.Errorf("%v: expected %s is rendered, but got %q (%v)", c.inputs, name, b, err)
+			}
+		}
+
+		os.RemoveAll(tmpdir)
+	}
+}
+
+func TestListTargets(t *testing.T) {
+	tmpdir, file := newScriptFile(t, `
+pdf "handbook.pdf" { pages = { input = "handbook.html" } }
+pdf "chapter1.pdf" { pages = { input = "chapter1.html" } }
+pdf "chapter2.pdf" { pages = { input = "chapter2.html" } }
+pdf "other.pdf" { pages = { input = "other.html" } }
+`)
+	defer os.RemoveAll(tmpdir)
+
+	cachedir := "-cache-dir=" + filepath.Join(tmpdir, "cache")
+
+	cases := []struct {
+		args     []string
+		status   int
+		expected []string
+	}{
+		{[]string{"-list", file}, 0, []string{"handbook.pdf", "chapter1.pdf", "chapter2.pdf", "other.pdf"}},
+		{[]string{"-list", "-t", "chapter*", file}, 0, []string{"chapter1.pdf", "chapter2.pdf"}},
+		// the flags after the script file and the comma separated targets.
+		{[]string{"-list", file, "-target", "other.pdf,chapter1.pdf"}, 0, []string{"chapter1.pdf", "other.pdf"}},
+		{[]string{"-list", "-t", "handbook.pdf", "-t", "other.pdf", file}, 0, []string{"handbook.pdf", "other.pdf"}},
+		{[]string{"-list", "-t", "none*", file}, 1, []string{"target 'none*' doesn't match any pdf config"}},
+	}
+
+	for _, c := range cases {
+		status, out := runMain(t, append([]string{cachedir}, c.args...)...)
+		if status != c.status {
+			t.Errorf("%v: expected the status %d, but got %d", c.args, c.status, status)
+		}
+
+		names := []string{}
+		for _, line := range strings.Split(out, "\n") {
+			if strings.HasSuffix(line, ".pdf") && !strings.HasPrefix(line, " ") {
+				names = append(names, line)
+			}
+		}
+		if c.status == 0 {
+			if strings.Join(names, ",") != strings.Join(c.expected, ",") {
+				t.Errorf("%v: expected %v are listed, but got %q", c.args, c.expected, out)
+			}
+		} else if !strings.Contains(out, c.expected[0]) {
+			t.Errorf("%v: expected the output contains %q, but got %q", c.args, c.expected[0], out)
+		}
+	}
+}
+
+func TestEnv(t *testing.T) {
+	tmpdir, file := newScriptFile(t, `pdf "a.pdf" { pages = { { input_content = "<p>a</p>" } } }`)
+	defer os.RemoveAll(tmpdir)
+
+	wkdir, wk := testutil.NewFakeWkhtmltopdf(t)
+	defer os.RemoveAll(wkdir)
+	cachedir := filepath.Join(tmpdir, "cache")
+
+	for key, value := range map[string]string{"HTML2PDF_WKHTMLTOPDF": wk, "HTML2PDF_CACHE_DIR": cachedir} {
+		prev, ok := os.LookupEnv(key)
+		os.Setenv(key, value)
+		if ok {
+			defer os.Setenv(key, prev)
+		} else {
+			defer os.Unsetenv(key)
+		}
+	}
+
+	status, out := runMain(t, "-dry-run", file)
+	if status != 0 {
+		t.Fatalf("expected the status 0, but got %d: %s", status, out)
+	}
+	if !strings.Contains(out, "    "+wk+" page "+filepath.Join(cachedir, "tmp")) {
+		t.Errorf("expected $HTML2PDF_WKHTMLTOPDF and $HTML2PDF_CACHE_DIR are used, but got %q", out)
+	}
+
+	// the flags override the environment variables.
+	other, otherWk := testutil.NewFakeWkhtmltopdf(t)
+	defer os.RemoveAll(other)
+
+	status, out = runMain(t, "-dry-run", "-wkhtmltopdf="+otherWk, "-cache-dir="+other, file)
+	if status != 0 {
+		t.Fatalf("expected the status 0, but got %d: %s", status, out)
+	}
+	if !strings.Contains(out, "    "+otherWk+" page "+filepath.Join(other, "tmp")) {
+		t.Errorf("expected the flags override the environment variables, but got %q", out)
+	}
+}
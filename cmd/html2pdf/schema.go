@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/kohkimakimoto/html2pdf/html2pdf"
+	"io/ioutil"
+	"os"
+)
+
+// schemaMain runs the schema command that prints the JSON Schema of the pdf config or validates config files by it.
+func schemaMain(args []string) (status int) {
+	defer func() {
+		if err := recover(); err != nil {
+			printError(err)
+			status = 1
+		}
+	}()
+
+	var optOutput string
+	var optManifest bool
+
+	fs := flag.NewFlagSet("schema", flag.ContinueOnError)
+	fs.StringVar(&optOutput, "o", "-", "")
+	fs.StringVar(&optOutput, "output", "-", "")
+	fs.BoolVar(&optManifest, "manifest", false, "")
+
+	fs.Usage = func() {
+		fmt.Println(`Usage: ` + html2pdf.Name + ` schema [OPTIONS...] [CONFIG_FILE...]
+
+  Print the JSON Schema of the pdf config.
+  If CONFIG_FILEs (.json, .yaml or .yml) are given, validate them by the schema instead.
+  The files that have 'pdfs' key are validated as manifests.
+
+Options:
+  -manifest                  Print the JSON Schema of the manifest instead.
+  -o, -output=FILE           Output file of the schema. Default is '-' that writes it to stdout.
+  -h, -help                  Show help
+`)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+
+	if fs.NArg() == 0 {
+		schema := html2pdf.ConfigSchema()
+		if optManifest {
+			schema = html2pdf.ManifestSchema()
+		}
+
+		b, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			printError(err)
+			return 1
+		}
+		b = append(b, '\n')
+
+		if optOutput == "-" {
+			os.Stdout.Write(b)
+		} else if err := ioutil.WriteFile(optOutput, b, 0666); err != nil {
+			printError(err)
+			return 1
+		}
+
+		return 0
+	}
+
+	for _, file := range fs.Args() {
+		v, err := html2pdf.LoadConfigFile(file)
+		if err == nil {
+			if m, ok := v.(map[string]interface{}); ok && m["pdfs"] != nil {
+				err = html2pdf.ValidateManifest(file, v)
+			} else {
+				err = html2pdf.ValidateConfig(file, v)
+			}
+		}
+		if err != nil {
+			printError(err)
+			status = 1
+			continue
+		}
+
+		fmt.Printf("%s: ok\n", file)
+	}
+
+	return status
+}
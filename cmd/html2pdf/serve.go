@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/kohkimakimoto/html2pdf/html2pdf"
+	"runtime"
+	"time"
+)
+
+// serveMain runs the serve command that renders pdfs on demand by a HTTP API.
+func serveMain(args []string) (status int) {
+	defer func() {
+		if err := recover(); err != nil {
+			printError(err)
+			status = 1
+		}
+	}()
+
+	var optLogLevel, optAddr, optCachedir, optWkhtmltopdf string
+	var optMaxJobs, optMaxPendingJobs, optMaxFinishedJobs int
+	var optMaxRequestSize, optMaxScriptMemory int64
+	var optAllowedHosts stringsFlag
+	var optTimeout, optJobTTL time.Duration
+	var optEnableScript bool
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.StringVar(&optLogLevel, "l", "info", "")
+	fs.StringVar(&optLogLevel, "log-level", "info", "")
+	fs.StringVar(&optAddr, "addr", "127.0.0.1:8080", "")
+	fs.IntVar(&optMaxJobs, "max-jobs", runtime.NumCPU(), "")
+	fs.Int64Var(&optMaxRequestSize, "max-request-size", 10<<20, "")
+	fs.DurationVar(&optTimeout, "timeout", 60*time.Second, "")
+	fs.DurationVar(&optJobTTL, "job-ttl", 10*time.Minute, "")
+	fs.IntVar(&optMaxPendingJobs, "max-pending-jobs", 100, "")
+	fs.IntVar(&optMaxFinishedJobs, "max-finished-jobs", 100, "")
+	fs.BoolVar(&optEnableScript, "enable-script", false, "")
+	fs.Int64Var(&optMaxScriptMemory, "max-script-memory", 256<<20, "")
+	fs.Var(&optAllowedHosts, "allow-host", "")
+	fs.StringVar(&optCachedir, "cache-dir", "", "")
+	fs.StringVar(&optWkhtmltopdf, "wkhtmltopdf", "", "")
+
+	fs.Usage = func() {
+		fmt.Println(`Usage: ` + html2pdf.Name + ` serve [OPTIONS...]
+
+  Render pdfs on demand by a HTTP API.
+
+Options:
+  -l, -log-level=LEVEL       Log level (quiet|error|warning|info|debug). Default is 'info'.
+  -addr=ADDR                 Address to listen on. Default is '127.0.0.1:8080'.
+  -max-jobs=N                Render N jobs concurrently. Default is the number of CPUs.
+  -max-request-size=BYTES    Max size of a request body. Default is 10485760 (10MB).
+  -timeout=DURATION          Time limit of a job like 30s. Default is '60s'.
+  -job-ttl=DURATION          Keep the finished jobs for the duration. Default is '10m'.
+  -max-pending-jobs=N        Reject new jobs while N jobs are not finished. Default is 100.
+  -max-finished-jobs=N       Keep at most N finished jobs. Default is 100.
+  -enable-script             Accept the requests that have lua scripts. They run in a sandbox.
+  -max-script-memory=BYTES   Max memory that a script allocates. Default is 268435456 (256MB).
+  -allow-host=HOST           Allow the http(s) inputs of the host like example.com or *.example.com.
+                             It can be specified multiple times. Default is any host.
+  -cache-dir=DIR             Cache directory. Default is $HTML2PDF_CACHE_DIR or $XDG_CACHE_HOME/html2pdf.
+  -wkhtmltopdf=PATH          Use the wkhtmltopdf instead of the bundled one. Default is $HTML2PDF_WKHTMLTOPDF.
+  -h, -help                  Show help
+`)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+
+	// initialize the logging by an app.
+	app := html2pdf.NewApp()
+	app.LogLevel = optLogLevel
+	if err := app.Init(); err != nil {
+		printError(err)
+		return 1
+	}
+	app.Close()
+
+	s := html2pdf.NewServer(func() *html2pdf.App {
+		app := newAppFromEnv()
+		if optCachedir != "" {
+			app.SetCachedir(optCachedir)
+		}
+		if optWkhtmltopdf != "" {
+			app.WkhtmltopdfCmd = optWkhtmltopdf
+		}
+		return app
+	})
+	s.MaxJobs = optMaxJobs
+	s.MaxRequestSize = optMaxRequestSize
+	s.Timeout = optTimeout
+	s.JobTTL = optJobTTL
+	s.MaxPendingJobs = optMaxPendingJobs
+	s.MaxFinishedJobs = optMaxFinishedJobs
+	s.EnableScript = optEnableScript
+	s.MaxScriptMemory = optMaxScriptMemory
+	s.AllowedHosts = optAllowedHosts
+
+	if err := s.ListenAndServe(optAddr); err != nil {
+		printError(err)
+		return 1
+	}
+
+	return status
+}
@@ -1,62 +1,114 @@
 package html2pdf
 
 import (
+	"bytes"
 	"encoding/json"
-	"github.com/kohkimakimoto/html2pdf/resource"
+	"fmt"
+	"github.com/kohkimakimoto/html2pdf/support/color"
 	"github.com/kohkimakimoto/loglv"
 	"github.com/yuin/gopher-lua"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 )
 
 type App struct {
-	LState         *lua.LState
-	LogLevel       string
-	variable       map[string]interface{}
-	Cachedir       string
-	CacheBindir    string
-	CacheTmpdir    string
+	LState      *lua.LState
+	LogLevel    string
+	variable    map[string]interface{}
+	Cachedir    string
+	CacheBindir string
+	CacheTmpdir string
+	// WkhtmltopdfCmd is the wkhtmltopdf command. The bundled one is extracted to the cache dir and set if it is empty.
+	// It is $HTML2PDF_WKHTMLTOPDF by default, and it is overridden by the 'wkhtmltopdf' settings.
 	WkhtmltopdfCmd string
-	Targetpdfs     []*TargetPdf
-	Tmpfiles       []string
+	// Renderer renders the pdfs instead of wkhtmltopdf if it is not nil. It is set by the 'renderer' settings.
+	Renderer   Renderer
+	CookieJar  *CookieJar
+	Targetpdfs []*TargetPdf
+	// defaults are the default values of the pdf configs that are set by html2pdf.defaults.
+	defaults      map[string]lua.LValue
+	Tmpfiles      []string
+	tmpfilesMutex sync.Mutex
+	// The number of the pdf configs that are rendered concurrently.
+	Jobs int
+	// hooks are the global hooks that are registered by html2pdf.on.
+	hooks map[string][]*lua.LFunction
+	// Force rebuilds the pdfs even if they are up to date.
+	Force bool
+	// StateFile has the fingerprints of the built pdfs to skip the unchanged ones.
+	StateFile  string
+	buildState *buildState
+	// buildStateChanges are the states that are updated in this run by the output files. nil removes the state.
+	buildStateChanges map[string]*targetState
+	buildStateMutex   sync.Mutex
+	// wkhtmltopdfVersionCache is the output of "wkhtmltopdf --version" that is a part of the fingerprints.
+	wkhtmltopdfVersionCache string
+	// luaMutex serializes the calls of the lua functions and the reads of the lua values of the pdf configs
+	// while the pdfs are built concurrently. The lua state and the tables are not goroutine safe.
+	luaMutex sync.Mutex
+	// Strict rejects the unknown keys and the values of unexpected types in the pdf configs. It is true by default.
+	Strict bool
+	// Sandbox is for the untrusted configs like the requests of the server. The script runs without the modules
+	// that access the files, the commands, the environment and the network, and the configs can't use the local files.
+	Sandbox bool
+	// MaxScriptMemory is the max bytes that a script can allocate in the sandbox. It is not limited if it is 0.
+	MaxScriptMemory int64
+	// AllowedHosts are the hosts of the http(s) inputs that are allowed in the sandbox like "example.com" and
+	// "*.example.com". Any host is allowed if it is empty.
+	AllowedHosts []string
+	// Names or glob patterns of the pdf configs to build. All of them are built if it is empty.
+	Targets []string
+	// The files that are loaded by the script.
+	loadedFiles []string
+	// The pdf is written to Stdout if the output_file is "-".
+	Stdout io.Writer
+	// The logs are written to LogOutput by Init. It is os.Stdout by default.
+	LogOutput io.Writer
+	// Logger outputs the logs of the app. The standard logger is used if it is nil.
+	Logger *log.Logger
 }
 
 func NewApp() *App {
 	L := lua.NewState()
 
-	cachedir := filepath.Join(os.TempDir(), "html2pdf_cache")
-	cacheBindir := filepath.Join(cachedir, "bin")
-	cacheTmpdir := filepath.Join(cachedir, "tmp")
-
-	var wk string
-	if runtime.GOOS == "windows" {
-		wk = filepath.Join(cacheBindir, "wkhtmltopdf.exe")
-	} else {
-		wk = filepath.Join(cacheBindir, "wkhtmltopdf")
-	}
-
 	app := &App{
 		LState: L,
 		variable: map[string]interface{}{
 			"GOARCH": runtime.GOARCH,
 			"GOOS":   runtime.GOOS,
 		},
-		Cachedir:       cachedir,
-		CacheBindir:    cacheBindir,
-		CacheTmpdir:    cacheTmpdir,
-		WkhtmltopdfCmd: wk,
-		Targetpdfs:     []*TargetPdf{},
-		Tmpfiles:       []string{},
+		CookieJar:  NewCookieJar(),
+		Targetpdfs: []*TargetPdf{},
+		defaults:   map[string]lua.LValue{},
+		hooks:      map[string][]*lua.LFunction{},
+		Tmpfiles:   []string{},
+		Stdout:     os.Stdout,
+		LogOutput:  os.Stdout,
+		Strict:     true,
 	}
 
+	app.SetCachedir(DefaultCachedir())
+
 	L.SetGlobal("var", toLValue(L, app.variable))
 
 	return app
 }
 
+// SetCachedir sets the cache directory and the directories in it.
+func (app *App) SetCachedir(cachedir string) {
+	app.Cachedir = cachedir
+	app.CacheBindir = filepath.Join(cachedir, "bin")
+	app.CacheTmpdir = filepath.Join(cachedir, "tmp")
+	app.StateFile = filepath.Join(cachedir, "build_state.json")
+}
+
 func (app *App) Close() {
 	app.LState.Close()
 	for _, f := range app.Tmpfiles {
@@ -69,8 +121,8 @@ func (app *App) Init() error {
 	log.SetFlags(0)
 	// support leveled logging.
 	loglv.Init()
-	// output to stdout
-	loglv.SetOutput(os.Stdout)
+	// output to stdout by default
+	loglv.SetOutput(app.LogOutput)
 
 	if app.LogLevel == "" {
 		app.LogLevel = "info"
@@ -127,6 +179,8 @@ func (app *App) LoadRecipe(recipeContent string) error {
 }
 
 func (app *App) LoadScriptFile(recipeFile string) error {
+	app.recordLoadedFile(recipeFile)
+
 	if err := app.LState.DoFile(recipeFile); err != nil {
 		return err
 	}
@@ -134,8 +188,67 @@ func (app *App) LoadScriptFile(recipeFile string) error {
 	return nil
 }
 
+func (app *App) recordLoadedFile(file string) {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+
+	for _, f := range app.loadedFiles {
+		if f == file {
+			return
+		}
+	}
+
+	app.loadedFiles = append(app.loadedFiles, file)
+}
+
+// LoadedFiles returns the absolute paths of the files that are loaded by the script.
+// They are the script file, the files read by dofile, loadfile, require and the fs module.
+func (app *App) LoadedFiles() []string {
+	L := app.LState
+
+	// find the files of the required modules by package.path.
+	if pkg, ok := L.GetGlobal("package").(*lua.LTable); ok {
+		paths, _ := toString(pkg.RawGetString("path"))
+		if loaded, ok := pkg.RawGetString("loaded").(*lua.LTable); ok {
+			loaded.ForEach(func(k, v lua.LValue) {
+				name, ok := toString(k)
+				if !ok {
+					return
+				}
+
+				for _, tmpl := range strings.Split(paths, ";") {
+					file := strings.Replace(tmpl, "?", strings.Replace(name, ".", string(filepath.Separator), -1), -1)
+					if fi, err := os.Stat(file); err == nil && !fi.IsDir() {
+						app.recordLoadedFile(file)
+						break
+					}
+				}
+			})
+		}
+	}
+
+	return app.loadedFiles
+}
+
 // see also http://stackoverflow.com/questions/5776125/wkhtmltopdf-command-fails
 func (app *App) CreateTempHTMLfileByContent(content []byte) (string, error) {
+	return app.createTempfileByContent(content, ".html")
+}
+
+func (app *App) CreateTempCSSfileByContent(content []byte) (string, error) {
+	return app.createTempfileByContent(content, ".css")
+}
+
+func (app *App) CreateTempCookieJarfile() (string, error) {
+	return app.createTempfileByContent([]byte{}, ".txt")
+}
+
+func (app *App) CreateTempPDFfile() (string, error) {
+	return app.createTempfileByContent([]byte{}, ".pdf")
+}
+
+func (app *App) createTempfileByContent(content []byte, ext string) (string, error) {
 	tmpFile, err := ioutil.TempFile(app.CacheTmpdir, "")
 	if err != nil {
 		return "", err
@@ -153,125 +266,434 @@ func (app *App) CreateTempHTMLfileByContent(content []byte) (string, error) {
 	}
 
 	name := tmpFile.Name()
-	name2 := name + ".html"
+	name2 := name + ext
 	if err := os.Rename(name, name2); err != nil {
 		return "", err
 	}
 
-	if loglv.IsDebug() {
-		log.Printf("    (Debug) Created tmpfile: %s", name2)
-	}
-
+	app.tmpfilesMutex.Lock()
 	app.Tmpfiles = append(app.Tmpfiles, name2)
+	app.tmpfilesMutex.Unlock()
 
 	return name2, nil
 }
 
-func (app *App) CreateTempCSSfileByContent(content []byte) (string, error) {
-	tmpFile, err := ioutil.TempFile(app.CacheTmpdir, "")
-	if err != nil {
-		return "", err
+func (app *App) Run() error {
+	app.logf("==> Starting " + Name + "...")
+
+	if loglv.IsDebug() {
+		app.logf("    (Debug) Log level '%s'", loglv.LvString())
 	}
-	defer tmpFile.Close()
 
-	_, err = tmpFile.Write(content)
+	if err := app.prepareCachedirs(); err != nil {
+		return err
+	}
+
+	if err := app.prepareWkhtmltopdf(); err != nil {
+		return err
+	}
+
+	app.logf("==> Loaded %d pdf config.", len(app.Targetpdfs))
+
+	targetpdfs, err := app.TargetPdfsToBuild()
 	if err != nil {
-		return "", err
+		return err
+	}
+	if len(app.Targets) > 0 {
+		app.logf("==> Selected %d pdf config.", len(targetpdfs))
 	}
 
-	err = tmpFile.Chmod(0600)
+	if err := app.runTargetPdfs(targetpdfs); err != nil {
+		return err
+	}
+
+	app.logf("==> Complete!")
+	return nil
+}
+
+// runTargetPdfs renders the pdf configs by app.Jobs workers.
+// It doesn't stop at a failure and returns all the failures as RunError.
+// A pdf config is rendered after its dependencies, and it is skipped if one of them fails.
+func (app *App) runTargetPdfs(targetpdfs []*TargetPdf) error {
+	targetpdfs, err := buildOrder(targetpdfs, false)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	name := tmpFile.Name()
-	name2 := name + ".css"
-	if err := os.Rename(name, name2); err != nil {
-		return "", err
+	jobs := app.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(targetpdfs) {
+		jobs = len(targetpdfs)
 	}
 
-	if loglv.IsDebug() {
-		log.Printf("    (Debug) Created tmpfile: %s", name2)
+	if jobs > 1 && loglv.IsDebug() {
+		app.logf("    (Debug) rendering by %d jobs", jobs)
 	}
 
-	app.Tmpfiles = append(app.Tmpfiles, name2)
+	app.loadBuildState()
+	defer func() {
+		if err := app.saveBuildState(); err != nil {
+			app.logf(color.FgY("==> Failed to save the build state: %v", err))
+		}
+	}()
 
-	return name2, nil
+	// errs keeps the order of the pdf configs.
+	errs := make([]error, len(targetpdfs))
+	indexes := make(chan int)
+
+	// done[i] is closed when targetpdfs[i] is finished.
+	// The dependencies are sent to the workers before the pdf configs that depend on them, so waiting for them doesn't deadlock.
+	done := make([]chan struct{}, len(targetpdfs))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				if err := app.waitDependencies(targetpdfs, idx, done, errs); err != nil {
+					errs[idx] = err
+				} else {
+					errs[idx] = app.runTargetPdf(targetpdfs[idx], jobs > 1)
+				}
+				close(done[idx])
+			}
+		}()
+	}
+
+	for i := range targetpdfs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	runErr := &RunError{}
+	for _, err := range errs {
+		if err != nil {
+			runErr.Errors = append(runErr.Errors, err)
+		}
+	}
+	if len(runErr.Errors) > 0 {
+		return runErr
+	}
+
+	return nil
 }
 
-func (app *App) Run() error {
-	log.Printf("==> Starting " + Name + "...")
+// waitDependencies waits for the dependencies of targetpdfs[idx] and returns an error if one of them failed.
+func (app *App) waitDependencies(targetpdfs []*TargetPdf, idx int, done []chan struct{}, errs []error) error {
+	tp := targetpdfs[idx]
 
-	if loglv.IsDebug() {
-		log.Printf("    (Debug) Log level '%s'", loglv.LvString())
+	app.luaMutex.Lock()
+	deps, err := tp.Dependencies()
+	app.luaMutex.Unlock()
+	if err != nil {
+		return &TargetPdfError{Name: tp.Name, Err: err}
+	}
+
+	for _, dep := range deps {
+		for i, t := range targetpdfs[:idx] {
+			if t != dep {
+				continue
+			}
+
+			<-done[i]
+			if errs[i] != nil {
+				err := &TargetPdfError{Name: tp.Name, Err: fmt.Errorf("skipped because '%s' failed", dep.Name)}
+				app.logf(color.FgRB("==> Skipped: %s ('%s' failed)", tp.Name, dep.Name))
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+var logMutex sync.Mutex
+
+// runTargetPdf renders a pdf config.
+// If grouped is true, the logs are buffered and output at once after rendering not to mix with the logs of other pdf configs.
+func (app *App) runTargetPdf(tp *TargetPdf, grouped bool) (err error) {
+	var buf *bytes.Buffer
+	if grouped {
+		buf = new(bytes.Buffer)
+		tp.logger = log.New(buf, "", 0)
 	}
 
-	// create cache directory
-	if _, err := os.Stat(app.Cachedir); os.IsNotExist(err) {
-		defaultUmask := Umask(0)
-		os.MkdirAll(app.Cachedir, 0777)
-		Umask(defaultUmask)
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+		if err != nil {
+			err = &TargetPdfError{Name: tp.Name, Err: err}
+			tp.logf(color.FgRB("    Failed: %v", err))
+		}
 
-		if loglv.IsDebug() {
-			log.Printf("    (Debug) created dir = %s", app.Cachedir)
+		if grouped {
+			tp.logger = nil
+			logMutex.Lock()
+			app.logf("%s", strings.TrimRight(buf.String(), "\n"))
+			logMutex.Unlock()
 		}
+	}()
+
+	return tp.buildWithHooks()
+}
+
+func (app *App) logf(format string, v ...interface{}) {
+	if app.Logger != nil {
+		app.Logger.Printf(format, v...)
+	} else {
+		log.Printf(format, v...)
+	}
+}
+
+// TargetPdfError is an error that occurred in rendering a pdf config.
+type TargetPdfError struct {
+	Name string
+	Err  error
+}
+
+func (e *TargetPdfError) Error() string {
+	switch e.Err.(type) {
+	case *ConfigError, ConfigErrors:
+		// they already have the name.
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("'%s': %v", e.Name, e.Err)
+}
+
+// RunError has all the errors that occurred in App.Run.
+type RunError struct {
+	Errors []error
+}
+
+func (e *RunError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+
+	msgs := []string{fmt.Sprintf("%d pdf configs failed:", len(e.Errors))}
+	for _, err := range e.Errors {
+		msgs = append(msgs, "  "+err.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// SelectedTargetPdfs returns the pdf configs that match the names or glob patterns in app.Targets.
+func (app *App) SelectedTargetPdfs() ([]*TargetPdf, error) {
+	if len(app.Targets) == 0 {
+		return app.Targetpdfs, nil
 	}
 
-	if _, err := os.Stat(app.CacheTmpdir); os.IsNotExist(err) {
-		defaultUmask := Umask(0)
-		os.MkdirAll(app.CacheTmpdir, 0777)
-		Umask(defaultUmask)
+	ret := []*TargetPdf{}
+	for _, pattern := range app.Targets {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid target pattern '%s': %v", pattern, err)
+		}
+
+		matched := false
+		for _, tp := range app.Targetpdfs {
+			if ok, _ := path.Match(pattern, tp.Name); ok {
+				matched = true
+				if !containsTargetPdf(ret, tp) {
+					ret = append(ret, tp)
+				}
+			}
+		}
+
+		if !matched {
+			return nil, fmt.Errorf("target '%s' doesn't match any pdf config", pattern)
+		}
+	}
 
-		if loglv.IsDebug() {
-			log.Printf("    (Debug) created dir = %s", app.CacheTmpdir)
+	// keep the order of the registration.
+	sorted := []*TargetPdf{}
+	for _, tp := range app.Targetpdfs {
+		if containsTargetPdf(ret, tp) {
+			sorted = append(sorted, tp)
 		}
 	}
 
-	if _, err := os.Stat(app.CacheBindir); os.IsNotExist(err) {
-		defaultUmask := Umask(0)
-		os.MkdirAll(app.CacheBindir, 0777)
-		Umask(defaultUmask)
+	return sorted, nil
+}
 
-		if loglv.IsDebug() {
-			log.Printf("    (Debug) created dir = %s", app.CacheBindir)
+func containsTargetPdf(list []*TargetPdf, tp *TargetPdf) bool {
+	for _, t := range list {
+		if t == tp {
+			return true
 		}
 	}
 
-	// check wkhtmltopdf command
-	if _, err := os.Stat(app.WkhtmltopdfCmd); os.IsNotExist(err) {
-		assetName := "wkhtmltopdf"
-		if runtime.GOOS == "windows" {
-			assetName = "wkhtmltopdf.exe"
+	return false
+}
+
+// List writes the names, the output files and the input sources of the pdf configs without rendering them.
+func (app *App) List(w io.Writer) error {
+	targetpdfs, err := app.TargetPdfsToBuild()
+	if err != nil {
+		return err
+	}
+
+	for _, tp := range targetpdfs {
+		fmt.Fprintf(w, "%s\n", tp.Name)
+		fmt.Fprintf(w, "    output_file: %s\n", tp.OutputFile())
+
+		deps, err := tp.Dependencies()
+		if err != nil {
+			return err
+		}
+		if len(deps) > 0 {
+			names := []string{}
+			for _, dep := range deps {
+				names = append(names, dep.Name)
+			}
+			fmt.Fprintf(w, "    depends_on: %s\n", strings.Join(names, ", "))
 		}
 
-		b, err := resource.Asset(assetName)
+		cover, err := tp.Cover()
 		if err != nil {
 			return err
 		}
+		if cover != nil {
+			fmt.Fprintf(w, "    cover: %s\n", inputSource(cover.Input, cover.InputContent))
+		}
 
-		err = ioutil.WriteFile(app.WkhtmltopdfCmd, b, 0777)
+		toc, err := tp.TOC()
 		if err != nil {
 			return err
 		}
+		if toc != nil {
+			fmt.Fprintf(w, "    toc: yes\n")
+		}
 
-		if loglv.IsDebug() {
-			log.Printf("    (Debug) outputed wkhtmltopdf = %s", app.WkhtmltopdfCmd)
+		pages, err := tp.Pages()
+		if err != nil {
+			return err
+		}
+		for _, p := range pages {
+			fmt.Fprintf(w, "    page: %s\n", inputSource(p.Input, p.InputContent))
 		}
 	}
 
-	if loglv.IsDebug() {
-		log.Printf("    (Debug) wkhtmltopdf command: %s", app.WkhtmltopdfCmd)
+	return nil
+}
+
+func inputSource(input string, inputContent string) string {
+	if inputContent != "" {
+		return "(input_content)"
 	}
 
-	log.Printf("==> Loaded %d pdf config.", len(app.Targetpdfs))
+	return input
+}
 
-	for _, tp := range app.Targetpdfs {
-		err := tp.Run()
+// prepareCachedirs creates the cache directories that only the user can access.
+func (app *App) prepareCachedirs() error {
+	for _, dir := range []string{app.Cachedir, app.CacheTmpdir, app.CacheBindir} {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				return err
+			}
+
+			if loglv.IsDebug() {
+				app.logf("    (Debug) created dir = %s", dir)
+			}
+		}
+	}
+
+	return checkPrivateDir(app.Cachedir)
+}
+
+// prepareMutex guards extracting wkhtmltopdf from the apps that run concurrently.
+var prepareMutex sync.Mutex
+
+// prepareWkhtmltopdf extracts the bundled wkhtmltopdf if app.WkhtmltopdfCmd is not set.
+// An external wkhtmltopdf is probed to check the options of the pdf configs are supported.
+// The bundled one is stored in the directory of the version and the checksum, and it is verified by the checksum every time.
+// It is written to a temporary file and renamed, so the other processes never run a partially written one.
+func (app *App) prepareWkhtmltopdf() error {
+	prepareMutex.Lock()
+	defer prepareMutex.Unlock()
+
+	// wkhtmltopdf isn't used by the other renderers.
+	if app.Renderer != nil {
+		return nil
+	}
+
+	if app.WkhtmltopdfCmd != "" {
+		info, err := probeWkhtmltopdf(app.WkhtmltopdfCmd)
 		if err != nil {
 			return err
 		}
+
+		app.logf("==> Using %s: %s", info.Version, app.WkhtmltopdfCmd)
+		if info.Options == nil {
+			app.logf(color.FgY("==> The options that the wkhtmltopdf supports are unknown because --extended-help can't be parsed. The pdf configs fail in the strict mode."))
+		}
+		if !info.Patched {
+			app.logf(color.FgY("==> The wkhtmltopdf is built without the patched qt. cover, toc, header, footer and multiple pages are not supported."))
+		}
+		return nil
+	}
+
+	data, sum, err := bundledWkhtmltopdf()
+	if err != nil {
+		return err
+	}
+
+	cmd, err := app.extractWkhtmltopdf(data, sum)
+	if err != nil {
+		return err
+	}
+	app.WkhtmltopdfCmd = cmd
+
+	if loglv.IsDebug() {
+		app.logf("    (Debug) wkhtmltopdf command: %s", app.WkhtmltopdfCmd)
 	}
 
-	log.Print("==> Complete!")
 	return nil
 }
+
+// extractWkhtmltopdf writes the wkhtmltopdf to the cache dir unless the file has the same checksum, and returns the path.
+func (app *App) extractWkhtmltopdf(data []byte, sum string) (string, error) {
+	name := "wkhtmltopdf"
+	if runtime.GOOS == "windows" {
+		name = "wkhtmltopdf.exe"
+	}
+	dir := filepath.Join(app.CacheBindir, Version+"-"+sum[:12])
+	cmd := filepath.Join(dir, name)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(cmd); err == nil {
+		actual, err := hashFile(cmd)
+		if err != nil {
+			return "", err
+		}
+		if actual == sum {
+			return cmd, nil
+		}
+		app.logf(color.FgY("==> The checksum of %s doesn't match. It is extracted again.", cmd))
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	if err := writeFileAtomically(cmd, data, 0700); err != nil {
+		return "", err
+	}
+
+	if loglv.IsDebug() {
+		app.logf("    (Debug) outputed wkhtmltopdf = %s", cmd)
+	}
+
+	return cmd, nil
+}
@@ -0,0 +1,99 @@
+package html2pdf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSelectedTargetPdfs(t *testing.T) {
+	script := `
+pdf "handbook.pdf" { pages = { input = "handbook.html" } }
+pdf "chapter1.pdf" { pages = { input = "chapter1.html" } }
+pdf "chapter2.pdf" { pages = { input = "chapter2.html" } }
+pdf "docs/api.pdf" { pages = { input = "api.html" } }
+pdf "docs/guide.pdf" { pages = { input = "guide.html" } }
+`
+	cases := []struct {
+		targets  []string
+		expected string
+		err      string
+	}{
+		{targets: nil, expected: "handbook.pdf,chapter1.pdf,chapter2.pdf,docs/api.pdf,docs/guide.pdf"},
+		{targets: []string{"chapter2.pdf"}, expected: "chapter2.pdf"},
+		{targets: []string{"chapter*"}, expected: "chapter1.pdf,chapter2.pdf"},
+		{targets: []string{"chapter?.pdf", "handbook.pdf"}, expected: "handbook.pdf,chapter1.pdf,chapter2.pdf"},
+		{targets: []string{"chapter[2-9].pdf", "chapter2.pdf"}, expected: "chapter2.pdf"},
+		// "*" doesn't match "/" like the paths.
+		{targets: []string{"*"}, expected: "handbook.pdf,chapter1.pdf,chapter2.pdf"},
+		{targets: []string{"docs/*"}, expected: "docs/api.pdf,docs/guide.pdf"},
+		{targets: []string{"chapter*", "none*"}, err: "target 'none*' doesn't match any pdf config"},
+		{targets: []string{"chapter["}, err: "invalid target pattern 'chapter[': syntax error in pattern"},
+	}
+
+	for _, c := range cases {
+		app := newTestApp(t)
+		if err := app.LoadRecipe(script); err != nil {
+			t.Fatal(err)
+		}
+		app.Targets = c.targets
+
+		targetpdfs, err := app.SelectedTargetPdfs()
+		closeTestApp(app)
+
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("%v: expected error %q, but got %v", c.targets, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", c.targets, err)
+		} else if actual := namesOf(targetpdfs); actual != c.expected {
+			t.Errorf("%v: expected %s, but got %s", c.targets, c.expected, actual)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	app := newTestApp(t)
+	defer closeTestApp(app)
+
+	err := app.LoadRecipe(`
+pdf "handbook.pdf" {
+    output_file = "out/handbook.pdf",
+    cover = { input = "cover.html" },
+    toc = {},
+    pages = {
+        { input = "chapter1.html" },
+        { input_content = "<p>appendix</p>" },
+    },
+}
+pdf "other.pdf" { pages = { input = "other.html" } }
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Targets = []string{"hand*"}
+
+	buf := new(bytes.Buffer)
+	if err := app.List(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `handbook.pdf
+    output_file: out/handbook.pdf
+    cover: cover.html
+    toc: yes
+    page: chapter1.html
+    page: (input_content)
+`
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\nbut got\n%s", expected, buf.String())
+	}
+
+	app.Targets = []string{"none.pdf"}
+	if err := app.List(buf); err == nil || !strings.Contains(err.Error(), "target 'none.pdf' doesn't match any pdf config") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,411 @@
+package html2pdf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/kohkimakimoto/html2pdf/support/color"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// buildStateVersion is changed when the fingerprints are computed differently, to rebuild all the pdfs.
+const buildStateVersion = 3
+
+// buildState has the fingerprints of the pdfs that were built, to skip the unchanged ones.
+type buildState struct {
+	Version int `json:"version"`
+	// Targets are the states by the absolute paths of the output files.
+	Targets map[string]*targetState `json:"targets"`
+}
+
+type targetState struct {
+	Name string `json:"name"`
+	// Fingerprints are the hashes by the parts like "config", "wkhtmltopdf" and "file:/path/to/input.html".
+	Fingerprints map[string]string `json:"fingerprints"`
+}
+
+func newBuildState() *buildState {
+	return &buildState{
+		Version: buildStateVersion,
+		Targets: map[string]*targetState{},
+	}
+}
+
+// loadBuildState reads the build state file. A broken or old state file is ignored and all the pdfs are rebuilt.
+func (app *App) loadBuildState() {
+	app.buildStateMutex.Lock()
+	defer app.buildStateMutex.Unlock()
+
+	app.buildState = newBuildState()
+	app.buildStateChanges = map[string]*targetState{}
+
+	state, err := readBuildState(app.StateFile)
+	if err != nil {
+		app.logf(color.FgY("==> Ignored the broken build state file: %s", app.StateFile))
+		return
+	}
+	if state != nil {
+		app.buildState = state
+	}
+}
+
+// readBuildState reads the build state file. It returns nil if the file doesn't exist.
+func readBuildState(filename string) (*buildState, error) {
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	state := &buildState{}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, err
+	}
+	if state.Version != buildStateVersion || state.Targets == nil {
+		return nil, fmt.Errorf("unsupported build state version %d", state.Version)
+	}
+
+	return state, nil
+}
+
+// saveBuildState writes the changes of the build state in this run to the file.
+// The other processes can write the file concurrently, so the file is read again and updated in the lock file,
+// and it is written atomically not to be read partially.
+func (app *App) saveBuildState() error {
+	app.buildStateMutex.Lock()
+	defer app.buildStateMutex.Unlock()
+
+	if app.buildState == nil || len(app.buildStateChanges) == 0 {
+		return nil
+	}
+
+	unlock, err := lockFile(app.StateFile + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state, err := readBuildState(app.StateFile)
+	if err != nil || state == nil {
+		state = newBuildState()
+	}
+	for output, ts := range app.buildStateChanges {
+		if ts == nil {
+			delete(state.Targets, output)
+		} else {
+			state.Targets[output] = ts
+		}
+	}
+
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomically(app.StateFile, b, 0600); err != nil {
+		return err
+	}
+	app.buildStateChanges = map[string]*targetState{}
+
+	return nil
+}
+
+var (
+	// lockFileTimeout is how long lockFile waits for the other process.
+	lockFileTimeout = 30 * time.Second
+	// lockFileStale is the age of a lock file that is left by a crashed process. The lock is held only while a file is written.
+	lockFileStale = time.Minute
+)
+
+// lockFile creates the lock file exclusively, waiting for the other process that has it. The returned func removes it.
+func lockFile(filename string) (func(), error) {
+	deadline := time.Now().Add(lockFileTimeout)
+	for {
+		f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(filename) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if fi, err := os.Stat(filename); err == nil && time.Since(fi.ModTime()) > lockFileStale {
+			os.Remove(filename)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for the lock file %s", filename)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// writeFileAtomically writes the data to a temporary file in the same directory and renames it to the file.
+func writeFileAtomically(filename string, data []byte, perm os.FileMode) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Chmod(perm); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), filename)
+}
+
+// updateBuildState records the fingerprints of the built pdf. nil forgets the pdf to rebuild it next time.
+func (app *App) updateBuildState(doc *ResolvedDocument, fingerprints map[string]string) {
+	output, ok := absOutputFile(doc.OutputFile)
+	if !ok {
+		return
+	}
+
+	app.buildStateMutex.Lock()
+	defer app.buildStateMutex.Unlock()
+
+	if app.buildState == nil {
+		return
+	}
+
+	var ts *targetState
+	if fingerprints == nil {
+		delete(app.buildState.Targets, output)
+	} else {
+		ts = &targetState{Name: doc.Name, Fingerprints: fingerprints}
+		app.buildState.Targets[output] = ts
+	}
+	app.buildStateChanges[output] = ts
+}
+
+// absOutputFile returns the absolute path of the output file. It returns false if the pdf is written to stdout.
+func absOutputFile(outputFile string) (string, bool) {
+	if outputFile == "-" {
+		return "", false
+	}
+
+	abs, err := filepath.Abs(outputFile)
+	if err != nil {
+		return "", false
+	}
+
+	return abs, true
+}
+
+// checkBuildState returns the fingerprints of the pdf and the reason to rebuild it.
+// The reason is empty if the pdf is up to date. The fingerprints are nil if the pdf can't be fingerprinted.
+func (tp *TargetPdf) checkBuildState(doc *ResolvedDocument, p *preparedRender) (map[string]string, string, error) {
+	app := tp.App
+
+	output, ok := absOutputFile(doc.OutputFile)
+	if !ok {
+		return nil, "the output is stdout", nil
+	}
+	if tp.hasRemoteInputs() {
+		return nil, "the remote inputs can't be fingerprinted", nil
+	}
+
+	fingerprints, err := tp.fingerprints(doc, p)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if app.Force {
+		return fingerprints, "forced by -force", nil
+	}
+
+	app.buildStateMutex.Lock()
+	var prev *targetState
+	if app.buildState != nil {
+		prev = app.buildState.Targets[output]
+	}
+	app.buildStateMutex.Unlock()
+
+	if prev == nil {
+		return fingerprints, "no previous build", nil
+	}
+	if _, err := os.Stat(output); err != nil {
+		return fingerprints, "the output file doesn't exist", nil
+	}
+
+	if changed := changedFingerprints(prev.Fingerprints, fingerprints); len(changed) > 0 {
+		return fingerprints, strings.Join(changed, ", ") + " changed", nil
+	}
+
+	return fingerprints, "", nil
+}
+
+// changedFingerprints returns the readable names of the parts that are changed like "config" and "input.html".
+func changedFingerprints(prev map[string]string, current map[string]string) []string {
+	keys := []string{}
+	for k, v := range current {
+		if prev[k] != v {
+			keys = append(keys, k)
+		}
+	}
+	for k := range prev {
+		if _, ok := current[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	ret := []string{}
+	for _, k := range keys {
+		switch {
+		case strings.HasPrefix(k, "file:"):
+			ret = append(ret, filepath.Base(strings.TrimPrefix(k, "file:")))
+		case strings.HasPrefix(k, "depends_on:"):
+			ret = append(ret, strings.TrimPrefix(k, "depends_on:"))
+		case k == "wkhtmltopdf":
+			ret = append(ret, "wkhtmltopdf version")
+		default:
+			ret = append(ret, k)
+		}
+	}
+
+	return ret
+}
+
+// fingerprints returns the hashes of the things that affect the pdf.
+//
+//   - args: the command and the args of the prepared render. The temporary files of the contents like input_content are hashed by the contents.
+//   - config: the resolved document, if the renderer doesn't run a command like FakeRenderer.
+//   - file:PATH: the local input files and stylesheets.
+//   - depends_on:NAME: the output files of the dependencies.
+//   - wkhtmltopdf: the version of wkhtmltopdf.
+func (tp *TargetPdf) fingerprints(doc *ResolvedDocument, p *preparedRender) (map[string]string, error) {
+	app := tp.App
+	ret := map[string]string{}
+
+	if _, ok := app.renderer().(*WkhtmltopdfRenderer); ok {
+		version, err := app.wkhtmltopdfVersion()
+		if err != nil {
+			return nil, err
+		}
+		ret["wkhtmltopdf"] = version
+	}
+
+	if len(p.args) > 0 {
+		ret["args"] = app.argsHash(p.args[0], p.args[1:])
+	} else {
+		b, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		ret["config"] = hashString(string(b))
+	}
+
+	for _, f := range tp.LocalFiles() {
+		ret["file:"+f] = fileHash(f)
+	}
+
+	deps, err := tp.Dependencies()
+	if err != nil {
+		return nil, err
+	}
+	for _, dep := range deps {
+		if output, ok := absOutputFile(dep.OutputFile()); ok {
+			ret["depends_on:"+dep.Name] = fileHash(output)
+		}
+	}
+
+	return ret, nil
+}
+
+// argsHash returns the hash of the command and the args.
+// The paths of the temporary files differ in every build, so they are replaced by the hashes of the contents.
+func (app *App) argsHash(cmd string, args []string) string {
+	app.tmpfilesMutex.Lock()
+	tmpfiles := make([]string, len(app.Tmpfiles))
+	copy(tmpfiles, app.Tmpfiles)
+	app.tmpfilesMutex.Unlock()
+
+	s := strings.Join(append([]string{cmd}, args...), "\x00")
+	for _, f := range tmpfiles {
+		if strings.Contains(s, f) {
+			s = strings.Replace(s, f, "tmpfile:"+fileHash(f), -1)
+		}
+	}
+
+	return hashString(s)
+}
+
+// hasRemoteInputs returns true if the pdf reads the inputs by URLs like https://example.com.
+func (tp *TargetPdf) hasRemoteInputs() bool {
+	inputs := []string{}
+
+	if cover, err := tp.Cover(); err == nil && cover != nil {
+		inputs = append(inputs, cover.Input)
+	}
+	if pages, err := tp.Pages(); err == nil {
+		for _, p := range pages {
+			inputs = append(inputs, p.Input)
+			if p.Header != nil {
+				inputs = append(inputs, p.Header.HTML)
+			}
+			if p.Footer != nil {
+				inputs = append(inputs, p.Footer.HTML)
+			}
+		}
+	}
+
+	for _, input := range inputs {
+		if strings.Contains(input, "://") && !strings.HasPrefix(input, "file://") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wkhtmltopdfVersion returns the output of "wkhtmltopdf --version". It is run once by an app.
+func (app *App) wkhtmltopdfVersion() (string, error) {
+	app.buildStateMutex.Lock()
+	defer app.buildStateMutex.Unlock()
+
+	if app.wkhtmltopdfVersionCache != "" {
+		return app.wkhtmltopdfVersionCache, nil
+	}
+
+	out, err := exec.Command(app.WkhtmltopdfCmd, "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the version of wkhtmltopdf: %v", err)
+	}
+	app.wkhtmltopdfVersionCache = strings.TrimSpace(string(out))
+
+	return app.wkhtmltopdfVersionCache, nil
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// fileHash returns the fingerprint of the file content, or "missing" if the file can't be read.
+func fileHash(filename string) string {
+	sum, err := hashFile(filename)
+	if err != nil {
+		return "missing"
+	}
+
+	return sum
+}
@@ -0,0 +1,258 @@
+package html2pdf
+
+import (
+	"bytes"
+	"github.com/kohkimakimoto/html2pdf/support/testutil"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIncrementalBuild(t *testing.T) {
+	tmpdir, wk := testutil.NewFakeWkhtmltopdf(t)
+	defer os.RemoveAll(tmpdir)
+
+	input := filepath.Join(tmpdir, "a.html")
+	output := filepath.Join(tmpdir, "a.pdf")
+	if err := ioutil.WriteFile(input, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// run builds the pdfs by a new app like running the command again, and returns the logs.
+	run := func(script string, force bool) string {
+		buf := new(bytes.Buffer)
+
+		app := NewApp()
+		app.SetCachedir(tmpdir)
+		app.WkhtmltopdfCmd = wk
+		app.Logger = log.New(buf, "", 0)
+		app.Force = force
+		app.openLibs()
+		defer app.Close()
+
+		if err := app.LoadRecipe(script); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		return buf.String()
+	}
+
+	script := `
+pdf "a.pdf" {
+    output_file = "` + output + `",
+    pages = {
+        { input = "` + input + `" },
+        { input_content = "<p>content</p>" },
+    },
+}
+`
+	steps := []struct {
+		name     string
+		script   string
+		force    bool
+		prepare  func()
+		expected string
+	}{
+		{name: "first", script: script, expected: "rebuild: no previous build"},
+		{name: "unchanged", script: script, expected: "skipped: up to date"},
+		{
+			name:     "input changed",
+			script:   script,
+			prepare:  func() { ioutil.WriteFile(input, []byte("b"), 0644) },
+			expected: "rebuild: a.html changed",
+		},
+		{
+			name:     "input_content changed",
+			script:   strings.Replace(script, "<p>content</p>", "<p>changed</p>", 1),
+			expected: "rebuild: args changed",
+		},
+		{
+			name:     "option changed",
+			script:   strings.Replace(script, `input = "`+input+`"`, `input = "`+input+`", zoom = 1.5`, 1),
+			expected: "rebuild: args changed",
+		},
+		{
+			name:     "option value changed",
+			script:   strings.Replace(script, `input = "`+input+`"`, `input = "`+input+`", zoom = 2`, 1),
+			expected: "rebuild: args changed",
+		},
+		{
+			name:     "option value unchanged",
+			script:   strings.Replace(script, `input = "`+input+`"`, `input = "`+input+`", zoom = 2`, 1),
+			expected: "skipped: up to date",
+		},
+		{
+			name:     "output removed",
+			script:   script,
+			prepare:  func() { os.Remove(output) },
+			expected: "rebuild: the output file doesn't exist",
+		},
+		{name: "forced", script: script, force: true, expected: "rebuild: forced by -force"},
+		{name: "unchanged after forced", script: script, expected: "skipped: up to date"},
+	}
+
+	for _, step := range steps {
+		if step.prepare != nil {
+			step.prepare()
+		}
+
+		logs := run(step.script, step.force)
+		if !strings.Contains(logs, step.expected) {
+			t.Errorf("%s: expected logs contain %q, but got\n%s", step.name, step.expected, logs)
+		}
+	}
+}
+
+func TestIncrementalBuildAlwaysRebuilds(t *testing.T) {
+	app := newTestApp(t)
+	defer closeTestApp(app)
+	app.WkhtmltopdfCmd = testutil.WriteFakeWkhtmltopdf(t, app.Cachedir)
+
+	buf := new(bytes.Buffer)
+	app.Logger = log.New(buf, "", 0)
+	app.Stdout = ioutil.Discard
+
+	err := app.LoadRecipe(`
+pdf "stdout.pdf" { pages = { input = "a.html" }, output_file = "-" }
+pdf "remote.pdf" { pages = { input = "https://example.com" }, output_file = "` + filepath.Join(app.Cachedir, "remote.pdf") + `" }
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := app.Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, expected := range []string{"rebuild: the output is stdout", "rebuild: the remote inputs can't be fingerprinted"} {
+		if strings.Count(buf.String(), expected) != 2 {
+			t.Errorf("expected %q twice, but got\n%s", expected, buf.String())
+		}
+	}
+}
+
+func TestChangedFingerprints(t *testing.T) {
+	prev := map[string]string{
+		"args":                    "1",
+		"wkhtmltopdf":             "0.12.3",
+		"file:/tmp/a.html":        "1",
+		"file:/tmp/b.html":        "1",
+		"depends_on:chapter1.pdf": "1",
+	}
+	current := map[string]string{
+		"args":                    "1",
+		"wkhtmltopdf":             "0.12.4",
+		"file:/tmp/a.html":        "2",
+		"file:/tmp/c.html":        "1",
+		"depends_on:chapter1.pdf": "2",
+	}
+
+	actual := strings.Join(changedFingerprints(prev, current), ", ")
+	expected := "chapter1.pdf, a.html, b.html, c.html, wkhtmltopdf version"
+	if actual != expected {
+		t.Errorf("expected %s, but got %s", expected, actual)
+	}
+}
+
+func TestIncrementalBuildPreparesArgsOnce(t *testing.T) {
+	app := newTestApp(t)
+	defer closeTestApp(app)
+	app.WkhtmltopdfCmd = testutil.WriteFakeWkhtmltopdf(t, app.Cachedir)
+
+	err := app.LoadRecipe(`
+pdf "a.pdf" {
+    output_file = "` + filepath.Join(app.Cachedir, "a.pdf") + `",
+    pages = { { input_content = "<p>a</p>", header = { html_content = "<p>header</p>" } } },
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the args are fingerprinted and rendered, but the contents are written to the temporary files once.
+	if len(app.Tmpfiles) != 2 {
+		t.Errorf("expected 2 temporary files, but got %v", app.Tmpfiles)
+	}
+}
+
+func TestSaveBuildStateMergesConcurrentRuns(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "html2pdf_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// the two runs load the state before either of them saves it, like the processes that run at the same time.
+	apps := []*App{NewApp(), NewApp()}
+	for _, app := range apps {
+		app.StateFile = filepath.Join(tmpdir, "state.json")
+		app.loadBuildState()
+	}
+	apps[0].updateBuildState(&ResolvedDocument{Name: "a.pdf", OutputFile: filepath.Join(tmpdir, "a.pdf")}, map[string]string{"args": "a"})
+	apps[1].updateBuildState(&ResolvedDocument{Name: "b.pdf", OutputFile: filepath.Join(tmpdir, "b.pdf")}, map[string]string{"args": "b"})
+	for _, app := range apps {
+		if err := app.saveBuildState(); err != nil {
+			t.Fatal(err)
+		}
+		app.Close()
+	}
+
+	state, err := readBuildState(filepath.Join(tmpdir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.pdf", "b.pdf"} {
+		if ts := state.Targets[filepath.Join(tmpdir, name)]; ts == nil || ts.Name != name {
+			t.Errorf("expected the state of %s is saved, but got %v", name, state.Targets)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmpdir, "state.json.lock")); !os.IsNotExist(err) {
+		t.Errorf("expected the lock file is removed, but got %v", err)
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "html2pdf_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	timeout := lockFileTimeout
+	lockFileTimeout = 100 * time.Millisecond
+	defer func() { lockFileTimeout = timeout }()
+
+	lock := filepath.Join(tmpdir, "state.json.lock")
+	unlock, err := lockFile(lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a lock file is waited for until the timeout, and a stale one is left by a crashed process.
+	if _, err := lockFile(lock); err == nil || !strings.Contains(err.Error(), "timed out waiting for the lock file") {
+		t.Errorf("expected the timeout, but got %v", err)
+	}
+	old := time.Now().Add(-2 * lockFileStale)
+	os.Chtimes(lock, old, old)
+	unlock2, err := lockFile(lock)
+	if err != nil {
+		t.Errorf("expected the stale lock file is removed, but got %v", err)
+	} else {
+		unlock2()
+	}
+
+	unlock()
+}
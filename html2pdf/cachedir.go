@@ -0,0 +1,101 @@
+package html2pdf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/kohkimakimoto/html2pdf/resource"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// CachedirEnv is the environment variable that the command reads to override the default cache directory.
+const CachedirEnv = "HTML2PDF_CACHE_DIR"
+
+// DefaultCachedir returns the cache directory of the user.
+// It is $XDG_CACHE_HOME/html2pdf or the cache directory of the OS like ~/.cache/html2pdf.
+func DefaultCachedir() string {
+	if dir := userCachedir(); dir != "" {
+		return filepath.Join(dir, "html2pdf")
+	}
+
+	// there is no home directory. the user id is added not to share the directory with other users.
+	return filepath.Join(os.TempDir(), fmt.Sprintf("html2pdf_cache_%d", os.Getuid()))
+}
+
+func userCachedir() string {
+	if dir := os.Getenv("XDG_CACHE_HOME"); filepath.IsAbs(dir) {
+		return dir
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		return os.Getenv("LocalAppData")
+	case "darwin":
+		if home := os.Getenv("HOME"); home != "" {
+			return filepath.Join(home, "Library", "Caches")
+		}
+	default:
+		if home := os.Getenv("HOME"); home != "" {
+			return filepath.Join(home, ".cache")
+		}
+	}
+
+	return ""
+}
+
+// bundled is the wkhtmltopdf embedded in the binary. It is read and verified once because it is large.
+var bundled struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+// bundledWkhtmltopdf returns the embedded wkhtmltopdf and its sha256 checksum.
+// The checksum is generated with the embedded files by "make build_bindata", and the embedded file is verified against it.
+func bundledWkhtmltopdf() ([]byte, string, error) {
+	bundled.once.Do(func() {
+		assetName := "wkhtmltopdf"
+		if runtime.GOOS == "windows" {
+			assetName = "wkhtmltopdf.exe"
+		}
+
+		data, err := resource.Asset(assetName)
+		if err != nil {
+			bundled.err = err
+			return
+		}
+		if err := verifyChecksum(data, resource.WkhtmltopdfSHA256); err != nil {
+			bundled.err = fmt.Errorf("the bundled wkhtmltopdf is broken: %v", err)
+			return
+		}
+
+		bundled.data = data
+	})
+
+	return bundled.data, resource.WkhtmltopdfSHA256, bundled.err
+}
+
+// verifyChecksum checks the sha256 checksum of the data.
+func verifyChecksum(data []byte, sum string) error {
+	s := sha256.Sum256(data)
+	if actual := hex.EncodeToString(s[:]); actual != sum {
+		return fmt.Errorf("the sha256 checksum %s doesn't match %s", actual, sum)
+	}
+
+	return nil
+}
+
+// hashFile returns the sha256 checksum of the file.
+func hashFile(filename string) (string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,28 @@
+// +build !windows
+
+package html2pdf
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkPrivateDir checks the directory is owned by the user, and makes it private if it is accessible by others.
+// A directory that is owned by another user is rejected, because the user could plant a wkhtmltopdf in it.
+func checkPrivateDir(dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("the cache dir %s is owned by another user (uid %d)", dir, st.Uid)
+	}
+
+	if fi.Mode().Perm()&0077 != 0 {
+		return os.Chmod(dir, 0700)
+	}
+
+	return nil
+}
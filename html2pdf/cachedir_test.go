@@ -0,0 +1,164 @@
+package html2pdf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func setenv(t *testing.T, key string, value string) func() {
+	prev, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+
+	return func() {
+		if ok {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestDefaultCachedir(t *testing.T) {
+	defer setenv(t, "XDG_CACHE_HOME", "/xdg/cache")()
+
+	if dir := DefaultCachedir(); dir != filepath.Join("/xdg/cache", "html2pdf") {
+		t.Errorf("expected $XDG_CACHE_HOME/html2pdf, but got %s", dir)
+	}
+
+	if runtime.GOOS != "windows" && runtime.GOOS != "darwin" {
+		os.Setenv("XDG_CACHE_HOME", "relative/cache")
+		defer setenv(t, "HOME", "/home/user")()
+
+		if dir := DefaultCachedir(); dir != filepath.Join("/home/user", ".cache", "html2pdf") {
+			t.Errorf("expected ~/.cache/html2pdf for the relative $XDG_CACHE_HOME, but got %s", dir)
+		}
+	}
+}
+
+func TestPrepareCachedirs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the permissions are not supported on windows")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "html2pdf_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	app := NewApp()
+	defer app.Close()
+	app.SetCachedir(filepath.Join(tmpdir, "cache"))
+
+	if err := app.prepareCachedirs(); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{app.Cachedir, app.CacheBindir, app.CacheTmpdir} {
+		fi, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0700 {
+			t.Errorf("%s: expected 0700, but got %o", dir, fi.Mode().Perm())
+		}
+	}
+
+	// a shared cache dir is made private.
+	if err := os.Chmod(app.Cachedir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.prepareCachedirs(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(app.Cachedir); fi.Mode().Perm() != 0700 {
+		t.Errorf("expected 0700, but got %o", fi.Mode().Perm())
+	}
+}
+
+func TestExtractWkhtmltopdf(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "html2pdf_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	buf := new(bytes.Buffer)
+	app := NewApp()
+	defer app.Close()
+	app.SetCachedir(tmpdir)
+	app.Logger = log.New(buf, "", 0)
+	if err := app.prepareCachedirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("#!/bin/sh\necho wkhtmltopdf\n")
+	s := sha256.Sum256(data)
+	sum := hex.EncodeToString(s[:])
+
+	cmd, err := app.extractWkhtmltopdf(data, sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir := filepath.Dir(cmd); dir != filepath.Join(app.CacheBindir, Version+"-"+sum[:12]) {
+		t.Errorf("unexpected dir %s", dir)
+	}
+	if b, _ := ioutil.ReadFile(cmd); !bytes.Equal(b, data) {
+		t.Errorf("unexpected content %q", b)
+	}
+
+	// a tampered wkhtmltopdf is extracted again.
+	if err := ioutil.WriteFile(cmd, []byte("tampered"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.extractWkhtmltopdf(data, sum); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(cmd); !bytes.Equal(b, data) {
+		t.Errorf("expected the wkhtmltopdf is extracted again, but got %q", b)
+	}
+	if !strings.Contains(buf.String(), "doesn't match") {
+		t.Errorf("expected the warning, but got %q", buf.String())
+	}
+
+	// no temporary files are left.
+	files, err := ioutil.ReadDir(filepath.Dir(cmd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected only the wkhtmltopdf, but got %d files", len(files))
+	}
+
+	// a wkhtmltopdf that can't be read is an error, not a missing one.
+	if err := os.Remove(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(cmd, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.extractWkhtmltopdf(data, sum); err == nil {
+		t.Errorf("expected the error of reading %s", cmd)
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	data := []byte("wkhtmltopdf")
+	s := sha256.Sum256(data)
+
+	if err := verifyChecksum(data, hex.EncodeToString(s[:])); err != nil {
+		t.Error(err)
+	}
+	if err := verifyChecksum([]byte("tampered"), hex.EncodeToString(s[:])); err == nil || !strings.Contains(err.Error(), "doesn't match") {
+		t.Errorf("expected the checksum doesn't match, but got %v", err)
+	}
+}
@@ -0,0 +1,8 @@
+// +build windows
+
+package html2pdf
+
+// checkPrivateDir does nothing on windows. The cache dir in LocalAppData is private by the ACL of the user profile.
+func checkPrivateDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,349 @@
+package html2pdf
+
+import (
+	"fmt"
+	"github.com/yuin/gopher-lua"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Component is a validated part of pdf configs that is made by html2pdf.page, html2pdf.cover, html2pdf.toc and html2pdf.options.
+// It can be stored in variables and shared by several pdf configs.
+//
+//	local a4 = html2pdf.options { page_size = "A4", margin_top = "20mm" }
+//	local page = html2pdf.page { zoom = 1.2 }
+//
+//	pdf "a.pdf" { options = a4, pages = { page:with { input = "a.html" } } }
+//	pdf "b.pdf" { options = a4, pages = { page:with { input = "b.html" } } }
+type Component struct {
+	// Kind is one of "page", "cover", "toc" and "options".
+	Kind  string
+	Table *lua.LTable
+	// app is used to validate the component when it is modified.
+	app *App
+}
+
+// componentTypes are the struct types that the components are mapped to by the kinds.
+var componentTypes = map[string]reflect.Type{
+	"page":    reflect.TypeOf(Page{}),
+	"cover":   reflect.TypeOf(Cover{}),
+	"toc":     reflect.TypeOf(TOC{}),
+	"options": reflect.TypeOf(GlobalOptions{}),
+}
+
+// componentKinds are the kinds of the components that can be set to the keys of a pdf config.
+var componentKinds = map[string]string{
+	"pages":   "page",
+	"cover":   "cover",
+	"toc":     "toc",
+	"options": "options",
+}
+
+// fnComponent returns a function that makes a component of the kind.
+func (app *App) fnComponent(kind string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		tb := L.OptTable(1, L.NewTable())
+
+		c := &Component{Kind: kind, Table: copyLValue(L, tb).(*lua.LTable), app: app}
+		if err := app.validateComponent(c); err != nil {
+			L.RaiseError("%v", err)
+		}
+
+		L.Push(newLComponent(L, c))
+
+		return 1
+	}
+}
+
+// validateComponent checks the keys and the values of the component.
+// The required keys like 'input' of a page are not checked, because a component can be completed later by the with method.
+func (app *App) validateComponent(c *Component) error {
+	tp := NewTargetPdf("", app)
+	typ := componentTypes[c.Kind]
+
+	if c.Table.MaxN() != 0 {
+		return tp.configError(c.Kind, fmt.Errorf("%s can't support array table", c.Kind))
+	}
+	if c.Kind == "cover" || c.Kind == "toc" {
+		if err := tp.checkNoHeaderAndFooter(c.Kind, c.Table); err != nil {
+			return err
+		}
+	}
+
+	errs := ConfigErrors{}
+	if app.Strict {
+		errs = append(errs, tp.checkTableKeys(c.Kind, c.Table, typ)...)
+	}
+	if len(errs) == 0 {
+		errs = append(errs, tp.checkTableValues(c.Kind, c.Table, typ)...)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+
+	return errs
+}
+
+// checkTableValues parses the values of the table by the schema tags of the struct type, like the values are parsed when the pdf is built.
+// The values that are not strings or numbers are left to checkTableKeys.
+func (tp *TargetPdf) checkTableValues(path string, tb *lua.LTable, typ reflect.Type) ConfigErrors {
+	errs := ConfigErrors{}
+
+	fields := configFields(typ)
+	keys := []string{}
+	tb.ForEach(func(k, v lua.LValue) {
+		if key, ok := toString(k); ok {
+			keys = append(keys, key)
+		}
+	})
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f, ok := fields[key]
+		if !ok {
+			continue
+		}
+		keyPath := path + "." + key
+		lv := tb.RawGetString(key)
+
+		switch f.Type.Kind() {
+		case reflect.Map:
+			if _, err := toStringMap(lv); err != nil {
+				errs = append(errs, tp.configError(keyPath, err))
+			}
+			continue
+		case reflect.Ptr:
+			if sub, ok := lv.(*lua.LTable); ok && sub.MaxN() == 0 {
+				errs = append(errs, tp.checkTableValues(keyPath, sub, f.Type.Elem())...)
+			}
+			continue
+		}
+		if f.Type.Kind() != reflect.String {
+			continue
+		}
+
+		var str string
+		switch v := lv.(type) {
+		case lua.LString:
+			str = string(v)
+		case lua.LNumber:
+			str = v.String()
+		default:
+			continue
+		}
+
+		if err := checkTaggedValue(f.Tag.Get("schema"), str); err != nil {
+			errs = append(errs, tp.configError(keyPath, err))
+		}
+	}
+
+	return errs
+}
+
+// checkTaggedValue parses the string by the kind in the schema tag like "uint,default=1".
+func checkTaggedValue(tag string, str string) error {
+	var err error
+
+	for _, part := range strings.Split(tag, ",") {
+		switch {
+		case strings.HasPrefix(part, "default="):
+		case strings.HasPrefix(part, "enum="):
+			enum := strings.Split(strings.TrimPrefix(part, "enum="), "|")
+			if !contains(enum, str) {
+				err = fmt.Errorf("'%s' (%s expected)", str, joinOr(stringsToInterfaces(enum)))
+			}
+		case part == "uint":
+			_, err = parseUint(str)
+		case part == "float":
+			_, err = parseFloat(str)
+		case part == "positive_float":
+			if v, e := parseFloat(str); e != nil || v <= 0 {
+				err = fmt.Errorf("'%s' (positive float expected)", str)
+			}
+		case part == "length":
+			_, err = parseLength(str)
+		case part == "indentation":
+			_, err = parseIndentation(str)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func stringsToInterfaces(strs []string) []interface{} {
+	ret := make([]interface{}, 0, len(strs))
+	for _, s := range strs {
+		ret = append(ret, s)
+	}
+
+	return ret
+}
+
+// expandComponents replaces the components in the value of the key of a pdf config with the copies of their tables.
+// The tables are copied, so modifying a component later doesn't affect the pdf configs that already use it.
+// The returned ConfigError doesn't have the target, because the value may be the defaults.
+func expandComponents(L *lua.LState, key string, lv lua.LValue) (lua.LValue, *ConfigError) {
+	kind := componentKinds[key]
+
+	expand := func(path string, lv lua.LValue) (lua.LValue, bool, *ConfigError) {
+		c, ok := toComponent(lv)
+		if !ok {
+			return lv, false, nil
+		}
+		if kind == "" {
+			return nil, false, &ConfigError{Path: path, Err: fmt.Errorf("html2pdf.%s can't be set", c.Kind)}
+		}
+		if c.Kind != kind {
+			return nil, false, &ConfigError{Path: path, Err: fmt.Errorf("html2pdf.%s expected, but got html2pdf.%s", kind, c.Kind)}
+		}
+
+		return copyLValue(L, c.Table), true, nil
+	}
+
+	ret, _, err := expand(key, lv)
+	if err != nil {
+		return nil, err
+	}
+
+	// pages can be an array of the page components.
+	tb, ok := ret.(*lua.LTable)
+	if !ok || key != "pages" || tb.MaxN() == 0 {
+		return ret, nil
+	}
+
+	var pages *lua.LTable
+	for i := 1; i <= tb.MaxN(); i++ {
+		v, expanded, err := expand(fmt.Sprintf("pages[%d]", i), tb.RawGetInt(i))
+		if err != nil {
+			return nil, err
+		}
+		if expanded && pages == nil {
+			pages = copyLValue(L, tb).(*lua.LTable)
+		}
+		if expanded {
+			pages.RawSetInt(i, v)
+		}
+	}
+	if pages != nil {
+		return pages, nil
+	}
+
+	return ret, nil
+}
+
+func toComponent(lv lua.LValue) (*Component, bool) {
+	ud, ok := lv.(*lua.LUserData)
+	if !ok {
+		return nil, false
+	}
+	c, ok := ud.Value.(*Component)
+
+	return c, ok
+}
+
+// Lua Component Class
+const lComponentClass = "Component*"
+
+func loadLComponentClass(L *lua.LState) {
+	mt := L.NewTypeMetatable(lComponentClass)
+
+	L.SetField(mt, "__index", L.NewFunction(componentIndex))
+	L.SetField(mt, "__newindex", L.NewFunction(componentNewindex))
+	L.SetField(mt, "__tostring", L.NewFunction(componentTostring))
+}
+
+func newLComponent(L *lua.LState, c *Component) *lua.LUserData {
+	ud := L.NewUserData()
+	ud.Value = c
+	L.SetMetatable(ud, L.GetTypeMetatable(lComponentClass))
+
+	return ud
+}
+
+func checkComponent(L *lua.LState) *Component {
+	ud := L.CheckUserData(1)
+	if c, ok := ud.Value.(*Component); ok {
+		return c
+	}
+	L.ArgError(1, "Component expected")
+
+	return nil
+}
+
+func componentIndex(L *lua.LState) int {
+	c := checkComponent(L)
+	index := L.CheckString(2)
+
+	switch index {
+	case "clone":
+		L.Push(L.NewFunction(componentClone))
+	case "with":
+		L.Push(L.NewFunction(componentWith))
+	case "kind":
+		L.Push(lua.LString(c.Kind))
+	default:
+		L.Push(copyLValue(L, c.Table.RawGetString(index)))
+	}
+
+	return 1
+}
+
+// componentNewindex sets the value after validating the component with it.
+func componentNewindex(L *lua.LState) int {
+	c := checkComponent(L)
+	index := L.CheckString(2)
+	value := L.Get(3)
+
+	tb := copyLValue(L, c.Table).(*lua.LTable)
+	tb.RawSetString(index, copyLValue(L, value))
+	if err := c.app.validateComponent(&Component{Kind: c.Kind, Table: tb}); err != nil {
+		L.RaiseError("%v", err)
+	}
+	c.Table = tb
+
+	return 0
+}
+
+// componentClone returns a copy of the component.
+//
+//	local b = a:clone()
+func componentClone(L *lua.LState) int {
+	c := checkComponent(L)
+
+	L.Push(newLComponent(L, &Component{Kind: c.Kind, Table: copyLValue(L, c.Table).(*lua.LTable), app: c.app}))
+
+	return 1
+}
+
+// componentWith returns a copy of the component that the table is deep-merged over.
+//
+//	local b = a:with { input = "b.html" }
+func componentWith(L *lua.LState) int {
+	c := checkComponent(L)
+	tb := L.CheckTable(2)
+
+	ret := &Component{Kind: c.Kind, Table: mergeLValues(L, c.Table, tb).(*lua.LTable), app: c.app}
+	if err := c.app.validateComponent(ret); err != nil {
+		L.RaiseError("%v", err)
+	}
+
+	L.Push(newLComponent(L, ret))
+
+	return 1
+}
+
+func componentTostring(L *lua.LState) int {
+	c := checkComponent(L)
+	L.Push(lua.LString("html2pdf." + c.Kind))
+
+	return 1
+}
@@ -0,0 +1,159 @@
+package html2pdf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComponents(t *testing.T) {
+	app := newTestApp(t)
+	defer closeTestApp(app)
+
+	err := app.LoadRecipe(`
+local html2pdf = require "html2pdf"
+
+local a4 = html2pdf.options { page_size = "A4", margin_top = "10mm" }
+local page = html2pdf.page { zoom = 2, footer = { center = "[page]" } }
+local cover = html2pdf.cover { input = "cover.html" }
+
+pdf "a.pdf" {
+    options = a4,
+    cover = cover,
+    pages = { page:with { input = "a1.html" }, { input = "a2.html" } },
+}
+
+-- modifying the components doesn't affect a.pdf.
+a4.page_size = "A5"
+local landscape = a4:clone()
+landscape.orientation = "Landscape"
+
+pdf "b.pdf" {
+    options = landscape,
+    pages = page:with { input = "b.html", footer = { right = "b" } },
+    toc = html2pdf.toc { toc_header_text = "Index" },
+}
+
+assert(a4.orientation == nil)
+assert(page.zoom == 2)
+assert(tostring(page) == "html2pdf.page")
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := argsOf(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# a.pdf
+--margin-top
+10mm
+--page-size
+A4
+cover
+cover.html
+page
+a1.html
+--zoom
+2
+--footer-center
+[page]
+page
+a2.html
+-
+# b.pdf
+--margin-top
+10mm
+--orientation
+Landscape
+--page-size
+A5
+toc
+--toc-header-text
+Index
+page
+b.html
+--zoom
+2
+--footer-center
+[page]
+--footer-right
+b
+-
+`
+	if actual != expected {
+		t.Errorf("args mismatch\n--- expected\n%s\n--- actual\n%s", expected, actual)
+	}
+}
+
+func TestComponentErrors(t *testing.T) {
+	cases := []struct {
+		script string
+		err    string
+	}{
+		{
+			script: `html2pdf.page { zoom = "x" }`,
+			err:    "<string>:2: invalid page.zoom: 'x' (positive float expected)",
+		},
+		{
+			script: `html2pdf.options { margin_top = "10km" }`,
+			err:    "invalid options.margin_top:",
+		},
+		{
+			script: `html2pdf.page { input = "a.html", header = { font_size = "big" } }`,
+			err:    "invalid page.header.font_size: 'big' (uint expected)",
+		},
+		{
+			script: `html2pdf.page { input = "a.html", load_error_handling = "stop" }`,
+			err:    "invalid page.load_error_handling: 'stop' (abort, ignore or skip expected)",
+		},
+		{
+			script: `html2pdf.toc { toc_text_size_shrink = "small" }`,
+			err:    "invalid toc.toc_text_size_shrink: 'small' (float expected)",
+		},
+		{
+			script: `html2pdf.cover { input = "a.html", header = { center = "x" } }`,
+			err:    "invalid cover.header: cover can't have header",
+		},
+		{
+			script: `html2pdf.options { page_sise = "A4" }`,
+			err:    "invalid options.page_sise: unknown key (did you mean 'page_size'?)",
+		},
+		{
+			script: `local p = html2pdf.page { input = "a.html" }
+p.page_offset = -1`,
+			err: "<string>:3: invalid page.page_offset: '-1' (uint expected)",
+		},
+		{
+			script: `html2pdf.page { input = "a.html" }:with { zoom = 0 }`,
+			err:    "invalid page.zoom: '0' (positive float expected)",
+		},
+		{
+			script: `pdf "a.pdf" { cover = html2pdf.page { input = "a.html" } }`,
+			err:    "'a.pdf' invalid cover: html2pdf.cover expected, but got html2pdf.page",
+		},
+		{
+			script: `pdf "a.pdf" { pages = { { input = "a.html" }, html2pdf.toc {} } }`,
+			err:    "'a.pdf' invalid pages[2]: html2pdf.page expected, but got html2pdf.toc",
+		},
+		{
+			script: `pdf "a.pdf" { header = html2pdf.options {} }`,
+			err:    "'a.pdf' invalid header: html2pdf.options can't be set",
+		},
+	}
+
+	for _, c := range cases {
+		app := newTestApp(t)
+
+		err := app.LoadRecipe(`local html2pdf = require "html2pdf"
+` + c.script)
+		closeTestApp(app)
+
+		if err == nil {
+			t.Errorf("%s: expected error", c.script)
+		} else if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error contains %q, but got %q", c.script, c.err, err.Error())
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package html2pdf
+
+import (
+	"fmt"
+	"github.com/yuin/gopher-lua"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// ConvertConfig is a pdf config of the convert command.
+// It is translated to the same values as the pdf function of the DSL, so it behaves the same as a script.
+type ConvertConfig struct {
+	// Inputs are the files or urls of the pages. "-" reads html from Stdin.
+	Inputs []string
+	// Output is the pdf file. "-" writes the pdf to App.Stdout.
+	Output string
+	// Cover is the file or url of the cover. "-" reads html from Stdin.
+	Cover string
+	// TOC adds a table of contents.
+	TOC bool
+	// Options, PageOptions and TOCOptions are "key=value" pairs that are the same as the keys of the DSL.
+	// A key can have dots to set a nested value like "header.center=[page]".
+	// A key that is specified multiple times becomes a list like "allow=/a" and "allow=/b".
+	Options     []string
+	PageOptions []string
+	TOCOptions  []string
+	// Stdin is used to read html of "-" input.
+	Stdin io.Reader
+}
+
+// LoadConvertConfig registers a pdf config that is built from the ConvertConfig.
+// It is translated to a Document, so it is loaded by LoadDocument like the Converter and the server.
+func (app *App) LoadConvertConfig(c *ConvertConfig) (*TargetPdf, error) {
+	if len(c.Inputs) == 0 {
+		return nil, fmt.Errorf("no input files")
+	}
+
+	stdinCount := 0
+	for _, in := range append(c.Inputs, c.Cover) {
+		if in == "-" {
+			stdinCount++
+		}
+	}
+	if stdinCount > 1 {
+		return nil, fmt.Errorf("stdin '-' can be used only once")
+	}
+
+	var stdin string
+	if stdinCount == 1 {
+		if c.Stdin == nil {
+			return nil, fmt.Errorf("stdin '-' is not available")
+		}
+		b, err := ioutil.ReadAll(c.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		stdin = string(b)
+	}
+
+	output := c.Output
+	if output == "" {
+		output = "-"
+	}
+
+	name := output
+	if name == "-" {
+		name = "stdout"
+	}
+
+	doc := &Document{Name: name}
+
+	options, err := keyValuesMap(c.Options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid option: %v", err)
+	}
+	doc.Options = options
+
+	for _, in := range c.Inputs {
+		page, err := keyValuesMap(c.PageOptions)
+		if err != nil {
+			return nil, fmt.Errorf("invalid page option: %v", err)
+		}
+		setInput(page, in, stdin)
+		doc.Pages = append(doc.Pages, page)
+	}
+
+	if c.Cover != "" {
+		doc.Cover = map[string]interface{}{}
+		setInput(doc.Cover, c.Cover, stdin)
+	}
+
+	if c.TOC || len(c.TOCOptions) > 0 {
+		toc, err := keyValuesMap(c.TOCOptions)
+		if err != nil {
+			return nil, fmt.Errorf("invalid toc option: %v", err)
+		}
+		doc.TOC = toc
+	}
+
+	tp, err := app.LoadDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	tp.LValues["output_file"] = lua.LString(output)
+
+	return tp, nil
+}
+
+func setInput(m map[string]interface{}, input string, stdin string) {
+	if input == "-" {
+		m["input_content"] = stdin
+	} else {
+		m["input"] = input
+	}
+}
+
+// keyValuesMap builds a map of the document from "key=value" pairs.
+func keyValuesMap(kvs []string) (map[string]interface{}, error) {
+	ret := map[string]interface{}{}
+
+	for _, kv := range kvs {
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("'%s' must be key=value", kv)
+		}
+		keys := strings.Split(kv[:i], ".")
+		value := kv[i+1:]
+
+		parent := ret
+		for _, k := range keys[:len(keys)-1] {
+			child, ok := parent[k].(map[string]interface{})
+			if !ok {
+				if parent[k] != nil {
+					return nil, fmt.Errorf("'%s' conflicts with '%s'", kv, k)
+				}
+				child = map[string]interface{}{}
+				parent[k] = child
+			}
+			parent = child
+		}
+
+		key := keys[len(keys)-1]
+		switch prev := parent[key].(type) {
+		case nil:
+			parent[key] = value
+		case string:
+			parent[key] = []interface{}{prev, value}
+		case []interface{}:
+			parent[key] = append(prev, value)
+		case map[string]interface{}:
+			return nil, fmt.Errorf("'%s' conflicts with '%s.*'", kv, kv[:i])
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,103 @@
+package html2pdf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadConvertConfig(t *testing.T) {
+	app := newTestApp(t)
+	defer closeTestApp(app)
+
+	_, err := app.LoadConvertConfig(&ConvertConfig{
+		Inputs:      []string{"a.html", "-"},
+		Output:      "out.pdf",
+		Cover:       "cover.html",
+		TOC:         true,
+		Options:     []string{"page_size=A4", "margin_top=10mm", "title=a=b"},
+		PageOptions: []string{"header.center=[page]", "allow=/a", "allow=/b", "cookies.session=abc"},
+		Stdin:       strings.NewReader("<h1>stdin</h1>"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := argsOf(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# out.pdf
+--margin-top
+10mm
+--page-size
+A4
+--title
+a=b
+cover
+cover.html
+toc
+page
+a.html
+--allow
+/a
+--allow
+/b
+--cookie
+session
+abc
+--header-center
+[page]
+page
+<tmpfile0.html>
+--allow
+/a
+--allow
+/b
+--cookie
+session
+abc
+--header-center
+[page]
+-
+`
+	if actual != expected {
+		t.Errorf("args mismatch\n--- expected\n%s\n--- actual\n%s", expected, actual)
+	}
+}
+
+func TestLoadConvertConfigErrors(t *testing.T) {
+	cases := []struct {
+		config *ConvertConfig
+		err    string
+	}{
+		{
+			config: &ConvertConfig{},
+			err:    "no input files",
+		},
+		{
+			config: &ConvertConfig{Inputs: []string{"-"}, Cover: "-", Stdin: strings.NewReader("")},
+			err:    "can be used only once",
+		},
+		{
+			config: &ConvertConfig{Inputs: []string{"a.html"}, Options: []string{"page_size"}},
+			err:    "must be key=value",
+		},
+		{
+			config: &ConvertConfig{Inputs: []string{"a.html"}, PageOptions: []string{"header=x", "header.center=y"}},
+			err:    "conflicts with",
+		},
+	}
+
+	for _, c := range cases {
+		app := newTestApp(t)
+		_, err := app.LoadConvertConfig(c.config)
+		closeTestApp(app)
+
+		if err == nil {
+			t.Errorf("%+v: expected error", c.config)
+		} else if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%+v: expected error contains %q, but got %q", c.config, c.err, err.Error())
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package html2pdf
+
+import (
+	"context"
+	"fmt"
+	"github.com/kohkimakimoto/html2pdf/support/color"
+	"github.com/yuin/gopher-lua"
+	"io"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// Converter is the API to use html2pdf as a Go library.
+// Unlike the command, it never changes the process global logging and writes the pdfs to io.Writer.
+// Each conversion is run by a fresh App, so a Converter can be used concurrently.
+//
+//	c := html2pdf.NewConverter()
+//	err := c.Convert(ctx, w, &html2pdf.Document{
+//	    Options: map[string]interface{}{"page_size": "A4"},
+//	    Pages: []map[string]interface{}{
+//	        {"input": "https://example.com"},
+//	    },
+//	})
+type Converter struct {
+	// Logger receives the logs. The logs are discarded if it is nil.
+	Logger *log.Logger
+	// Cachedir is the directory that has the bundled wkhtmltopdf and the temporary files.
+	// The default is DefaultCachedir(). The environment variables of the command are not read.
+	Cachedir string
+	// WkhtmltopdfCmd is the wkhtmltopdf command to use instead of the bundled one.
+	// It is probed once to check the options are supported.
+	WkhtmltopdfCmd string
+	// Renderer renders the pdfs instead of wkhtmltopdf if it is not nil, like FakeRenderer in tests.
+	Renderer Renderer
+}
+
+// Document is a pdf config that is built by Go.
+// The fields are the same as the keys of the pdf function of the DSL, like "options" and "pages".
+type Document struct {
+	// Name is used in the logs and the errors.
+	Name    string
+	Options map[string]interface{}
+	Pages   []map[string]interface{}
+	Cover   map[string]interface{}
+	// TOC adds a table of contents if it is not nil. An empty map adds it with the default options.
+	TOC    map[string]interface{}
+	Header map[string]interface{}
+	Footer map[string]interface{}
+}
+
+// Script is a lua script that defines pdf configs.
+type Script struct {
+	// Source is the lua code.
+	Source string
+	// Filename is used in the errors. The relative paths in the script are resolved from the current directory.
+	Filename string
+	// Vars are the variables of the script like -var option.
+	Vars map[string]interface{}
+	// Target is the name of the pdf config to convert. It is required if the script defines multiple ones.
+	Target string
+}
+
+// ScriptError is an error that occurred in evaluating a lua script.
+type ScriptError struct {
+	Filename string
+	Err      error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Filename, e.Err)
+}
+
+func NewConverter() *Converter {
+	return &Converter{}
+}
+
+// Convert converts the document to a pdf and writes it to w.
+// It returns ctx.Err() if the ctx is done, and a TargetPdfError if the document is invalid or wkhtmltopdf fails.
+func (c *Converter) Convert(ctx context.Context, w io.Writer, doc *Document) error {
+	app := c.newApp(ctx)
+	defer app.Close()
+
+	tp, err := app.LoadDocument(doc)
+	if err != nil {
+		return err
+	}
+
+	return c.render(ctx, app, tp, w)
+}
+
+// ConvertScript evaluates the script and writes the pdf of the target to w.
+// It returns a ScriptError if the script fails in addition to the errors of Convert.
+func (c *Converter) ConvertScript(ctx context.Context, w io.Writer, script *Script) error {
+	app := c.newApp(ctx)
+	defer app.Close()
+
+	tp, err := app.LoadScript(script)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	return c.render(ctx, app, tp, w)
+}
+
+func (c *Converter) newApp(ctx context.Context) *App {
+	app := NewApp()
+
+	app.Logger = c.Logger
+	if app.Logger == nil {
+		app.Logger = log.New(ioutil.Discard, "", 0)
+	}
+	if c.Cachedir != "" {
+		app.SetCachedir(c.Cachedir)
+	}
+	if c.WkhtmltopdfCmd != "" {
+		app.WkhtmltopdfCmd = c.WkhtmltopdfCmd
+	}
+	app.Renderer = c.Renderer
+
+	app.openLibs()
+	app.LState.SetContext(ctx)
+
+	return app
+}
+
+func (c *Converter) render(ctx context.Context, app *App, tp *TargetPdf, w io.Writer) error {
+	if err := app.prepareCachedirs(); err != nil {
+		return err
+	}
+
+	if err := app.prepareWkhtmltopdf(); err != nil {
+		return err
+	}
+
+	return app.renderTargetPdf(ctx, tp, w)
+}
+
+// renderTargetPdf renders the pdf config to w.
+// It returns a TargetPdfError instead of panicking, and ctx.Err() as it is.
+func (app *App) renderTargetPdf(ctx context.Context, tp *TargetPdf, w io.Writer) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+		if err != nil && err != ctx.Err() {
+			err = &TargetPdfError{Name: tp.Name, Err: err}
+			tp.logf(color.FgRB("    Failed: %v", err))
+		}
+	}()
+
+	tp.logf(color.FgBold(fmt.Sprintf("==> Processing: %s", tp.Name)))
+
+	doc, err := tp.Resolve()
+	if err != nil {
+		return err
+	}
+	if app.Sandbox {
+		if err := checkLocalAccess(doc); err != nil {
+			return err
+		}
+	}
+
+	return tp.render(ctx, doc, w)
+}
+
+// LoadDocument registers a pdf config that is built from the document.
+func (app *App) LoadDocument(doc *Document) (*TargetPdf, error) {
+	name := doc.Name
+	if name == "" {
+		name = "document"
+	}
+
+	tp := NewTargetPdf(name, app)
+	L := app.LState
+
+	fields := []struct {
+		key   string
+		value interface{}
+	}{
+		{"options", doc.Options},
+		{"pages", doc.Pages},
+		{"cover", doc.Cover},
+		{"toc", doc.TOC},
+		{"header", doc.Header},
+		{"footer", doc.Footer},
+	}
+	for _, f := range fields {
+		if reflect.ValueOf(f.value).IsNil() {
+			continue
+		}
+
+		lv, err := goToLValue(L, reflect.ValueOf(f.value))
+		if err != nil {
+			return nil, &TargetPdfError{Name: name, Err: tp.configError(f.key, err)}
+		}
+		tp.LValues[f.key] = lv
+	}
+
+	app.RegisterTargetPdf(tp)
+
+	return tp, nil
+}
+
+// LoadScript evaluates the script and returns the pdf config of the target.
+func (app *App) LoadScript(script *Script) (*TargetPdf, error) {
+	filename := script.Filename
+	if filename == "" {
+		filename = "<string>"
+	}
+
+	L := app.LState
+
+	if script.Vars != nil {
+		for k, v := range script.Vars {
+			app.variable[k] = v
+		}
+		lv, err := goToLValue(L, reflect.ValueOf(app.variable))
+		if err != nil {
+			return nil, fmt.Errorf("invalid vars: %v", err)
+		}
+		L.SetGlobal("var", lv)
+	}
+
+	fn, err := L.Load(strings.NewReader(script.Source), filename)
+	if err != nil {
+		return nil, &ScriptError{Filename: filename, Err: err}
+	}
+	var exceeded func() bool
+	if app.Sandbox && app.MaxScriptMemory > 0 {
+		exceeded = app.limitMemory()
+	}
+	L.Push(fn)
+	err = L.PCall(0, lua.MultRet, nil)
+	if exceeded != nil && exceeded() {
+		return nil, &ScriptError{Filename: filename, Err: fmt.Errorf("the script exceeded the memory limit of %d bytes", app.MaxScriptMemory)}
+	}
+	if err != nil {
+		return nil, &ScriptError{Filename: filename, Err: err}
+	}
+
+	if script.Target != "" {
+		app.Targets = []string{script.Target}
+	}
+	targetpdfs, err := app.SelectedTargetPdfs()
+	if err != nil {
+		return nil, err
+	}
+	if len(targetpdfs) != 1 {
+		return nil, fmt.Errorf("the script defines %d pdf configs. select one by the target", len(targetpdfs))
+	}
+
+	return targetpdfs[0], nil
+}
+
+// goToLValue converts a Go value to a lua value. Unlike toLValue, it supports any slices and maps that have string keys.
+func goToLValue(L *lua.LState, v reflect.Value) (lua.LValue, error) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return lua.LNil, nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return lua.LBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return lua.LNumber(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return lua.LNumber(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return lua.LNumber(v.Float()), nil
+	case reflect.String:
+		return lua.LString(v.String()), nil
+	case reflect.Slice, reflect.Array:
+		tb := L.CreateTable(v.Len(), 0)
+		for i := 0; i < v.Len(); i++ {
+			lv, err := goToLValue(L, v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			tb.Append(lv)
+		}
+		return tb, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("a key of map must be string")
+		}
+		tb := L.CreateTable(0, v.Len())
+		for _, k := range v.MapKeys() {
+			lv, err := goToLValue(L, v.MapIndex(k))
+			if err != nil {
+				return nil, err
+			}
+			tb.RawSetString(k.String(), lv)
+		}
+		return tb, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+}
@@ -0,0 +1,107 @@
+package html2pdf
+
+import (
+	"bytes"
+	"context"
+	"github.com/kohkimakimoto/html2pdf/support/testutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConverterConvert(t *testing.T) {
+	tmpdir, wk := testutil.NewFakeWkhtmltopdf(t)
+	defer os.RemoveAll(tmpdir)
+
+	// the converter must not write to the standard logger.
+	stdlog := new(bytes.Buffer)
+	log.SetOutput(stdlog)
+	defer log.SetOutput(os.Stderr)
+
+	logs := new(bytes.Buffer)
+	c := NewConverter()
+	c.Cachedir = tmpdir
+	c.WkhtmltopdfCmd = wk
+	c.Logger = log.New(logs, "", 0)
+
+	buf := new(bytes.Buffer)
+	err := c.Convert(context.Background(), buf, &Document{
+		Name:    "report",
+		Options: map[string]interface{}{"page_size": "A4", "dpi": 300},
+		Pages: []map[string]interface{}{
+			{"input": "a.html", "allow": []string{"/a", "/b"}},
+			{"input_content": "<h1>b</h1>"},
+		},
+		TOC: map[string]interface{}{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "%PDF --dpi 300 --page-size A4 toc page a.html --allow /a --allow /b page ") {
+		t.Errorf("unexpected pdf: %s", buf.String())
+	}
+	if !strings.Contains(logs.String(), "Processing: report") {
+		t.Errorf("unexpected logs: %s", logs.String())
+	}
+	if stdlog.Len() != 0 {
+		t.Errorf("the standard logger is used: %s", stdlog.String())
+	}
+
+	buf.Reset()
+	err = c.ConvertScript(context.Background(), buf, &Script{
+		Source: `pdf "a.pdf" { options = { title = var.title }, pages = { input = "a.html" } }`,
+		Vars:   map[string]interface{}{"title": "report"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "%PDF --title report page a.html") {
+		t.Errorf("unexpected pdf: %s", buf.String())
+	}
+}
+
+func TestConverterErrors(t *testing.T) {
+	tmpdir, wk := testutil.NewFakeWkhtmltopdf(t)
+	defer os.RemoveAll(tmpdir)
+
+	c := NewConverter()
+	c.Cachedir = tmpdir
+	c.WkhtmltopdfCmd = wk
+
+	err := c.ConvertScript(context.Background(), new(bytes.Buffer), &Script{Source: `error("boom")`, Filename: "build.lua"})
+	if e, ok := err.(*ScriptError); !ok || e.Filename != "build.lua" {
+		t.Errorf("expected ScriptError, but got %#v", err)
+	}
+
+	err = c.Convert(context.Background(), new(bytes.Buffer), &Document{
+		Pages: []map[string]interface{}{{"input": "fail.html"}},
+	})
+	if e, ok := err.(*TargetPdfError); !ok {
+		t.Errorf("expected TargetPdfError, but got %#v", err)
+	} else if we, ok := e.Err.(*WkhtmltopdfError); !ok || we.Stderr != "failed to load" {
+		t.Errorf("expected WkhtmltopdfError, but got %#v", e.Err)
+	}
+
+	err = c.Convert(context.Background(), new(bytes.Buffer), &Document{
+		Pages: []map[string]interface{}{{}},
+	})
+	if _, ok := err.(*TargetPdfError); !ok {
+		t.Errorf("expected TargetPdfError, but got %#v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = c.Convert(ctx, new(bytes.Buffer), &Document{
+		Pages: []map[string]interface{}{{"input": "sleep.html"}},
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, but got %#v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("wkhtmltopdf is not killed")
+	}
+}
@@ -0,0 +1,144 @@
+package html2pdf
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CookieJar is a http.CookieJar that is shared by the http lua module and wkhtmltopdf.
+// It keeps the cookies with their domains and paths to write them to a wkhtmltopdf cookie jar file.
+type CookieJar struct {
+	jar     *cookiejar.Jar
+	mutex   sync.Mutex
+	cookies map[string]*http.Cookie
+	keys    []string
+}
+
+func NewCookieJar() *CookieJar {
+	// cookiejar.New returns no error when it is called with nil options.
+	jar, _ := cookiejar.New(nil)
+
+	return &CookieJar{
+		jar:     jar,
+		cookies: map[string]*http.Cookie{},
+		keys:    []string{},
+	}
+}
+
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for _, c := range cookies {
+		j.set(normalizeCookie(u, c))
+	}
+}
+
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// Len returns the number of the cookies in the jar.
+func (j *CookieJar) Len() int {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return len(j.keys)
+}
+
+// WriteFile writes the cookies to the wkhtmltopdf cookie jar file.
+// The cookies that already exist in the file are kept unless the jar has the same ones.
+func (j *CookieJar) WriteFile(filename string) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	merged := &CookieJar{
+		cookies: map[string]*http.Cookie{},
+		keys:    []string{},
+	}
+
+	if b, err := ioutil.ReadFile(filename); err == nil {
+		for _, c := range readCookieJarFile(b) {
+			merged.set(c)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, k := range j.keys {
+		merged.set(j.cookies[k])
+	}
+
+	buf := new(bytes.Buffer)
+	for _, k := range merged.keys {
+		buf.WriteString(merged.cookies[k].String())
+		buf.WriteString("\n")
+	}
+
+	return ioutil.WriteFile(filename, buf.Bytes(), 0600)
+}
+
+func (j *CookieJar) set(c *http.Cookie) {
+	key := c.Domain + ";" + c.Path + ";" + c.Name
+
+	if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(time.Now())) {
+		// deleted cookie
+		if _, ok := j.cookies[key]; ok {
+			delete(j.cookies, key)
+			for i, k := range j.keys {
+				if k == key {
+					j.keys = append(j.keys[:i], j.keys[i+1:]...)
+					break
+				}
+			}
+		}
+		return
+	}
+
+	if _, ok := j.cookies[key]; !ok {
+		j.keys = append(j.keys, key)
+	}
+	j.cookies[key] = c
+}
+
+// normalizeCookie sets the domain and the path that the cookie is available in,
+// because wkhtmltopdf can't know the url that the cookie came from.
+func normalizeCookie(u *url.URL, c *http.Cookie) *http.Cookie {
+	nc := *c
+	if nc.Domain == "" {
+		nc.Domain = u.Hostname()
+	}
+	if nc.Path == "" || nc.Path[0] != '/' {
+		nc.Path = "/"
+		if i := strings.LastIndex(u.Path, "/"); i > 0 {
+			nc.Path = u.Path[:i]
+		}
+	}
+
+	return &nc
+}
+
+// readCookieJarFile reads the cookies from the content of wkhtmltopdf cookie jar file.
+// The file has a cookie per line in the Set-Cookie header format.
+func readCookieJarFile(b []byte) []*http.Cookie {
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	resp := &http.Response{Header: http.Header{"Set-Cookie": lines}}
+	return resp.Cookies()
+}
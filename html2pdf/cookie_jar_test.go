@@ -0,0 +1,56 @@
+package html2pdf
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCookieJarWriteFile(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc123", HttpOnly: true})
+		http.SetCookie(w, &http.Cookie{Name: "lang", Value: "en", Path: "/app"})
+	}))
+	defer ts.Close()
+
+	jar := NewCookieJar()
+	client := &http.Client{Jar: jar}
+	if _, err := client.PostForm(ts.URL+"/login", url.Values{"user": {"foo"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if jar.Len() != 2 {
+		t.Fatalf("expected 2 cookies, but got %d", jar.Len())
+	}
+
+	tmpdir, err := ioutil.TempDir("", "html2pdf_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	filename := filepath.Join(tmpdir, "cookies.txt")
+	if err := ioutil.WriteFile(filename, []byte("other=1; Path=/; Domain=example.com\nsession=old; Path=/; Domain=127.0.0.1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := jar.WriteFile(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "other=1; Path=/; Domain=example.com\n" +
+		"session=abc123; Path=/; Domain=127.0.0.1; HttpOnly\n" +
+		"lang=en; Path=/app; Domain=127.0.0.1\n"
+	if string(b) != expected {
+		t.Errorf("expected\n%s\nbut got\n%s", expected, b)
+	}
+}
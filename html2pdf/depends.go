@@ -0,0 +1,143 @@
+package html2pdf
+
+import (
+	"fmt"
+	"github.com/yuin/gopher-lua"
+	"strings"
+)
+
+// Dependencies returns the pdf configs that must be built before the pdf config by the 'depends_on' key.
+//
+//	pdf "handbook.pdf" {
+//	    depends_on = { "chapter1.pdf", "chapter2.pdf" },
+//	    pages = { input = "handbook.html" },
+//	}
+func (tp *TargetPdf) Dependencies() ([]*TargetPdf, error) {
+	ret := []*TargetPdf{}
+
+	type dependency struct {
+		path string
+		lv   lua.LValue
+	}
+	deps := []dependency{}
+
+	switch lv := tp.value("depends_on").(type) {
+	case *lua.LNilType:
+		return ret, nil
+	case lua.LString:
+		deps = append(deps, dependency{"depends_on", lv})
+	case *lua.LTable:
+		if k, _ := lv.Next(lua.LNil); lv.MaxN() == 0 && k != lua.LNil {
+			return nil, tp.configError("depends_on", fmt.Errorf("array of strings expected, but got table"))
+		}
+		for i := 1; i <= lv.MaxN(); i++ {
+			deps = append(deps, dependency{fmt.Sprintf("depends_on[%d]", i), lv.RawGetInt(i)})
+		}
+	default:
+		return nil, tp.configError("depends_on", fmt.Errorf("string or array of strings expected, but got %s", lv.Type()))
+	}
+
+	for _, dep := range deps {
+		name, ok := dep.lv.(lua.LString)
+		if !ok {
+			return nil, tp.configError(dep.path, fmt.Errorf("string expected, but got %s", dep.lv.Type()))
+		}
+
+		d := tp.App.targetPdf(string(name))
+		if d == nil {
+			return nil, tp.configError(dep.path, fmt.Errorf("pdf '%s' is not defined", name))
+		}
+		if !containsTargetPdf(ret, d) {
+			ret = append(ret, d)
+		}
+	}
+
+	return ret, nil
+}
+
+func dependsOnAny(tp *TargetPdf, targetpdfs []*TargetPdf) bool {
+	deps, err := tp.Dependencies()
+	if err != nil {
+		return false
+	}
+
+	for _, dep := range deps {
+		if containsTargetPdf(targetpdfs, dep) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (app *App) targetPdf(name string) *TargetPdf {
+	for _, tp := range app.Targetpdfs {
+		if tp.Name == name {
+			return tp
+		}
+	}
+
+	return nil
+}
+
+// TargetPdfsToBuild returns the selected pdf configs and their dependencies in the order to build.
+// The dependencies come before the pdf configs that depend on them.
+func (app *App) TargetPdfsToBuild() ([]*TargetPdf, error) {
+	targetpdfs, err := app.SelectedTargetPdfs()
+	if err != nil {
+		return nil, err
+	}
+
+	return buildOrder(targetpdfs, true)
+}
+
+// buildOrder sorts the pdf configs topologically by their dependencies, keeping the order of the registration as far as possible.
+// If withDependencies is true, the dependencies that are not in the pdf configs are added. Otherwise they are ignored.
+func buildOrder(targetpdfs []*TargetPdf, withDependencies bool) ([]*TargetPdf, error) {
+	ret := []*TargetPdf{}
+	visiting := []*TargetPdf{}
+
+	var visit func(tp *TargetPdf) error
+	visit = func(tp *TargetPdf) error {
+		if containsTargetPdf(ret, tp) {
+			return nil
+		}
+		for i, v := range visiting {
+			if v == tp {
+				names := []string{}
+				for _, c := range append(visiting[i:], tp) {
+					names = append(names, c.Name)
+				}
+				return visiting[i].configError("depends_on", fmt.Errorf("cyclic depends_on (%s)", strings.Join(names, " -> ")))
+			}
+		}
+
+		deps, err := tp.Dependencies()
+		if err != nil {
+			return err
+		}
+
+		visiting = append(visiting, tp)
+		for _, dep := range deps {
+			if !withDependencies && !containsTargetPdf(targetpdfs, dep) {
+				continue
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		visiting = visiting[:len(visiting)-1]
+
+		ret = append(ret, tp)
+
+		return nil
+	}
+
+	for _, tp := range targetpdfs {
+		if err := visit(tp); err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,167 @@
+package html2pdf
+
+import (
+	"bytes"
+	"github.com/kohkimakimoto/html2pdf/support/testutil"
+	"github.com/yuin/gopher-lua"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func namesOf(targetpdfs []*TargetPdf) string {
+	names := []string{}
+	for _, tp := range targetpdfs {
+		names = append(names, tp.Name)
+	}
+
+	return strings.Join(names, ",")
+}
+
+func TestTargetPdfsToBuild(t *testing.T) {
+	script := `
+pdf "handbook.pdf" { depends_on = { "chapter2.pdf", "chapter1.pdf" }, pages = { input = "handbook.html" } }
+pdf "chapter1.pdf" { depends_on = "common.pdf", pages = { input = "chapter1.html" } }
+pdf "chapter2.pdf" { depends_on = { "common.pdf" }, pages = { input = "chapter2.html" } }
+pdf "common.pdf" { pages = { input = "common.html" } }
+pdf "other.pdf" { pages = { input = "other.html" } }
+`
+	cases := []struct {
+		targets  []string
+		expected string
+	}{
+		{nil, "common.pdf,chapter2.pdf,chapter1.pdf,handbook.pdf,other.pdf"},
+		{[]string{"handbook.pdf"}, "common.pdf,chapter2.pdf,chapter1.pdf,handbook.pdf"},
+		{[]string{"chapter1.pdf"}, "common.pdf,chapter1.pdf"},
+		{[]string{"other.pdf", "chapter*"}, "common.pdf,chapter1.pdf,chapter2.pdf,other.pdf"},
+	}
+
+	for _, c := range cases {
+		app := newTestApp(t)
+		if err := app.LoadRecipe(script); err != nil {
+			t.Fatal(err)
+		}
+		app.Targets = c.targets
+
+		targetpdfs, err := app.TargetPdfsToBuild()
+		closeTestApp(app)
+		if err != nil {
+			t.Errorf("%v: %v", c.targets, err)
+		} else if actual := namesOf(targetpdfs); actual != c.expected {
+			t.Errorf("%v: expected %s, but got %s", c.targets, c.expected, actual)
+		}
+	}
+}
+
+func TestTargetPdfsToBuildErrors(t *testing.T) {
+	cases := []struct {
+		script string
+		err    string
+	}{
+		{
+			script: `pdf "a.pdf" { depends_on = "b.pdf" }
+pdf "b.pdf" { depends_on = { "c.pdf" } }
+pdf "c.pdf" { depends_on = { "a.pdf" } }`,
+			err: "<string>:1: 'a.pdf' invalid depends_on: cyclic depends_on (a.pdf -> b.pdf -> c.pdf -> a.pdf)",
+		},
+		{
+			script: `pdf "a.pdf" { depends_on = "a.pdf" }`,
+			err:    "'a.pdf' invalid depends_on: cyclic depends_on (a.pdf -> a.pdf)",
+		},
+		{
+			script: `pdf "a.pdf" { depends_on = { "b.pdf", "none.pdf" } } pdf "b.pdf" {}`,
+			err:    "'a.pdf' invalid depends_on[2]: pdf 'none.pdf' is not defined",
+		},
+		{
+			script: `pdf "a.pdf" { depends_on = { b = "b.pdf" } }`,
+			err:    "'a.pdf' invalid depends_on: array of strings expected, but got table",
+		},
+	}
+
+	for _, c := range cases {
+		app := newTestApp(t)
+		if err := app.LoadRecipe(c.script); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := app.TargetPdfsToBuild()
+		closeTestApp(app)
+		if err == nil {
+			t.Errorf("%s: expected error", c.script)
+		} else if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error contains %q, but got %q", c.script, c.err, err.Error())
+		}
+	}
+}
+
+func TestRunWithDependencies(t *testing.T) {
+	for _, jobs := range []int{1, 4} {
+		app := newTestApp(t)
+		app.WkhtmltopdfCmd = testutil.WriteFakeWkhtmltopdf(t, app.Cachedir)
+		app.Jobs = jobs
+		app.Stdout = ioutil.Discard
+
+		err := app.LoadRecipe(`
+local html2pdf = require "html2pdf"
+built = {}
+
+html2pdf.on("after_build", function(target)
+    table.insert(built, target.name)
+end)
+
+pdf "handbook.pdf" { depends_on = { "chapter1.pdf", "chapter2.pdf" }, pages = { input = "handbook.html" }, output_file = "-" }
+pdf "chapter1.pdf" { pages = { input = "chapter1.html" }, output_file = "-" }
+pdf "chapter2.pdf" { pages = { input = "fail.html" }, output_file = "-" }
+pdf "other.pdf" { pages = { input = "other.html" }, output_file = "-" }
+`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		app.Targets = []string{"handbook.pdf"}
+
+		err = app.Run()
+		if err == nil || !strings.Contains(err.Error(), "'handbook.pdf': skipped because 'chapter2.pdf' failed") {
+			t.Errorf("jobs %d: unexpected error %v", jobs, err)
+		}
+
+		built := []string{}
+		app.LState.GetGlobal("built").(*lua.LTable).ForEach(func(k, v lua.LValue) {
+			built = append(built, v.String())
+		})
+		if strings.Join(built, ",") != "chapter1.pdf" {
+			t.Errorf("jobs %d: expected only chapter1.pdf is built, but got %v", jobs, built)
+		}
+		closeTestApp(app)
+	}
+}
+
+func TestListDependencies(t *testing.T) {
+	app := newTestApp(t)
+	defer closeTestApp(app)
+
+	err := app.LoadRecipe(`
+pdf "handbook.pdf" { depends_on = { "chapter1.pdf" }, pages = { input = "handbook.html" } }
+pdf "chapter1.pdf" { pages = { input = "chapter1.html" } }
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Targets = []string{"handbook.pdf"}
+
+	buf := new(bytes.Buffer)
+	if err := app.List(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `chapter1.pdf
+    output_file: chapter1.pdf
+    page: chapter1.html
+handbook.pdf
+    output_file: handbook.pdf
+    depends_on: chapter1.pdf
+    page: handbook.html
+`
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\nbut got\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,119 @@
+package html2pdf
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Dimension is a length with a unit like "15mm", "0.5in" and "1em".
+type Dimension struct {
+	Value float64
+	Unit  string
+}
+
+// millimeters per unit. "em" is relative to the font size, so it can't be converted.
+var dimensionUnits = map[string]float64{
+	"mm": 1,
+	"cm": 10,
+	"in": 25.4,
+	"pt": 25.4 / 72,
+	"px": 25.4 / 96,
+	"em": 0,
+}
+
+var dimensionRe = regexp.MustCompile(`^([0-9]+(?:\.[0-9]*)?|\.[0-9]+)\s*([a-zA-Z]*)$`)
+
+// ParseDimension parses a string like "15mm". A number without a unit is treated as defaultUnit.
+func ParseDimension(str string, defaultUnit string) (Dimension, error) {
+	m := dimensionRe.FindStringSubmatch(strings.TrimSpace(str))
+	if m == nil {
+		return Dimension{}, fmt.Errorf("'%s' is not a dimension (a number with mm, cm, in, pt, px or em expected)", str)
+	}
+
+	v, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return Dimension{}, err
+	}
+
+	unit := strings.ToLower(m[2])
+	if unit == "" {
+		unit = defaultUnit
+	}
+	if _, ok := dimensionUnits[unit]; !ok {
+		return Dimension{}, fmt.Errorf("'%s' has an unknown unit '%s' (mm, cm, in, pt, px or em expected)", str, m[2])
+	}
+
+	return Dimension{Value: v, Unit: unit}, nil
+}
+
+// Millimeters returns the length in millimeters.
+func (d Dimension) Millimeters() (float64, error) {
+	if d.Unit == "em" {
+		return 0, fmt.Errorf("'%s' can't be converted to an absolute length", d)
+	}
+
+	return d.Value * dimensionUnits[d.Unit], nil
+}
+
+// String returns the normalized representation of the dimension.
+func (d Dimension) String() string {
+	return strconv.FormatFloat(d.Value, 'f', -1, 64) + d.Unit
+}
+
+// parseLength parses an absolute length option and returns it in millimeters that is the default unit of wkhtmltopdf.
+func parseLength(str string) (float64, error) {
+	d, err := ParseDimension(str, "mm")
+	if err != nil {
+		return 0, err
+	}
+
+	return d.Millimeters()
+}
+
+// lengthArg parses an absolute length option and returns it as a wkhtmltopdf arg in millimeters like "12.7mm".
+// wkhtmltopdf takes a length with a unit, so the fractional lengths are passed as they are.
+func lengthArg(str string) (string, error) {
+	mm, err := parseLength(str)
+	if err != nil {
+		return "", err
+	}
+
+	// hide the errors of the unit conversions like 25.400000000000002 of 72pt.
+	mm = math.Floor(mm*1e6+0.5) / 1e6
+
+	return Dimension{Value: mm, Unit: "mm"}.String(), nil
+}
+
+// parseIndentation parses the toc_level_indentation and returns it as a wkhtmltopdf arg like "1.5em".
+func parseIndentation(str string) (string, error) {
+	d, err := ParseDimension(str, "em")
+	if err != nil {
+		return "", err
+	}
+	if d.Unit != "em" {
+		return "", fmt.Errorf("'%s' (only em is supported)", str)
+	}
+
+	return d.String(), nil
+}
+
+func parseUint(str string) (uint, error) {
+	v, err := strconv.ParseUint(str, 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' (uint expected)", str)
+	}
+
+	return uint(v), nil
+}
+
+func parseFloat(str string) (float64, error) {
+	v, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' (float expected)", str)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,186 @@
+package html2pdf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDimension(t *testing.T) {
+	cases := []struct {
+		str      string
+		expected string
+		err      string
+	}{
+		{"15mm", "15mm", ""},
+		{" 0.5 IN ", "0.5in", ""},
+		{"10", "10mm", ""},
+		{".5cm", "0.5cm", ""},
+		{"12pt", "12pt", ""},
+		{"1em", "1em", ""},
+		{"-1mm", "", "is not a dimension"},
+		{"10 apples", "", "has an unknown unit 'apples'"},
+		{"mm", "", "is not a dimension"},
+		{"10ft", "", "has an unknown unit 'ft'"},
+	}
+
+	for _, c := range cases {
+		d, err := ParseDimension(c.str, "mm")
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%q: expected error contains %q, but got %v", c.str, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.str, err)
+		} else if d.String() != c.expected {
+			t.Errorf("%q: expected %s, but got %s", c.str, c.expected, d)
+		}
+	}
+}
+
+func TestParseLength(t *testing.T) {
+	cases := []struct {
+		str      string
+		expected float64
+		err      string
+	}{
+		{"15mm", 15, ""},
+		{"1.5cm", 15, ""},
+		{"0.5in", 12.7, ""},
+		{"72pt", 25.4, ""},
+		{"96px", 25.4, ""},
+		{"2", 2, ""},
+		{"1em", 0, "can't be converted to an absolute length"},
+	}
+
+	for _, c := range cases {
+		v, err := parseLength(c.str)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%q: expected error contains %q, but got %v", c.str, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.str, err)
+		} else if d := v - c.expected; d > 1e-9 || d < -1e-9 {
+			t.Errorf("%q: expected %v, but got %v", c.str, c.expected, v)
+		}
+	}
+}
+
+func TestLengthArg(t *testing.T) {
+	cases := []struct {
+		str      string
+		expected string
+		err      string
+	}{
+		{"15mm", "15mm", ""},
+		{"2.9cm", "29mm", ""},
+		{"0.5in", "12.7mm", ""},
+		{"72pt", "25.4mm", ""},
+		{"10.5", "10.5mm", ""},
+		{"0", "0mm", ""},
+		{"1em", "", "can't be converted to an absolute length"},
+	}
+
+	for _, c := range cases {
+		v, err := lengthArg(c.str)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%q: expected error contains %q, but got %v", c.str, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.str, err)
+		} else if v != c.expected {
+			t.Errorf("%q: expected %s, but got %s", c.str, c.expected, v)
+		}
+	}
+}
+
+func TestParseIndentation(t *testing.T) {
+	cases := []struct {
+		str      string
+		expected string
+		err      string
+	}{
+		{"1em", "1em", ""},
+		{"2", "2em", ""},
+		{"1.5em", "1.5em", ""},
+		{"10mm", "", "'10mm' (only em is supported)"},
+	}
+
+	for _, c := range cases {
+		v, err := parseIndentation(c.str)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%q: expected error contains %q, but got %v", c.str, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.str, err)
+		} else if v != c.expected {
+			t.Errorf("%q: expected %s, but got %s", c.str, c.expected, v)
+		}
+	}
+}
+
+func TestDimensionArgs(t *testing.T) {
+	cases := []struct {
+		config   string
+		expected string
+		err      string
+	}{
+		{
+			config:   `options = { margin_top = "15mm", margin_bottom = "1.5cm", margin_left = 10, margin_right = "0.5in" }`,
+			expected: "--margin-bottom 15mm --margin-left 10mm --margin-right 12.7mm --margin-top 15mm",
+		},
+		{
+			config:   `options = { page_width = "8.5in", page_height = "11in" }`,
+			expected: "--page-height 279.4mm --page-width 215.9mm",
+		},
+		{
+			config: `options = { margin_top = "1em" }`,
+			err:    `'a.pdf' invalid options.margin_top: '1em' can't be converted to an absolute length`,
+		},
+		{
+			config:   `pages = { { input = "a.html", header = { spacing = "0.5in" } } }`,
+			expected: "page a.html --header-spacing 12.7",
+		},
+		{
+			config:   `toc = { toc_level_indentation = "1.5em" }`,
+			expected: "toc --toc-level-indentation 1.5em",
+		},
+		{
+			config: `toc = { toc_level_indentation = "2mm" }`,
+			err:    `'a.pdf' invalid toc.toc_level_indentation: '2mm' (only em is supported)`,
+		},
+	}
+
+	for _, c := range cases {
+		app := newTestApp(t)
+
+		err := app.LoadRecipe(`pdf "a.pdf" { pages = { input = "a.html" }, ` + c.config + ` }`)
+		var args string
+		if err == nil {
+			args, err = argsOf(app)
+		}
+		closeTestApp(app)
+
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected error contains %q, but got %v", c.config, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.config, err)
+		} else if args = strings.Replace(args, "\n", " ", -1); !strings.Contains(args, c.expected) {
+			t.Errorf("%s: expected args contain %q, but got %q", c.config, c.expected, args)
+		}
+	}
+}
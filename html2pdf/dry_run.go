@@ -0,0 +1,125 @@
+package html2pdf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// DryRunResult is a resolved wkhtmltopdf or renderer command invocation of a pdf config.
+type DryRunResult struct {
+	Name       string   `json:"name"`
+	OutputFile string   `json:"output_file"`
+	Command    string   `json:"command"`
+	Args       []string `json:"args"`
+	// Tmpfiles are the temporary files in the args. They are not removed by Close to run the command.
+	Tmpfiles []string `json:"tmpfiles"`
+}
+
+// DryRun resolves the selected pdf configs and returns the wkhtmltopdf or renderer command invocations without running them.
+// The temporary files for the contents like 'input_content' are created to resolve the args, and they are kept
+// after the app is closed, so the commands can be run. The secrets in the args are masked.
+func (app *App) DryRun() ([]*DryRunResult, error) {
+	if err := app.prepareCachedirs(); err != nil {
+		return nil, err
+	}
+	if err := app.prepareWkhtmltopdf(); err != nil {
+		return nil, err
+	}
+
+	targetpdfs, err := app.TargetPdfsToBuild()
+	if err != nil {
+		return nil, err
+	}
+
+	kept := len(app.Tmpfiles)
+	ret := []*DryRunResult{}
+	for _, tp := range targetpdfs {
+		n := len(app.Tmpfiles)
+		doc, err := tp.Resolve()
+		if err != nil {
+			return nil, err
+		}
+
+		result := &DryRunResult{Name: tp.Name, OutputFile: tp.OutputFile()}
+		switch r := app.renderer().(type) {
+		case *WkhtmltopdfRenderer:
+			args, err := r.Args(doc)
+			if err != nil {
+				return nil, err
+			}
+			result.Command = r.Cmd
+			result.Args = maskArgs(args)
+		case *CommandRenderer:
+			if err := r.checkSupport(doc); err != nil {
+				return nil, err
+			}
+			args, _, err := r.Args(doc)
+			if err != nil {
+				return nil, err
+			}
+			result.Command = args[0]
+			result.Args = maskArgs(args[1:])
+		default:
+			return nil, fmt.Errorf("the renderer %T doesn't support -dry-run", r)
+		}
+		result.Tmpfiles = append([]string{}, app.Tmpfiles[n:]...)
+
+		ret = append(ret, result)
+	}
+
+	// the temporary files of the commands are not removed by Close.
+	app.tmpfilesMutex.Lock()
+	app.Tmpfiles = app.Tmpfiles[:kept]
+	app.tmpfilesMutex.Unlock()
+
+	return ret, nil
+}
+
+// WriteDryRun writes the results of DryRun in the format (text or json).
+func (app *App) WriteDryRun(w io.Writer, format string) error {
+	results, err := app.DryRun()
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "", "text":
+		for _, r := range results {
+			fmt.Fprintf(w, "==> %s\n", r.Name)
+			fmt.Fprintf(w, "    output_file: %s\n", r.OutputFile)
+			for _, f := range r.Tmpfiles {
+				fmt.Fprintf(w, "    tmpfile: %s\n", f)
+			}
+			fmt.Fprintf(w, "    %s\n", shellJoin(append([]string{r.Command}, r.Args...)))
+		}
+	case "json":
+		b, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", b)
+	default:
+		return fmt.Errorf("unsupported format '%s' (text or json expected)", format)
+	}
+
+	return nil
+}
+
+var shellSafeRe = regexp.MustCompile(`^[a-zA-Z0-9_@%+=:,./-]+$`)
+
+// shellJoin joins the args with quoting them for a shell.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if shellSafeRe.MatchString(arg) {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.Replace(arg, "'", `'"'"'`, -1) + "'"
+		}
+	}
+
+	return strings.Join(quoted, " ")
+}
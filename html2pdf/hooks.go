@@ -0,0 +1,183 @@
+package html2pdf
+
+import (
+	"fmt"
+	"github.com/kohkimakimoto/html2pdf/support/color"
+	"github.com/yuin/gopher-lua"
+	"regexp"
+	"time"
+)
+
+// hookKeys are the keys of the lua functions that are called around building a pdf.
+// They are available only in lua, so they are not in the JSON Schema.
+var hookKeys = []string{
+	"before_build",
+	"after_build",
+	"on_error",
+}
+
+// BuildResult is the result of building a pdf.
+type BuildResult struct {
+	OutputFile string
+	// Size is the size of the pdf in bytes.
+	Size     int
+	Duration time.Duration
+	// Pages is the number of the pages in the pdf.
+	Pages int
+}
+
+// pdfPageRe matches the page objects in a pdf. "/Type /Pages" is the page tree node, so it is excluded.
+var pdfPageRe = regexp.MustCompile(`/Type\s*/Page[^s]`)
+
+// countPdfPages counts the pages in the pdf by the page objects.
+// wkhtmltopdf doesn't compress the object dictionaries, so they can be read without parsing the pdf.
+func countPdfPages(pdf []byte) int {
+	return len(pdfPageRe.FindAllIndex(pdf, -1))
+}
+
+// fnOn registers a global hook that is called for all the pdfs.
+//
+//	html2pdf.on("after_build", function(target, result)
+//	    print(target.name .. ": " .. result.pages .. " pages")
+//	end)
+func (app *App) fnOn(L *lua.LState) int {
+	event := L.CheckString(1)
+	fn := L.CheckFunction(2)
+
+	if !contains(hookKeys, event) {
+		L.ArgError(1, fmt.Sprintf("unknown event '%s' (%s expected)", event, joinOr(stringsToInterfaces(hookKeys))))
+	}
+
+	app.hooks[event] = append(app.hooks[event], fn)
+
+	return 0
+}
+
+// checkHooks checks the hooks of the pdf config are functions.
+func (tp *TargetPdf) checkHooks() error {
+	for _, key := range hookKeys {
+		lv := tp.value(key)
+		if _, ok := lv.(*lua.LFunction); !ok && lv != lua.LNil {
+			return tp.configError(key, fmt.Errorf("function expected, but got %s", lv.Type()))
+		}
+	}
+
+	return nil
+}
+
+// runHooks calls the global hooks and then the hook of the pdf config.
+// The lua state is not thread safe, so the hooks are called one by one even if the pdfs are built concurrently.
+func (tp *TargetPdf) runHooks(event string, args ...func(L *lua.LState) lua.LValue) error {
+	tp.App.luaMutex.Lock()
+	defer tp.App.luaMutex.Unlock()
+
+	fns := append([]*lua.LFunction{}, tp.App.hooks[event]...)
+	if fn, ok := tp.value(event).(*lua.LFunction); ok {
+		fns = append(fns, fn)
+	}
+	if len(fns) == 0 {
+		return nil
+	}
+
+	L := tp.App.LState
+	for _, fn := range fns {
+		lvs := []lua.LValue{newLTargetPdf(L, tp)}
+		for _, arg := range args {
+			lvs = append(lvs, arg(L))
+		}
+
+		if err := L.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, lvs...); err != nil {
+			// the stack trace is not useful for the users.
+			if apiErr, ok := err.(*lua.ApiError); ok {
+				return fmt.Errorf("%s hook failed: %s", event, apiErr.Object.String())
+			}
+			return fmt.Errorf("%s hook failed: %v", event, err)
+		}
+	}
+
+	return nil
+}
+
+// buildWithHooks builds the pdf and calls the hooks around it.
+// on_error is called with the error of the build or the other hooks.
+func (tp *TargetPdf) buildWithHooks() error {
+	err := tp.runBuildHooks()
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+	if hookErr := tp.runHooks("on_error", func(L *lua.LState) lua.LValue { return lua.LString(msg) }); hookErr != nil {
+		return fmt.Errorf("%v (%v)", err, hookErr)
+	}
+
+	return err
+}
+
+func (tp *TargetPdf) runBuildHooks() error {
+	tp.App.luaMutex.Lock()
+	err := tp.checkHooks()
+	tp.App.luaMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := tp.runHooks("before_build"); err != nil {
+		return err
+	}
+
+	tp.logf(color.FgBold(fmt.Sprintf("==> Processing: %s", tp.Name)))
+
+	doc, p, fingerprints, reason, err := tp.resolveBuild()
+	if err != nil {
+		return err
+	}
+	if reason == "" {
+		tp.logf("    skipped: up to date")
+		return nil
+	}
+	tp.logf("    rebuild: %s", reason)
+
+	result, err := tp.build(doc, p)
+	if err != nil {
+		tp.App.updateBuildState(doc, nil)
+		return err
+	}
+	tp.App.updateBuildState(doc, fingerprints)
+
+	return tp.runHooks("after_build", func(L *lua.LState) lua.LValue {
+		tb := L.NewTable()
+		tb.RawSetString("output_file", lua.LString(result.OutputFile))
+		tb.RawSetString("size", lua.LNumber(result.Size))
+		tb.RawSetString("duration", lua.LNumber(result.Duration.Seconds()))
+		tb.RawSetString("pages", lua.LNumber(result.Pages))
+		return tb
+	})
+}
+
+// resolveBuild resolves the pdf config, prepares the render and checks the build state.
+// The hooks of the other pdfs that are built concurrently can change the lua values, so they are read in the lock.
+// The pdf is rendered out of the lock.
+func (tp *TargetPdf) resolveBuild() (*ResolvedDocument, *preparedRender, map[string]string, string, error) {
+	tp.App.luaMutex.Lock()
+	defer tp.App.luaMutex.Unlock()
+
+	tp.logf("    output_file: %s", tp.OutputFile())
+
+	doc, err := tp.Resolve()
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+
+	p, err := tp.App.prepareRender(doc)
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+
+	fingerprints, reason, err := tp.checkBuildState(doc, p)
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+
+	return doc, p, fingerprints, reason, nil
+}
@@ -0,0 +1,206 @@
+package html2pdf
+
+import (
+	"github.com/kohkimakimoto/html2pdf/support/testutil"
+	"github.com/yuin/gopher-lua"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	app := newTestApp(t)
+	defer closeTestApp(app)
+	app.WkhtmltopdfCmd = testutil.WriteFakeWkhtmltopdf(t, app.Cachedir)
+
+	out := filepath.Join(app.Cachedir, "a.pdf")
+	err := app.LoadRecipe(`
+local html2pdf = require "html2pdf"
+events = {}
+
+html2pdf.on("before_build", function(target)
+    table.insert(events, "global before " .. target.name)
+end)
+html2pdf.on("after_build", function(target, result)
+    table.insert(events, "global after " .. target.name .. " " .. result.output_file .. " " .. tostring(result.size > 0) .. " " .. tostring(result.duration >= 0) .. " " .. result.pages)
+end)
+html2pdf.on("on_error", function(target, err)
+    table.insert(events, "global error " .. target.name)
+end)
+
+pdf "a.pdf" {
+    pages = { input = "a.html" },
+    output_file = "` + out + `",
+    before_build = function(target)
+        table.insert(events, "before " .. target.name)
+    end,
+    after_build = function(target, result)
+        table.insert(events, "after " .. target.name)
+    end,
+}
+
+pdf "b.pdf" {
+    pages = { input = "fail.html" },
+    on_error = function(target, err)
+        table.insert(events, "error " .. target.name .. ": " .. err)
+    end,
+}
+
+pdf "c.pdf" {
+    pages = { input = "c.html" },
+    before_build = function(target)
+        error("stop")
+    end,
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.Run()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "'c.pdf': before_build hook failed: <string>:") || !strings.Contains(err.Error(), "stop") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	events := []string{}
+	app.LState.GetGlobal("events").(*lua.LTable).ForEach(func(k, v lua.LValue) {
+		events = append(events, v.String())
+	})
+
+	expected := []string{
+		"global before a.pdf",
+		"before a.pdf",
+		"global after a.pdf " + out + " true true 0",
+		"after a.pdf",
+		"global before b.pdf",
+		"global error b.pdf",
+		"error b.pdf: wkhtmltopdf failed: exit status 1: failed to load",
+		"global before c.pdf",
+		"global error c.pdf",
+	}
+	if strings.Join(events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("events mismatch\n--- expected\n%s\n--- actual\n%s", strings.Join(expected, "\n"), strings.Join(events, "\n"))
+	}
+}
+
+func TestHooksWithJobs(t *testing.T) {
+	app := newTestApp(t)
+	defer closeTestApp(app)
+	app.WkhtmltopdfCmd = testutil.WriteFakeWkhtmltopdf(t, app.Cachedir)
+
+	app.Jobs = 4
+	err := app.LoadRecipe(`
+local html2pdf = require "html2pdf"
+count = 0
+
+html2pdf.on("after_build", function(target, result)
+    count = count + 1
+end)
+
+for i = 1, 8 do
+    pdf("p" .. i .. ".pdf") { pages = { input = "a.html" }, output_file = "-" }
+end
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Stdout = ioutil.Discard
+
+	if err := app.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := app.LState.GetGlobal("count"); count != lua.LNumber(8) {
+		t.Errorf("expected 8 calls, but got %v", count)
+	}
+}
+
+func TestHookErrors(t *testing.T) {
+	cases := []struct {
+		script string
+		err    string
+	}{
+		{
+			script: `html2pdf.on("after_run", function() end)`,
+			err:    "unknown event 'after_run' (before_build, after_build or on_error expected)",
+		},
+		{
+			script: `pdf "a.pdf" { pages = { input = "a.html" }, after_build = "publish.sh" }`,
+			err:    "'a.pdf' invalid after_build: function expected, but got string",
+		},
+		{
+			script: `pdf "a.pdf" { pages = { input = "a.html" }, after_buld = function() end }`,
+			err:    "invalid after_buld: unknown key (did you mean 'after_build'?)",
+		},
+	}
+
+	for _, c := range cases {
+		app := newTestApp(t)
+		app.WkhtmltopdfCmd = testutil.WriteFakeWkhtmltopdf(t, app.Cachedir)
+
+		err := app.LoadRecipe(`local html2pdf = require "html2pdf"
+` + c.script)
+		if err == nil {
+			err = app.Run()
+		}
+		closeTestApp(app)
+
+		if err == nil {
+			t.Errorf("%s: expected error", c.script)
+		} else if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error contains %q, but got %q", c.script, c.err, err.Error())
+		}
+	}
+}
+
+func TestCountPdfPages(t *testing.T) {
+	pdf := []byte("%PDF-1.4\n1 0 obj\n<</Type /Pages /Kids [2 0 R 3 0 R] /Count 2>>\nendobj\n2 0 obj\n<</Type /Page /Parent 1 0 R>>\nendobj\n3 0 obj\n<</Type/Page\n/Parent 1 0 R>>\nendobj\n")
+
+	if n := countPdfPages(pdf); n != 2 {
+		t.Errorf("expected 2 pages, but got %d", n)
+	}
+}
+
+func TestHooksWithJobsChangingConfigs(t *testing.T) {
+	app := newTestApp(t)
+	defer closeTestApp(app)
+
+	r := &FakeRenderer{}
+	app.Renderer = r
+	app.Logger = log.New(ioutil.Discard, "", 0)
+	app.Jobs = 4
+	app.Force = true
+	app.Stdout = ioutil.Discard
+
+	// the hooks change the tables that are shared by the pdf configs while the other ones are resolved.
+	err := app.LoadRecipe(`
+local html2pdf = require "html2pdf"
+local options = { title = "0" }
+local pages = { { input = "a.html" } }
+
+html2pdf.on("before_build", function(target)
+    options.title = target.name
+    pages[1].zoom = #target.name
+    pages[1]["print_media_type"] = not pages[1]["print_media_type"]
+end)
+
+for i = 1, 16 do
+    pdf("p" .. i .. ".pdf") { options = options, pages = pages, output_file = "-" }
+end
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Documents()) != 16 {
+		t.Errorf("expected 16 pdfs are rendered, but got %d", len(r.Documents()))
+	}
+}
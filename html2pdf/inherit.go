@@ -0,0 +1,205 @@
+package html2pdf
+
+import (
+	"fmt"
+	"github.com/yuin/gopher-lua"
+	"sort"
+	"strings"
+)
+
+// noInheritedKeys are the keys that are not inherited from the defaults and the extended pdf configs.
+var noInheritedKeys = []string{"extends", "output_file", "depends_on"}
+
+// fnDefaults sets the default values of the pdf configs that are registered after it.
+// The values are deep-merged to the current defaults.
+//
+//	html2pdf.defaults {
+//	    options = {
+//	        page_size = "A4",
+//	    },
+//	}
+func (app *App) fnDefaults(L *lua.LState) int {
+	tb := L.CheckTable(1)
+
+	tb.ForEach(func(k, v lua.LValue) {
+		key, ok := toString(k)
+		if !ok {
+			L.RaiseError("a key of defaults must be string, but got %s", k.Type())
+		}
+		if contains(noInheritedKeys, key) {
+			L.RaiseError("defaults can't have '%s'", key)
+		}
+
+		v, err := expandComponents(L, key, v)
+		if err != nil {
+			err.Path = "defaults." + err.Path
+			L.RaiseError("%v", err)
+		}
+
+		app.defaults[key] = mergeLValues(L, app.defaults[key], v)
+	})
+
+	return 0
+}
+
+// targetPdfExtend registers a new pdf config that extends the pdf config.
+//
+//	local base = pdf "base.pdf" { options = { page_size = "A4" } }
+//	base:extend "child.pdf" { pages = { input = "child.html" } }
+func targetPdfExtend(L *lua.LState) int {
+	base := checkTargetPdf(L)
+	name := L.CheckString(2)
+
+	tp := base.App.registerTargetPdf(L, name)
+	tp.extended = base
+
+	if L.GetTop() >= 3 {
+		setupTargetPdf(L, tp, L.CheckTable(3))
+	}
+
+	L.Push(newLTargetPdf(L, tp))
+
+	return 1
+}
+
+// mergeLValues deep-merges the value over the base value and returns a new value.
+// The tables that have string keys are merged by the keys recursively. Other values, including arrays like pages, are replaced.
+// The tables are copied, so modifying the result doesn't affect the arguments.
+func mergeLValues(L *lua.LState, base lua.LValue, value lua.LValue) lua.LValue {
+	if value == nil || value == lua.LNil {
+		return copyLValue(L, base)
+	}
+
+	baseTb, ok1 := base.(*lua.LTable)
+	tb, ok2 := value.(*lua.LTable)
+	if !ok1 || !ok2 || baseTb.MaxN() != 0 || tb.MaxN() != 0 {
+		return copyLValue(L, value)
+	}
+
+	ret := copyLValue(L, baseTb).(*lua.LTable)
+	tb.ForEach(func(k, v lua.LValue) {
+		ret.RawSet(k, mergeLValues(L, ret.RawGet(k), v))
+	})
+
+	return ret
+}
+
+func copyLValue(L *lua.LState, lv lua.LValue) lua.LValue {
+	if lv == nil {
+		return lua.LNil
+	}
+
+	tb, ok := lv.(*lua.LTable)
+	if !ok {
+		return lv
+	}
+
+	ret := L.CreateTable(tb.MaxN(), 0)
+	tb.ForEach(func(k, v lua.LValue) {
+		ret.RawSet(k, copyLValue(L, v))
+	})
+
+	return ret
+}
+
+// base returns the pdf config that the pdf config extends by the 'extends' key or the extend method.
+func (tp *TargetPdf) base() (*TargetPdf, error) {
+	if tp.extended != nil {
+		return tp.extended, nil
+	}
+
+	lv, ok := tp.LValues["extends"]
+	if !ok || lv == lua.LNil {
+		return nil, nil
+	}
+
+	name, ok := toString(lv)
+	if !ok {
+		return nil, tp.configError("extends", fmt.Errorf("string expected, but got %s", lv.Type()))
+	}
+
+	for _, t := range tp.App.Targetpdfs {
+		if t.Name == name && t != tp {
+			return t, nil
+		}
+	}
+
+	return nil, tp.configError("extends", fmt.Errorf("pdf '%s' is not defined", name))
+}
+
+// bases returns the chain of the extended pdf configs from the nearest one.
+// It returns the chain until the error if a pdf config is not found or the chain has a cycle.
+func (tp *TargetPdf) bases() ([]*TargetPdf, error) {
+	ret := []*TargetPdf{}
+	names := []string{tp.Name}
+
+	for t := tp; ; {
+		b, err := t.base()
+		if err != nil {
+			return ret, err
+		}
+		if b == nil {
+			return ret, nil
+		}
+
+		names = append(names, b.Name)
+		if b == tp || containsTargetPdf(ret, b) {
+			return ret, tp.configError("extends", fmt.Errorf("cyclic extends (%s)", strings.Join(names, " -> ")))
+		}
+
+		ret = append(ret, b)
+		t = b
+	}
+}
+
+// value returns the value of the key that is merged with the defaults and the extended pdf configs.
+// The own value is deep-merged over the extended one, and it is deep-merged over the defaults.
+func (tp *TargetPdf) value(key string) lua.LValue {
+	own := tp.LValues[key]
+	if own == nil {
+		own = lua.LNil
+	}
+	if contains(noInheritedKeys, key) {
+		return own
+	}
+
+	bases, _ := tp.bases()
+	if len(bases) == 0 && tp.defaults[key] == nil {
+		return own
+	}
+
+	L := tp.App.LState
+	chain := append([]*TargetPdf{tp}, bases...)
+
+	var ret lua.LValue = lua.LNil
+	for i := len(chain) - 1; i >= 0; i-- {
+		t := chain[i]
+		ret = mergeLValues(L, mergeLValues(L, t.defaults[key], ret), t.LValues[key])
+	}
+
+	return ret
+}
+
+// valueKeys returns the sorted keys of the pdf config including the inherited ones.
+func (tp *TargetPdf) valueKeys() []string {
+	bases, _ := tp.bases()
+	keys := map[string]bool{}
+	for _, t := range append([]*TargetPdf{tp}, bases...) {
+		for k := range t.defaults {
+			keys[k] = true
+		}
+		for k := range t.LValues {
+			if t == tp || !contains(noInheritedKeys, k) {
+				keys[k] = true
+			}
+		}
+	}
+
+	ret := []string{}
+	for k := range keys {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+
+	return ret
+}
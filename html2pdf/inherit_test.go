@@ -0,0 +1,166 @@
+package html2pdf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultsAndExtends(t *testing.T) {
+	app := newTestApp(t)
+	defer closeTestApp(app)
+
+	err := app.LoadRecipe(`
+local html2pdf = require "html2pdf"
+
+pdf "before.pdf" { pages = { input = "before.html" } }
+
+html2pdf.defaults {
+    options = { page_size = "A4", margin_top = "10mm" },
+    pages = { { input = "default.html" } },
+}
+html2pdf.defaults {
+    options = { title = "default" },
+}
+
+pdf "a.pdf" {
+    options = { title = "a" },
+}
+
+local base = pdf "base.pdf" {
+    options = { orientation = "Landscape" },
+    pages = { { input = "base.html", zoom = "2" } },
+    footer = { center = "[page]" },
+    output_file = "base-out.pdf",
+}
+
+base:extend "b.pdf" {
+    options = { margin_top = "20mm" },
+    footer = { right = "b" },
+}
+
+pdf "c.pdf" {
+    extends = "b.pdf",
+    pages = { input = "c.html" },
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := argsOf(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# before.pdf
+page
+before.html
+-
+# a.pdf
+--margin-top
+10mm
+--page-size
+A4
+--title
+a
+page
+default.html
+-
+# base.pdf
+--margin-top
+10mm
+--orientation
+Landscape
+--page-size
+A4
+--title
+default
+page
+base.html
+--zoom
+2
+--footer-center
+[page]
+-
+# b.pdf
+--margin-top
+20mm
+--orientation
+Landscape
+--page-size
+A4
+--title
+default
+page
+base.html
+--zoom
+2
+--footer-center
+[page]
+--footer-right
+b
+-
+# c.pdf
+--margin-top
+20mm
+--orientation
+Landscape
+--page-size
+A4
+--title
+default
+page
+c.html
+--footer-center
+[page]
+--footer-right
+b
+-
+`
+	if actual != expected {
+		t.Errorf("args mismatch\n--- expected\n%s\n--- actual\n%s", expected, actual)
+	}
+
+	for _, tp := range app.Targetpdfs {
+		if tp.Name == "b.pdf" && tp.OutputFile() != "b.pdf" {
+			t.Errorf("output_file must not be inherited, but got %s", tp.OutputFile())
+		}
+	}
+}
+
+func TestExtendsErrors(t *testing.T) {
+	cases := []struct {
+		script string
+		err    string
+	}{
+		{
+			script: `pdf "a.pdf" { extends = "none.pdf", pages = { input = "a.html" } }`,
+			err:    "'a.pdf' invalid extends: pdf 'none.pdf' is not defined",
+		},
+		{
+			script: `pdf "a.pdf" { extends = "b.pdf" } pdf "b.pdf" { extends = "a.pdf" }`,
+			err:    "invalid extends: cyclic extends (a.pdf -> b.pdf -> a.pdf)",
+		},
+		{
+			script: `local html2pdf = require "html2pdf"
+html2pdf.defaults { output_file = "a.pdf" }`,
+			err: "defaults can't have 'output_file'",
+		},
+	}
+
+	for _, c := range cases {
+		app := newTestApp(t)
+
+		err := app.LoadRecipe(c.script)
+		if err == nil {
+			_, err = argsOf(app)
+		}
+		closeTestApp(app)
+
+		if err == nil {
+			t.Errorf("%s: expected error", c.script)
+		} else if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error contains %q, but got %q", c.script, c.err, err.Error())
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package html2pdf
 
 import (
-	"fmt"
+	"context"
 	"github.com/cjoudrey/gluahttp"
 	"github.com/kohkimakimoto/gluaenv"
 	"github.com/kohkimakimoto/gluafs"
@@ -12,33 +12,207 @@ import (
 	gluajson "github.com/layeh/gopher-json"
 	"github.com/yuin/gluare"
 	"github.com/yuin/gopher-lua"
-	"log"
 	"net/http"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 func (app *App) openLibs() {
+	if app.Sandbox {
+		app.LState.Close()
+		app.LState = newSandboxLState(app.MaxScriptMemory)
+		app.LState.SetGlobal("var", toLValue(app.LState, app.variable))
+	}
+
 	L := app.LState
 
 	loadLTargetPdfClass(L)
+	loadLComponentClass(L)
 
 	L.SetGlobal("pdf", L.NewFunction(app.fnPdf))
 	L.PreloadModule("html2pdf", app.luaModuleLoader)
 
+	// record the files that are loaded by the script.
+	for _, name := range []string{"dofile", "loadfile"} {
+		if fn, ok := L.GetGlobal(name).(*lua.LFunction); ok {
+			L.SetGlobal(name, app.recordingFunction(L, fn))
+		}
+	}
+
 	// buit-in packages
 	L.PreloadModule("json", gluajson.Loader)
-	L.PreloadModule("fs", gluafs.Loader)
 	L.PreloadModule("yaml", gluayaml.Loader)
 	L.PreloadModule("template", gluatemplate.Loader)
 	L.PreloadModule("markdown", gluamarkdown.Loader)
-	L.PreloadModule("env", gluaenv.Loader)
-	L.PreloadModule("http", gluahttp.NewHttpModule(&http.Client{}).Loader)
 	L.PreloadModule("re", gluare.Loader)
+	if app.Sandbox {
+		return
+	}
+	L.PreloadModule("fs", app.fsLoader)
+	L.PreloadModule("env", gluaenv.Loader)
+	L.PreloadModule("http", gluahttp.NewHttpModule(&http.Client{Jar: app.CookieJar}).Loader)
+}
+
+// sandboxLibs are the standard libraries that don't access the files, the commands and the environment.
+var sandboxLibs = []struct {
+	name string
+	fn   lua.LGFunction
+}{
+	{lua.LoadLibName, lua.OpenPackage},
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+	{lua.CoroutineLibName, lua.OpenCoroutine},
+}
+
+// newSandboxLState creates a lua state for the untrusted scripts.
+// It doesn't have os, io and debug, and require can't load lua files.
+// string.rep fails if the result is larger than maxMemory, unless it is 0.
+func newSandboxLState(maxMemory int64) *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+
+	for _, lib := range sandboxLibs {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+
+	for _, name := range []string{"dofile", "loadfile"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	// the loaders are the preload loader and the lua file loader.
+	if pkg, ok := L.GetGlobal("package").(*lua.LTable); ok {
+		if loaders, ok := pkg.RawGetString("loaders").(*lua.LTable); ok {
+			loaders.RawSetInt(2, lua.LNil)
+		}
+		pkg.RawSetString("path", lua.LString(""))
+	}
+
+	// a single call of string.rep can allocate more than the memory before limitMemory notices it.
+	if str, ok := L.GetGlobal("string").(*lua.LTable); ok && maxMemory > 0 {
+		str.RawSetString("rep", L.NewFunction(func(L *lua.LState) int {
+			s, n := L.CheckString(1), L.CheckInt(2)
+			if n <= 0 {
+				L.Push(lua.LString(""))
+				return 1
+			}
+			if len(s) > 0 && int64(n) > maxMemory/int64(len(s)) {
+				L.RaiseError("string.rep: the result is larger than %d bytes", maxMemory)
+			}
+			L.Push(lua.LString(strings.Repeat(s, n)))
+			return 1
+		}))
+	}
+
+	return L
+}
+
+// memoryCheckInterval is the interval of limitMemory to check the heap.
+var memoryCheckInterval = 10 * time.Millisecond
+
+// limitMemory stops the running script of the lua state if the heap grows more than app.MaxScriptMemory.
+// The heap is shared by the goroutines of the process, so it is approximate, but it stops the scripts that
+// allocate without bound like string.rep in a loop. The returned function stops checking the heap and
+// reports whether the limit is exceeded.
+func (app *App) limitMemory() func() bool {
+	L := app.LState
+	parent := L.Context()
+	base := parent
+	if base == nil {
+		base = context.Background()
+	}
+	ctx, cancel := context.WithCancel(base)
+	L.SetContext(ctx)
+
+	var exceeded int32
+	done := make(chan struct{})
+	go func() {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		limit := m.HeapAlloc + uint64(app.MaxScriptMemory)
+
+		ticker := time.NewTicker(memoryCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			runtime.ReadMemStats(&m)
+			if m.HeapAlloc <= limit {
+				continue
+			}
+			// the garbage is not counted.
+			runtime.GC()
+			runtime.ReadMemStats(&m)
+			if m.HeapAlloc > limit {
+				atomic.StoreInt32(&exceeded, 1)
+				cancel()
+				return
+			}
+		}
+	}()
+
+	return func() bool {
+		close(done)
+		if parent != nil {
+			L.SetContext(parent)
+		} else {
+			L.RemoveContext()
+		}
+		cancel()
+		return atomic.LoadInt32(&exceeded) == 1
+	}
+}
+
+// fsLoader loads the fs module that records the files read by the script.
+func (app *App) fsLoader(L *lua.LState) int {
+	n := gluafs.Loader(L)
+
+	if tb, ok := L.Get(-1).(*lua.LTable); ok {
+		if fn, ok := tb.RawGetString("read").(*lua.LFunction); ok {
+			tb.RawSetString("read", app.recordingFunction(L, fn))
+		}
+	}
+
+	return n
+}
+
+// recordingFunction wraps the function that takes a file path as the first argument to record the file.
+func (app *App) recordingFunction(L *lua.LState, fn *lua.LFunction) *lua.LFunction {
+	return L.NewFunction(func(L *lua.LState) int {
+		if path, ok := L.Get(1).(lua.LString); ok {
+			app.recordLoadedFile(string(path))
+		}
+
+		top := L.GetTop()
+		L.Push(fn)
+		for i := 1; i <= top; i++ {
+			L.Push(L.Get(i))
+		}
+		L.Call(top, lua.MultRet)
+
+		return L.GetTop() - top
+	})
 }
 
 func (app *App) luaModuleLoader(L *lua.LState) int {
 	tb := L.NewTable()
 	L.SetFuncs(tb, map[string]lua.LGFunction{
-		"pdf": app.fnPdf,
+		"pdf":      app.fnPdf,
+		"settings": app.fnSettings,
+		"defaults": app.fnDefaults,
+		"page":     app.fnComponent("page"),
+		"cover":    app.fnComponent("cover"),
+		"toc":      app.fnComponent("toc"),
+		"options":  app.fnComponent("options"),
+		"on":       app.fnOn,
 	})
 
 	L.Push(tb)
@@ -59,7 +233,7 @@ func (app *App) fnPdf(L *lua.LState) int {
 		// function style
 		tb := L.CheckTable(2)
 		r := app.registerTargetPdf(L, name)
-		setupTargetPdf(r, tb)
+		setupTargetPdf(L, r, tb)
 		L.Push(newLTargetPdf(L, r))
 
 		return 1
@@ -68,11 +242,75 @@ func (app *App) fnPdf(L *lua.LState) int {
 	return 0
 }
 
+// fnSettings sets the settings of the app.
+//
+//	html2pdf.settings {
+//	    jobs = 4,
+//	    strict = false,
+//	    wkhtmltopdf = "/usr/local/bin/wkhtmltopdf",
+//	    renderer = { "weasyprint", "{{.Input}}", "{{.Output}}" },
+//	}
+func (app *App) fnSettings(L *lua.LState) int {
+	tb := L.CheckTable(1)
+
+	tb.ForEach(func(k, v lua.LValue) {
+		key, ok := toString(k)
+		if !ok {
+			L.RaiseError("a key of settings must be string")
+		}
+
+		// the untrusted scripts must not run arbitrary commands and change the resources of the server.
+		if app.Sandbox && (key == "jobs" || key == "wkhtmltopdf" || key == "renderer") {
+			L.RaiseError("settings '%s' is not allowed in the sandbox", key)
+		}
+
+		switch key {
+		case "jobs":
+			n, ok := v.(lua.LNumber)
+			if !ok || int(n) < 1 {
+				L.RaiseError("settings 'jobs' must be a positive number")
+			}
+			app.Jobs = int(n)
+		case "strict":
+			b, ok := v.(lua.LBool)
+			if !ok {
+				L.RaiseError("settings 'strict' must be a boolean")
+			}
+			app.Strict = bool(b)
+		case "wkhtmltopdf":
+			s, ok := v.(lua.LString)
+			if !ok || s == "" {
+				L.RaiseError("settings 'wkhtmltopdf' must be a non-empty string")
+			}
+			app.WkhtmltopdfCmd = string(s)
+		case "renderer":
+			tb, ok := v.(*lua.LTable)
+			if !ok || tb.MaxN() == 0 {
+				L.RaiseError("settings 'renderer' must be a non-empty array of strings")
+			}
+			command := []string{}
+			for i := 1; i <= tb.MaxN(); i++ {
+				s, ok := tb.RawGetInt(i).(lua.LString)
+				if !ok {
+					L.RaiseError("settings 'renderer' must be a non-empty array of strings")
+				}
+				command = append(command, string(s))
+			}
+			app.Renderer = &CommandRenderer{Command: command}
+		default:
+			L.RaiseError("unknown settings '%s'", key)
+		}
+	})
+
+	return 0
+}
+
 func (app *App) registerTargetPdf(L *lua.LState, name string) *TargetPdf {
 	tp := NewTargetPdf(name, app)
+	tp.Source = luaWhere(L)
 
 	if loglv.IsDebug() {
-		log.Printf("    (Debug) registering pdf '%s'", tp.Name)
+		app.logf("    (Debug) registering pdf '%s'", tp.Name)
 	}
 
 	// set default attributes
@@ -96,20 +334,38 @@ func loadLTargetPdfClass(L *lua.LState) {
 	L.SetField(mt, "__newindex", L.NewFunction(targetPdfNewindex))
 }
 
-func updateTargetPdf(tp *TargetPdf, key string, value lua.LValue) {
+// updateTargetPdf sets the value and remembers where it is set to report the errors of the value.
+// The components like html2pdf.page in the value are replaced with their tables.
+func updateTargetPdf(L *lua.LState, tp *TargetPdf, key string, value lua.LValue, source string) {
+	value, err := expandComponents(L, key, value)
+	if err != nil {
+		err.Target = tp.Name
+		L.RaiseError("%v", err)
+	}
+
 	tp.LValues[key] = value
+	if source != "" {
+		tp.sources[key] = source
+	}
 }
 
-func setupTargetPdf(r *TargetPdf, attributes *lua.LTable) {
+func setupTargetPdf(L *lua.LState, r *TargetPdf, attributes *lua.LTable) {
+	source := luaWhere(L)
+
 	attributes.ForEach(func(k, v lua.LValue) {
 		if kstr, ok := toString(k); ok {
-			updateTargetPdf(r, kstr, v)
+			updateTargetPdf(L, r, kstr, v, source)
 		} else {
-			panic(fmt.Sprintf("'%s' An key must be string", r.Name))
+			L.RaiseError("'%s' a key must be string, but got %s", r.Name, k.Type())
 		}
 	})
 }
 
+// luaWhere returns the location like "build.lua:12" of the lua code that calls the current function.
+func luaWhere(L *lua.LState) string {
+	return strings.TrimSuffix(L.Where(1), ":")
+}
+
 func newLTargetPdf(L *lua.LState, r *TargetPdf) *lua.LUserData {
 	ud := L.NewUserData()
 	ud.Value = r
@@ -132,15 +388,27 @@ func targetPdfCall(L *lua.LState) int {
 	r := checkTargetPdf(L)
 	tb := L.CheckTable(2)
 
-	setupTargetPdf(r, tb)
+	setupTargetPdf(L, r, tb)
 
-	return 0
+	// return the pdf config to use it like 'local base = pdf "base.pdf" { ... }'.
+	L.Push(L.Get(1))
+
+	return 1
 }
 
 func targetPdfIndex(L *lua.LState) int {
 	tp := checkTargetPdf(L)
 	index := L.CheckString(2)
 
+	switch index {
+	case "extend":
+		L.Push(L.NewFunction(targetPdfExtend))
+		return 1
+	case "name":
+		L.Push(lua.LString(tp.Name))
+		return 1
+	}
+
 	v, ok := tp.LValues[index]
 	if v == nil || !ok {
 		v = lua.LNil
@@ -155,7 +423,7 @@ func targetPdfNewindex(L *lua.LState) int {
 	index := L.CheckString(2)
 	value := L.CheckAny(3)
 
-	updateTargetPdf(tp, index, value)
+	updateTargetPdf(L, tp, index, value, luaWhere(L))
 
 	return 0
 }
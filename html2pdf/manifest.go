@@ -0,0 +1,415 @@
+package html2pdf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/kohkimakimoto/loglv"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// manifestKeys are the keys that are available at the top level of a manifest.
+var manifestKeys = []string{
+	"settings",
+	"vars",
+	"defaults",
+	"pdfs",
+}
+
+// interpolationRe matches "${name}", "${name.key}" and the escaped "$$".
+var interpolationRe = regexp.MustCompile(`\$\$|\$\{\s*([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z0-9_]+)*)\s*\}`)
+
+// IsManifestFile returns true if the file is a YAML or JSON manifest instead of a lua script.
+func IsManifestFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+
+	return false
+}
+
+// LoadManifestFile registers the pdf configs in a YAML or JSON manifest.
+// A manifest has the pdf configs by the names, with the same keys as the lua DSL:
+//
+//	settings:
+//	  jobs: 2
+//	vars:
+//	  title: report
+//	defaults:
+//	  options:
+//	    page_size: A4
+//	pdfs:
+//	  report.pdf:
+//	    options:
+//	      title: ${title}
+//	    pages:
+//	      - input: https://example.com
+//
+// "${name}" in the strings is replaced with the variable that is set by -var or -var-file options, or the "vars" as the default.
+func (app *App) LoadManifestFile(path string) error {
+	app.recordLoadedFile(path)
+
+	v, err := LoadConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	manifest, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s: invalid manifest: object expected, but got %s", path, jsonType(v))
+	}
+
+	keys := []string{}
+	for key := range manifest {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !contains(manifestKeys, key) {
+			err := fmt.Errorf("unknown key")
+			if s := suggestKey(key, manifestKeys); s != "" {
+				err = fmt.Errorf("unknown key (did you mean '%s'?)", s)
+			}
+			return &ConfigError{Path: key, Source: path, Err: err}
+		}
+	}
+
+	if err := app.loadManifestVars(path, manifest["vars"]); err != nil {
+		return err
+	}
+	if err := app.loadManifestSettings(path, manifest["settings"]); err != nil {
+		return err
+	}
+
+	if err := app.loadManifestDefaults(path, manifest["defaults"]); err != nil {
+		return err
+	}
+
+	pdfs, ok := manifest["pdfs"].(map[string]interface{})
+	if !ok {
+		return &ConfigError{Path: "pdfs", Source: path, Err: fmt.Errorf("object expected, but got %s", jsonType(manifest["pdfs"]))}
+	}
+
+	// register the pdf configs in the order of the manifest like the pdf functions in a script.
+	names, err := manifestPdfNames(path)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		tp := NewTargetPdf(name, app)
+		tp.Source = path
+
+		config, err := app.interpolate(pdfs[name], "")
+		if err != nil {
+			ce := err.(*ConfigError)
+			return tp.configError(ce.Path, ce.Err)
+		}
+
+		configMap, ok := config.(map[string]interface{})
+		if !ok {
+			return &ConfigError{Path: "pdfs." + name, Source: path, Err: fmt.Errorf("object expected, but got %s", jsonType(config))}
+		}
+
+		for key, value := range configMap {
+			lv, err := goToLValue(app.LState, reflect.ValueOf(value))
+			if err != nil {
+				return tp.configError(key, err)
+			}
+			tp.LValues[key] = lv
+		}
+
+		if loglv.IsDebug() {
+			app.logf("    (Debug) registering pdf '%s'", tp.Name)
+		}
+
+		app.RegisterTargetPdf(tp)
+	}
+
+	return nil
+}
+
+// loadManifestVars sets the variables that are not set by -var and -var-file options.
+func (app *App) loadManifestVars(path string, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+
+	vars, ok := v.(map[string]interface{})
+	if !ok {
+		return &ConfigError{Path: "vars", Source: path, Err: fmt.Errorf("object expected, but got %s", jsonType(v))}
+	}
+
+	for k, value := range vars {
+		if _, ok := app.variable[k]; !ok {
+			app.variable[k] = value
+		}
+	}
+
+	lv, err := goToLValue(app.LState, reflect.ValueOf(app.variable))
+	if err != nil {
+		return &ConfigError{Path: "vars", Source: path, Err: err}
+	}
+	app.LState.SetGlobal("var", lv)
+
+	return nil
+}
+
+// loadManifestDefaults sets the defaults like html2pdf.defaults.
+func (app *App) loadManifestDefaults(path string, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+
+	defaults, err := app.interpolate(v, "defaults")
+	if err != nil {
+		err.(*ConfigError).Source = path
+		return err
+	}
+
+	defaultsMap, ok := defaults.(map[string]interface{})
+	if !ok {
+		return &ConfigError{Path: "defaults", Source: path, Err: fmt.Errorf("object expected, but got %s", jsonType(v))}
+	}
+
+	for key, value := range defaultsMap {
+		if contains(noInheritedKeys, key) {
+			return &ConfigError{Path: "defaults." + key, Source: path, Err: fmt.Errorf("defaults can't have '%s'", key)}
+		}
+
+		lv, err := goToLValue(app.LState, reflect.ValueOf(value))
+		if err != nil {
+			return &ConfigError{Path: "defaults." + key, Source: path, Err: err}
+		}
+		app.defaults[key] = mergeLValues(app.LState, app.defaults[key], lv)
+	}
+
+	return nil
+}
+
+func (app *App) loadManifestSettings(path string, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+
+	settings, ok := v.(map[string]interface{})
+	if !ok {
+		return &ConfigError{Path: "settings", Source: path, Err: fmt.Errorf("object expected, but got %s", jsonType(v))}
+	}
+
+	for key, value := range settings {
+		switch key {
+		case "jobs":
+			n, ok := toFloat(value)
+			if !ok || int(n) < 1 {
+				return &ConfigError{Path: "settings.jobs", Source: path, Err: fmt.Errorf("positive number expected, but got %v", value)}
+			}
+			app.Jobs = int(n)
+		case "strict":
+			b, ok := value.(bool)
+			if !ok {
+				return &ConfigError{Path: "settings.strict", Source: path, Err: fmt.Errorf("boolean expected, but got %s", jsonType(value))}
+			}
+			app.Strict = b
+		case "wkhtmltopdf":
+			s, ok := value.(string)
+			if !ok || s == "" {
+				return &ConfigError{Path: "settings.wkhtmltopdf", Source: path, Err: fmt.Errorf("non-empty string expected, but got %v", value)}
+			}
+			app.WkhtmltopdfCmd = s
+		case "renderer":
+			values, ok := value.([]interface{})
+			if !ok || len(values) == 0 {
+				return &ConfigError{Path: "settings.renderer", Source: path, Err: fmt.Errorf("non-empty array of strings expected, but got %v", value)}
+			}
+			command := []string{}
+			for i, v := range values {
+				s, ok := v.(string)
+				if !ok {
+					return &ConfigError{Path: fmt.Sprintf("settings.renderer[%d]", i+1), Source: path, Err: fmt.Errorf("string expected, but got %s", jsonType(v))}
+				}
+				command = append(command, s)
+			}
+			app.Renderer = &CommandRenderer{Command: command}
+		default:
+			return &ConfigError{Path: "settings." + key, Source: path, Err: fmt.Errorf("unknown settings")}
+		}
+	}
+
+	return nil
+}
+
+// interpolate replaces "${name}" in the strings with the variables.
+// A string that is only "${name}" is replaced with the value as it is, so the variable can be a number or a table.
+func (app *App) interpolate(v interface{}, path string) (interface{}, error) {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		ret := map[string]interface{}{}
+		for k, item := range vv {
+			n, err := app.interpolate(item, join(k))
+			if err != nil {
+				return nil, err
+			}
+			ret[k] = n
+		}
+		return ret, nil
+	case []interface{}:
+		ret := make([]interface{}, 0, len(vv))
+		for i, item := range vv {
+			n, err := app.interpolate(item, fmt.Sprintf("%s[%d]", path, i+1))
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, n)
+		}
+		return ret, nil
+	case string:
+		if m := interpolationRe.FindStringSubmatch(vv); m != nil && m[0] == vv && m[1] != "" {
+			value, err := app.lookupVariable(m[1])
+			if err != nil {
+				return nil, &ConfigError{Path: path, Err: err}
+			}
+			return value, nil
+		}
+
+		var err error
+		ret := interpolationRe.ReplaceAllStringFunc(vv, func(s string) string {
+			if s == "$$" {
+				return "$"
+			}
+
+			name := interpolationRe.FindStringSubmatch(s)[1]
+			value, e := app.lookupVariable(name)
+			if e != nil {
+				err = e
+				return s
+			}
+
+			switch value.(type) {
+			case map[string]interface{}, []interface{}:
+				err = fmt.Errorf("variable '%s' is a table that can't be embedded in a string", name)
+				return s
+			}
+			return fmt.Sprint(value)
+		})
+		if err != nil {
+			return nil, &ConfigError{Path: path, Err: err}
+		}
+		return ret, nil
+	}
+
+	return v, nil
+}
+
+func (app *App) lookupVariable(name string) (interface{}, error) {
+	var v interface{} = app.variable
+	for _, key := range strings.Split(name, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("undefined variable '%s'", name)
+		}
+		if v, ok = m[key]; !ok {
+			return nil, fmt.Errorf("undefined variable '%s'", name)
+		}
+	}
+
+	return v, nil
+}
+
+// manifestPdfNames returns the names of the pdf configs in the order of the manifest file.
+// The maps of LoadConfigFile lose the order, so the file is decoded again by the ordered decoders.
+func manifestPdfNames(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		names, err = jsonObjectKeys(json.NewDecoder(bytes.NewReader(b)), "pdfs")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	default:
+		var manifest struct {
+			Pdfs yaml.MapSlice `yaml:"pdfs"`
+		}
+		if err := yaml.Unmarshal(b, &manifest); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for _, item := range manifest.Pdfs {
+			names = append(names, fmt.Sprint(item.Key))
+		}
+	}
+
+	// the later one wins like the maps if a name is duplicated.
+	ret := []string{}
+	for i, name := range names {
+		if !contains(names[i+1:], name) {
+			ret = append(ret, name)
+		}
+	}
+
+	return ret, nil
+}
+
+// jsonObjectKeys returns the keys of the object of the key in the top level object, in order.
+func jsonObjectKeys(dec *json.Decoder, key string) ([]string, error) {
+	if t, err := dec.Token(); err != nil {
+		return nil, err
+	} else if t != json.Delim('{') {
+		return nil, nil
+	}
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if t != key {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if t, err := dec.Token(); err != nil {
+			return nil, err
+		} else if t != json.Delim('{') {
+			return nil, nil
+		}
+
+		keys := []string{}
+		for dec.More() {
+			t, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, t.(string))
+
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+		}
+		return keys, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,269 @@
+package html2pdf
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeManifest(t *testing.T, app *App, name string, content string) string {
+	file := filepath.Join(app.Cachedir, name)
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+func TestLoadManifestFile(t *testing.T) {
+	app := newTestApp(t)
+	defer closeTestApp(app)
+
+	if err := app.LoadVariableFromJSON(`{"title": "from var", "margin": {"top": 20}}`); err != nil {
+		t.Fatal(err)
+	}
+
+	file := writeManifest(t, app, "html2pdf.yaml", `
+settings:
+  jobs: 3
+vars:
+  title: default
+  url: https://example.com
+pdfs:
+  b.pdf:
+    options:
+      title: "${title}"
+      margin_top: "${margin.top}mm"
+    pages:
+      - input: "${url}/b"
+        zoom: 2
+        header:
+          center: "$${page}"
+  a.pdf:
+    pages:
+      input: a.html
+`)
+	if err := app.LoadManifestFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	if app.Jobs != 3 {
+		t.Errorf("expected jobs 3, but got %d", app.Jobs)
+	}
+
+	actual, err := argsOf(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# b.pdf
+--margin-top
+20mm
+--title
+from var
+page
+https://example.com/b
+--zoom
+2
+--header-center
+${page}
+-
+# a.pdf
+page
+a.html
+-
+`
+	if actual != expected {
+		t.Errorf("args mismatch\n--- expected\n%s\n--- actual\n%s", expected, actual)
+	}
+}
+
+func TestLoadManifestFileOrder(t *testing.T) {
+	cases := []struct {
+		name     string
+		manifest string
+	}{
+		{
+			name:     "html2pdf.json",
+			manifest: `{"settings": {"jobs": 1}, "pdfs": {"c.pdf": {"pages": {"input": "c.html"}}, "a.pdf": {"pages": {"input": "a.html"}}, "b.pdf": {"pages": {"input": "b.html"}}}, "vars": {}}`,
+		},
+		{
+			name:     "html2pdf.yaml",
+			manifest: "pdfs:\n  c.pdf:\n    pages: { input: c.html }\n  a.pdf:\n    pages: { input: a.html }\n  b.pdf:\n    pages: { input: b.html }\n",
+		},
+	}
+
+	for _, c := range cases {
+		app := newTestApp(t)
+		file := writeManifest(t, app, c.name, c.manifest)
+
+		err := app.LoadManifestFile(file)
+		names := namesOf(app.Targetpdfs)
+		closeTestApp(app)
+
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		} else if names != "c.pdf,a.pdf,b.pdf" {
+			t.Errorf("%s: expected the pdf configs are in the order of the manifest, but got %s", c.name, names)
+		}
+	}
+}
+
+func TestLoadManifestFileErrors(t *testing.T) {
+	cases := []struct {
+		manifest string
+		err      string
+	}{
+		{
+			manifest: `{"pfds": {}}`,
+			err:      "invalid pfds: unknown key (did you mean 'pdfs'?)",
+		},
+		{
+			manifest: `{"vars": {}}`,
+			err:      "invalid pdfs: object expected, but got null",
+		},
+		{
+			manifest: `{"pdfs": {"a.pdf": {"options": {"title": "${nothing}"}}}}`,
+			err:      "'a.pdf' invalid options.title: undefined variable 'nothing'",
+		},
+		{
+			manifest: `{"settings": {"jobs": 0}, "pdfs": {}}`,
+			err:      "invalid settings.jobs",
+		},
+		{
+			manifest: `{"pdfs": {"a.pdf": {"pages": [{"input": "a.html", "zooom": 2}]}}}`,
+			err:      "html2pdf.json: 'a.pdf' invalid pages[1].zooom: unknown key (did you mean 'zoom'?)",
+		},
+	}
+
+	for _, c := range cases {
+		app := newTestApp(t)
+		file := writeManifest(t, app, "html2pdf.json", c.manifest)
+
+		err := app.LoadManifestFile(file)
+		if err == nil {
+			_, err = argsOf(app)
+		}
+		closeTestApp(app)
+
+		if err == nil {
+			t.Errorf("%s: expected error", c.manifest)
+		} else if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error contains %q, but got %q", c.manifest, c.err, err.Error())
+		}
+	}
+}
+
+func TestValidateManifest(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "html2pdf_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	file := filepath.Join(tmpdir, "a.yaml")
+	yml := "vars:\n  zoom: 2\npdfs:\n  a.pdf:\n    pages:\n      input: a.html\n      zoom: ${zoom}\n  b.pdf:\n    pages:\n      inptu: b.html\n"
+	if err := ioutil.WriteFile(file, []byte(yml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := LoadConfigFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ValidateManifest(file, v)
+	if err == nil || !strings.Contains(err.Error(), "invalid pdfs.b.pdf.pages.inptu: unknown key (did you mean 'input'?)") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestValidateManifestDefaults(t *testing.T) {
+	cases := []struct {
+		manifest string
+		err      string
+	}{
+		{manifest: `{"defaults": {"options": {"page_size": "A4"}, "toc": {}}, "pdfs": {}}`},
+		{
+			manifest: `{"defaults": {"output_file": "a.pdf"}, "pdfs": {}}`,
+			err:      "invalid defaults.output_file: unknown key",
+		},
+		{
+			manifest: `{"defaults": {"depends_on": "a.pdf"}, "pdfs": {}}`,
+			err:      "invalid defaults.depends_on: unknown key",
+		},
+	}
+
+	for _, c := range cases {
+		var v interface{}
+		if err := json.Unmarshal([]byte(c.manifest), &v); err != nil {
+			t.Fatal(err)
+		}
+
+		err := ValidateManifest("a.json", v)
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.manifest, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error contains %q, but got %v", c.manifest, c.err, err)
+		}
+
+		// the loader rejects the same keys.
+		app := newTestApp(t)
+		err = app.loadManifestDefaults("a.json", v.(map[string]interface{})["defaults"])
+		closeTestApp(app)
+		if (c.err == "") != (err == nil) {
+			t.Errorf("%s: the loader returns %v", c.manifest, err)
+		}
+	}
+}
+
+func TestLoadManifestFileDefaults(t *testing.T) {
+	app := newTestApp(t)
+	defer closeTestApp(app)
+
+	file := writeManifest(t, app, "html2pdf.yaml", `
+defaults:
+  options:
+    page_size: A4
+pdfs:
+  a.pdf:
+    pages:
+      input: a.html
+  b.pdf:
+    extends: a.pdf
+    options:
+      title: b
+`)
+	if err := app.LoadManifestFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := argsOf(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# a.pdf
+--page-size
+A4
+page
+a.html
+-
+# b.pdf
+--page-size
+A4
+--title
+b
+page
+a.html
+-
+`
+	if actual != expected {
+		t.Errorf("args mismatch\n--- expected\n%s\n--- actual\n%s", expected, actual)
+	}
+}
@@ -0,0 +1,496 @@
+package html2pdf
+
+import (
+	"fmt"
+	"github.com/SebastiaanKlippert/go-wkhtmltopdf"
+	"github.com/yuin/gopher-lua"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// PageOptions is the wkhtmltopdf page options that are shared by pages, a cover and a toc.
+// see also
+//
+//	http://wkhtmltopdf.org/usage/wkhtmltopdf.txt
+//	https://github.com/SebastiaanKlippert/go-wkhtmltopdf/blob/master/options.go
+type PageOptions struct {
+	targetPdf *TargetPdf
+	// path is the key path of the options like "pages[3]", "cover" and "toc".
+	path string
+
+	Allow                   []string          // Allow the file or files from the specified folder to be loaded
+	NoBackground            bool              // Do not print background
+	BypassProxyFor          []string          // Bypass proxy for host
+	CacheDir                string            // Web cache directory
+	CheckboxCheckedSvg      string            // Use this SVG file when rendering checked checkboxes
+	CheckboxSvg             string            // Use this SVG file when rendering unchecked checkboxes
+	Cookies                 map[string]string // Set an additional cookie, value should be url encoded
+	CustomHeaders           map[string]string // Set an additional HTTP header
+	CustomHeaderPropagation bool              // Add HTTP headers specified by custom_headers for each resource request
+	DebugJavascript         bool              // Show javascript debugging output
+	DefaultHeader           bool              // Add a default header, with the name of the page to the left, and the page number to the right
+	Encoding                string            // Set the default text encoding, for input
+	DisableExternalLinks    bool              // Do not make links to remote web pages
+	EnableForms             bool              // Turn HTML form fields into pdf form fields
+	NoImages                bool              // Do not load or print images
+	DisableInternalLinks    bool              // Do not make local links
+	DisableJavascript       bool              // Do not allow web pages to run javascript
+	JavascriptDelay         string            `schema:"uint,default=200"`                      // (actually uint) Wait some milliseconds for javascript finish (default 200)
+	LoadErrorHandling       string            `schema:"enum=abort|ignore|skip,default=abort"`  // Specify how to handle pages that fail to load: abort, ignore or skip (default abort)
+	LoadMediaErrorHandling  string            `schema:"enum=abort|ignore|skip,default=ignore"` // Specify how to handle media files that fail to load: abort, ignore or skip (default ignore)
+	DisableLocalFileAccess  bool              // Do not allowed conversion of a local file to read in other local files, unless explicitly allowed with allow
+	EnableLocalFileAccess   bool              // Allowed conversion of a local file to read in other local files
+	MinimumFontSize         string            `schema:"uint"` // (actually uint) Minimum font size
+	ExcludeFromOutline      bool              // Do not include the page in the table of contents and outlines
+	PageOffset              string            `schema:"uint,default=0"` // (actually uint) Set the starting page number (default 0)
+	Password                string            // HTTP Authentication password
+	EnablePlugins           bool              // Enable installed plugins (plugins will likely not work)
+	Post                    map[string]string // Add an additional post field
+	PrintMediaType          bool              // Use print media-type instead of screen
+	Proxy                   string            // Use a proxy
+	RadiobuttonCheckedSvg   string            // Use this SVG file when rendering checked radiobuttons
+	RadiobuttonSvg          string            // Use this SVG file when rendering unchecked radiobuttons
+	RunScript               []string          // Run this additional javascript after the page is done loading
+	DisableSmartShrinking   bool              // Disable the intelligent shrinking strategy used by WebKit that makes the pixel/dpi ratio none constant
+	NoStopSlowScripts       bool              // Do not Stop slow running javascripts
+	EnableTocBackLinks      bool              // Link from section header to toc
+	UserStyleSheet          string            // Specify a user style sheet, to load with every page
+	UserStyleSheetContent   string            // Specify a user style sheet by the content, to load with every page
+	Username                string            // HTTP Authentication username
+	ViewportSize            string            // Set viewport size if you have custom scrollbars or css attribute overflow to emulate window size
+	WindowStatus            string            // Wait until window.status is equal to this string before rendering page
+	Zoom                    string            `schema:"positive_float,default=1"` // (actually float) Use this zoom factor (default 1)
+}
+
+var errorHandlings = []string{"abort", "ignore", "skip"}
+
+// setKeys returns the keys of the options that are set like "zoom", in order.
+func (po *PageOptions) setKeys() []string {
+	v := reflect.ValueOf(po).Elem()
+
+	keys := []string{}
+	for k, f := range configFields(v.Type()) {
+		fv := v.FieldByIndex(f.Index)
+		switch fv.Kind() {
+		case reflect.Bool:
+			if fv.Bool() {
+				keys = append(keys, k)
+			}
+		case reflect.String, reflect.Slice, reflect.Map:
+			if fv.Len() > 0 {
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Validate checks the option values. It is called when the config is loaded.
+func (po *PageOptions) Validate() error {
+	if po.JavascriptDelay != "" {
+		if _, err := parseUint(po.JavascriptDelay); err != nil {
+			return po.configError("javascript_delay", err)
+		}
+	}
+	if po.MinimumFontSize != "" {
+		if _, err := parseUint(po.MinimumFontSize); err != nil {
+			return po.configError("minimum_font_size", err)
+		}
+	}
+	if po.PageOffset != "" {
+		if _, err := parseUint(po.PageOffset); err != nil {
+			return po.configError("page_offset", err)
+		}
+	}
+	if po.Zoom != "" {
+		if v, err := strconv.ParseFloat(po.Zoom, 64); err != nil || v <= 0 {
+			return po.configError("zoom", fmt.Errorf("'%s' (positive float expected)", po.Zoom))
+		}
+	}
+	if po.LoadErrorHandling != "" && !contains(errorHandlings, po.LoadErrorHandling) {
+		return po.configError("load_error_handling", fmt.Errorf("'%s' (abort, ignore or skip expected)", po.LoadErrorHandling))
+	}
+	if po.LoadMediaErrorHandling != "" && !contains(errorHandlings, po.LoadMediaErrorHandling) {
+		return po.configError("load_media_error_handling", fmt.Errorf("'%s' (abort, ignore or skip expected)", po.LoadMediaErrorHandling))
+	}
+	if po.DisableLocalFileAccess && po.EnableLocalFileAccess {
+		return po.configError("disable_local_file_access", fmt.Errorf("disable_local_file_access and enable_local_file_access can't be set at the same time"))
+	}
+
+	return nil
+}
+
+// configError returns a ConfigError of the key in the options.
+func (po *PageOptions) configError(key string, err error) *ConfigError {
+	return po.targetPdf.configError(po.path+"."+key, err)
+}
+
+// setupNameValues sets the tables of names and values from the lua table.
+// gluamapper converts the keys of nested tables to camel case, so they are read from the lua table as they are.
+func (po *PageOptions) setupNameValues(tb *lua.LTable) error {
+	var err error
+
+	if po.Cookies, err = toStringMap(tb.RawGetString("cookies")); err != nil {
+		return po.configError("cookies", err)
+	}
+	if po.CustomHeaders, err = toStringMap(tb.RawGetString("custom_headers")); err != nil {
+		return po.configError("custom_headers", err)
+	}
+	if po.Post, err = toStringMap(tb.RawGetString("post")); err != nil {
+		return po.configError("post", err)
+	}
+
+	return nil
+}
+
+func (po *PageOptions) UserStyleSheetFile() (string, error) {
+	if po.UserStyleSheetContent != "" {
+		t, err := po.targetPdf.CreateTempCSSfileByContent([]byte(po.UserStyleSheetContent))
+		if err != nil {
+			return "", po.configError("user_style_sheet_content", err)
+		}
+		return t, nil
+	}
+
+	return po.UserStyleSheet, nil
+}
+
+// wkPageOptions are the setters of the page options of go-wkhtmltopdf.
+// The options of pages, a cover and a toc are the same, but their types are unexported,
+// so the setters are taken as method values. The compiler checks that go-wkhtmltopdf has all of them.
+type wkPageOptions struct {
+	Allow                   func(string)
+	NoBackground            func(bool)
+	BypassProxyFor          func(string)
+	CacheDir                func(string)
+	CheckboxCheckedSvg      func(string)
+	CheckboxSvg             func(string)
+	Cookie                  func(string, string)
+	CustomHeader            func(string, string)
+	CustomHeaderPropagation func(bool)
+	DebugJavascript         func(bool)
+	DefaultHeader           func(bool)
+	Encoding                func(string)
+	DisableExternalLinks    func(bool)
+	EnableForms             func(bool)
+	NoImages                func(bool)
+	DisableInternalLinks    func(bool)
+	DisableJavascript       func(bool)
+	JavascriptDelay         func(uint)
+	LoadErrorHandling       func(string)
+	LoadMediaErrorHandling  func(string)
+	DisableLocalFileAccess  func(bool)
+	EnableLocalFileAccess   func(bool)
+	MinimumFontSize         func(uint)
+	ExcludeFromOutline      func(bool)
+	PageOffset              func(uint)
+	Password                func(string)
+	EnablePlugins           func(bool)
+	Post                    func(string, string)
+	PrintMediaType          func(bool)
+	Proxy                   func(string)
+	RadiobuttonCheckedSvg   func(string)
+	RadiobuttonSvg          func(string)
+	RunScript               func(string)
+	DisableSmartShrinking   func(bool)
+	NoStopSlowScripts       func(bool)
+	EnableTocBackLinks      func(bool)
+	UserStyleSheet          func(string)
+	Username                func(string)
+	ViewportSize            func(string)
+	WindowStatus            func(string)
+	Zoom                    func(float64)
+}
+
+// pageSetters returns the setters of the page options of a page.
+func pageSetters(o *wkhtmltopdf.PageOptions) *wkPageOptions {
+	return &wkPageOptions{
+		Allow:                   o.Allow.Set,
+		NoBackground:            o.NoBackground.Set,
+		BypassProxyFor:          o.BypassProxyFor.Set,
+		CacheDir:                o.CacheDir.Set,
+		CheckboxCheckedSvg:      o.CheckboxCheckedSvg.Set,
+		CheckboxSvg:             o.CheckboxSvg.Set,
+		Cookie:                  o.Cookie.Set,
+		CustomHeader:            o.CustomHeader.Set,
+		CustomHeaderPropagation: o.CustomHeaderPropagation.Set,
+		DebugJavascript:         o.DebugJavascript.Set,
+		DefaultHeader:           o.DefaultHeader.Set,
+		Encoding:                o.Encoding.Set,
+		DisableExternalLinks:    o.DisableExternalLinks.Set,
+		EnableForms:             o.EnableForms.Set,
+		NoImages:                o.NoImages.Set,
+		DisableInternalLinks:    o.DisableInternalLinks.Set,
+		DisableJavascript:       o.DisableJavascript.Set,
+		JavascriptDelay:         o.JavascriptDelay.Set,
+		LoadErrorHandling:       o.LoadErrorHandling.Set,
+		LoadMediaErrorHandling:  o.LoadMediaErrorHandling.Set,
+		DisableLocalFileAccess:  o.DisableLocalFileAccess.Set,
+		EnableLocalFileAccess:   o.EnableLocalFileAccess.Set,
+		MinimumFontSize:         o.MinimumFontSize.Set,
+		ExcludeFromOutline:      o.ExcludeFromOutline.Set,
+		PageOffset:              o.PageOffset.Set,
+		Password:                o.Password.Set,
+		EnablePlugins:           o.EnablePlugins.Set,
+		Post:                    o.Post.Set,
+		PrintMediaType:          o.PrintMediaType.Set,
+		Proxy:                   o.Proxy.Set,
+		RadiobuttonCheckedSvg:   o.RadiobuttonCheckedSvg.Set,
+		RadiobuttonSvg:          o.RadiobuttonSvg.Set,
+		RunScript:               o.RunScript.Set,
+		DisableSmartShrinking:   o.DisableSmartShrinking.Set,
+		NoStopSlowScripts:       o.NoStopSlowScripts.Set,
+		EnableTocBackLinks:      o.EnableTocBackLinks.Set,
+		UserStyleSheet:          o.UserStyleSheet.Set,
+		Username:                o.Username.Set,
+		ViewportSize:            o.ViewportSize.Set,
+		WindowStatus:            o.WindowStatus.Set,
+		Zoom:                    o.Zoom.Set,
+	}
+}
+
+// coverSetters returns the setters of the page options of the cover.
+func coverSetters(pdfg *wkhtmltopdf.PDFGenerator) *wkPageOptions {
+	return &wkPageOptions{
+		Allow:                   pdfg.Cover.Allow.Set,
+		NoBackground:            pdfg.Cover.NoBackground.Set,
+		BypassProxyFor:          pdfg.Cover.BypassProxyFor.Set,
+		CacheDir:                pdfg.Cover.CacheDir.Set,
+		CheckboxCheckedSvg:      pdfg.Cover.CheckboxCheckedSvg.Set,
+		CheckboxSvg:             pdfg.Cover.CheckboxSvg.Set,
+		Cookie:                  pdfg.Cover.Cookie.Set,
+		CustomHeader:            pdfg.Cover.CustomHeader.Set,
+		CustomHeaderPropagation: pdfg.Cover.CustomHeaderPropagation.Set,
+		DebugJavascript:         pdfg.Cover.DebugJavascript.Set,
+		DefaultHeader:           pdfg.Cover.DefaultHeader.Set,
+		Encoding:                pdfg.Cover.Encoding.Set,
+		DisableExternalLinks:    pdfg.Cover.DisableExternalLinks.Set,
+		EnableForms:             pdfg.Cover.EnableForms.Set,
+		NoImages:                pdfg.Cover.NoImages.Set,
+		DisableInternalLinks:    pdfg.Cover.DisableInternalLinks.Set,
+		DisableJavascript:       pdfg.Cover.DisableJavascript.Set,
+		JavascriptDelay:         pdfg.Cover.JavascriptDelay.Set,
+		LoadErrorHandling:       pdfg.Cover.LoadErrorHandling.Set,
+		LoadMediaErrorHandling:  pdfg.Cover.LoadMediaErrorHandling.Set,
+		DisableLocalFileAccess:  pdfg.Cover.DisableLocalFileAccess.Set,
+		EnableLocalFileAccess:   pdfg.Cover.EnableLocalFileAccess.Set,
+		MinimumFontSize:         pdfg.Cover.MinimumFontSize.Set,
+		ExcludeFromOutline:      pdfg.Cover.ExcludeFromOutline.Set,
+		PageOffset:              pdfg.Cover.PageOffset.Set,
+		Password:                pdfg.Cover.Password.Set,
+		EnablePlugins:           pdfg.Cover.EnablePlugins.Set,
+		Post:                    pdfg.Cover.Post.Set,
+		PrintMediaType:          pdfg.Cover.PrintMediaType.Set,
+		Proxy:                   pdfg.Cover.Proxy.Set,
+		RadiobuttonCheckedSvg:   pdfg.Cover.RadiobuttonCheckedSvg.Set,
+		RadiobuttonSvg:          pdfg.Cover.RadiobuttonSvg.Set,
+		RunScript:               pdfg.Cover.RunScript.Set,
+		DisableSmartShrinking:   pdfg.Cover.DisableSmartShrinking.Set,
+		NoStopSlowScripts:       pdfg.Cover.NoStopSlowScripts.Set,
+		EnableTocBackLinks:      pdfg.Cover.EnableTocBackLinks.Set,
+		UserStyleSheet:          pdfg.Cover.UserStyleSheet.Set,
+		Username:                pdfg.Cover.Username.Set,
+		ViewportSize:            pdfg.Cover.ViewportSize.Set,
+		WindowStatus:            pdfg.Cover.WindowStatus.Set,
+		Zoom:                    pdfg.Cover.Zoom.Set,
+	}
+}
+
+// tocSetters returns the setters of the page options of the toc.
+func tocSetters(pdfg *wkhtmltopdf.PDFGenerator) *wkPageOptions {
+	return &wkPageOptions{
+		Allow:                   pdfg.TOC.Allow.Set,
+		NoBackground:            pdfg.TOC.NoBackground.Set,
+		BypassProxyFor:          pdfg.TOC.BypassProxyFor.Set,
+		CacheDir:                pdfg.TOC.CacheDir.Set,
+		CheckboxCheckedSvg:      pdfg.TOC.CheckboxCheckedSvg.Set,
+		CheckboxSvg:             pdfg.TOC.CheckboxSvg.Set,
+		Cookie:                  pdfg.TOC.Cookie.Set,
+		CustomHeader:            pdfg.TOC.CustomHeader.Set,
+		CustomHeaderPropagation: pdfg.TOC.CustomHeaderPropagation.Set,
+		DebugJavascript:         pdfg.TOC.DebugJavascript.Set,
+		DefaultHeader:           pdfg.TOC.DefaultHeader.Set,
+		Encoding:                pdfg.TOC.Encoding.Set,
+		DisableExternalLinks:    pdfg.TOC.DisableExternalLinks.Set,
+		EnableForms:             pdfg.TOC.EnableForms.Set,
+		NoImages:                pdfg.TOC.NoImages.Set,
+		DisableInternalLinks:    pdfg.TOC.DisableInternalLinks.Set,
+		DisableJavascript:       pdfg.TOC.DisableJavascript.Set,
+		JavascriptDelay:         pdfg.TOC.JavascriptDelay.Set,
+		LoadErrorHandling:       pdfg.TOC.LoadErrorHandling.Set,
+		LoadMediaErrorHandling:  pdfg.TOC.LoadMediaErrorHandling.Set,
+		DisableLocalFileAccess:  pdfg.TOC.DisableLocalFileAccess.Set,
+		EnableLocalFileAccess:   pdfg.TOC.EnableLocalFileAccess.Set,
+		MinimumFontSize:         pdfg.TOC.MinimumFontSize.Set,
+		ExcludeFromOutline:      pdfg.TOC.ExcludeFromOutline.Set,
+		PageOffset:              pdfg.TOC.PageOffset.Set,
+		Password:                pdfg.TOC.Password.Set,
+		EnablePlugins:           pdfg.TOC.EnablePlugins.Set,
+		Post:                    pdfg.TOC.Post.Set,
+		PrintMediaType:          pdfg.TOC.PrintMediaType.Set,
+		Proxy:                   pdfg.TOC.Proxy.Set,
+		RadiobuttonCheckedSvg:   pdfg.TOC.RadiobuttonCheckedSvg.Set,
+		RadiobuttonSvg:          pdfg.TOC.RadiobuttonSvg.Set,
+		RunScript:               pdfg.TOC.RunScript.Set,
+		DisableSmartShrinking:   pdfg.TOC.DisableSmartShrinking.Set,
+		NoStopSlowScripts:       pdfg.TOC.NoStopSlowScripts.Set,
+		EnableTocBackLinks:      pdfg.TOC.EnableTocBackLinks.Set,
+		UserStyleSheet:          pdfg.TOC.UserStyleSheet.Set,
+		Username:                pdfg.TOC.Username.Set,
+		ViewportSize:            pdfg.TOC.ViewportSize.Set,
+		WindowStatus:            pdfg.TOC.WindowStatus.Set,
+		Zoom:                    pdfg.TOC.Zoom.Set,
+	}
+}
+
+// apply sets the options by the setters of go-wkhtmltopdf.
+func (po *PageOptions) apply(o *wkPageOptions) error {
+	for _, a := range po.Allow {
+		o.Allow(a)
+	}
+	if po.NoBackground {
+		o.NoBackground(po.NoBackground)
+	}
+	for _, b := range po.BypassProxyFor {
+		o.BypassProxyFor(b)
+	}
+	if po.CacheDir != "" {
+		o.CacheDir(po.CacheDir)
+	}
+	if po.CheckboxCheckedSvg != "" {
+		o.CheckboxCheckedSvg(po.CheckboxCheckedSvg)
+	}
+	if po.CheckboxSvg != "" {
+		o.CheckboxSvg(po.CheckboxSvg)
+	}
+	for _, k := range sortedKeys(po.Cookies) {
+		o.Cookie(k, po.Cookies[k])
+	}
+	for _, k := range sortedKeys(po.CustomHeaders) {
+		o.CustomHeader(k, po.CustomHeaders[k])
+	}
+	if po.CustomHeaderPropagation {
+		o.CustomHeaderPropagation(po.CustomHeaderPropagation)
+	}
+	if po.DebugJavascript {
+		o.DebugJavascript(po.DebugJavascript)
+	}
+	if po.DefaultHeader {
+		o.DefaultHeader(po.DefaultHeader)
+	}
+	if po.Encoding != "" {
+		o.Encoding(po.Encoding)
+	}
+	if po.DisableExternalLinks {
+		o.DisableExternalLinks(po.DisableExternalLinks)
+	}
+	if po.EnableForms {
+		o.EnableForms(po.EnableForms)
+	}
+	if po.NoImages {
+		o.NoImages(po.NoImages)
+	}
+	if po.DisableInternalLinks {
+		o.DisableInternalLinks(po.DisableInternalLinks)
+	}
+	if po.DisableJavascript {
+		o.DisableJavascript(po.DisableJavascript)
+	}
+	if po.JavascriptDelay != "" {
+		v, err := parseUint(po.JavascriptDelay)
+		if err != nil {
+			return po.configError("javascript_delay", err)
+		}
+		o.JavascriptDelay(v)
+	}
+	if po.LoadErrorHandling != "" {
+		o.LoadErrorHandling(po.LoadErrorHandling)
+	}
+	if po.LoadMediaErrorHandling != "" {
+		o.LoadMediaErrorHandling(po.LoadMediaErrorHandling)
+	}
+	if po.DisableLocalFileAccess {
+		o.DisableLocalFileAccess(po.DisableLocalFileAccess)
+	}
+	if po.EnableLocalFileAccess {
+		o.EnableLocalFileAccess(po.EnableLocalFileAccess)
+	}
+	if po.MinimumFontSize != "" {
+		v, err := parseUint(po.MinimumFontSize)
+		if err != nil {
+			return po.configError("minimum_font_size", err)
+		}
+		o.MinimumFontSize(v)
+	}
+	if po.ExcludeFromOutline {
+		o.ExcludeFromOutline(po.ExcludeFromOutline)
+	}
+	if po.PageOffset != "" {
+		v, err := parseUint(po.PageOffset)
+		if err != nil {
+			return po.configError("page_offset", err)
+		}
+		o.PageOffset(v)
+	}
+	if po.Password != "" {
+		o.Password(po.Password)
+	}
+	if po.EnablePlugins {
+		o.EnablePlugins(po.EnablePlugins)
+	}
+	for _, k := range sortedKeys(po.Post) {
+		o.Post(k, po.Post[k])
+	}
+	if po.PrintMediaType {
+		o.PrintMediaType(po.PrintMediaType)
+	}
+	if po.Proxy != "" {
+		o.Proxy(po.Proxy)
+	}
+	if po.RadiobuttonCheckedSvg != "" {
+		o.RadiobuttonCheckedSvg(po.RadiobuttonCheckedSvg)
+	}
+	if po.RadiobuttonSvg != "" {
+		o.RadiobuttonSvg(po.RadiobuttonSvg)
+	}
+	for _, s := range po.RunScript {
+		o.RunScript(s)
+	}
+	if po.DisableSmartShrinking {
+		o.DisableSmartShrinking(po.DisableSmartShrinking)
+	}
+	if po.NoStopSlowScripts {
+		o.NoStopSlowScripts(po.NoStopSlowScripts)
+	}
+	if po.EnableTocBackLinks {
+		o.EnableTocBackLinks(po.EnableTocBackLinks)
+	}
+	style, err := po.UserStyleSheetFile()
+	if err != nil {
+		return err
+	}
+	if style != "" {
+		o.UserStyleSheet(style)
+	}
+	if po.Username != "" {
+		o.Username(po.Username)
+	}
+	if po.ViewportSize != "" {
+		o.ViewportSize(po.ViewportSize)
+	}
+	if po.WindowStatus != "" {
+		o.WindowStatus(po.WindowStatus)
+	}
+	if po.Zoom != "" {
+		v, err := parseFloat(po.Zoom)
+		if err != nil {
+			return po.configError("zoom", err)
+		}
+		o.Zoom(v)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package html2pdf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPageOptionsArgs(t *testing.T) {
+	cases := []struct {
+		option   string
+		expected string
+	}{
+		{`allow = { "/a", "/b" }`, "--allow /a --allow /b"},
+		{`no_background = true`, "--no-background"},
+		{`bypass_proxy_for = { "example.com" }`, "--bypass-proxy-for example.com"},
+		{`cache_dir = "/tmp/cache"`, "--cache-dir /tmp/cache"},
+		{`checkbox_checked_svg = "checked.svg"`, "--checkbox-checked-svg checked.svg"},
+		{`checkbox_svg = "unchecked.svg"`, "--checkbox-svg unchecked.svg"},
+		{`cookies = { session = "abc" }`, "--cookie session abc"},
+		{`cookies = { session = "abc", lang = "en", id = "1" }`, "--cookie id 1 --cookie lang en --cookie session abc"},
+		{`custom_headers = { ["X-Token"] = "xyz" }`, "--custom-header X-Token xyz"},
+		{`custom_header_propagation = true`, "--custom-header-propagation"},
+		{`debug_javascript = true`, "--debug-javascript"},
+		{`default_header = true`, "--default-header"},
+		{`encoding = "utf-8"`, "--encoding utf-8"},
+		{`disable_external_links = true`, "--disable-external-links"},
+		{`enable_forms = true`, "--enable-forms"},
+		{`no_images = true`, "--no-images"},
+		{`disable_internal_links = true`, "--disable-internal-links"},
+		{`disable_javascript = true`, "--disable-javascript"},
+		{`javascript_delay = 500`, "--javascript-delay 500"},
+		{`load_error_handling = "ignore"`, "--load-error-handling ignore"},
+		{`load_media_error_handling = "skip"`, "--load-media-error-handling skip"},
+		{`disable_local_file_access = true`, "--disable-local-file-access"},
+		{`enable_local_file_access = true`, "--enable-local-file-access"},
+		{`minimum_font_size = 8`, "--minimum-font-size 8"},
+		{`exclude_from_outline = true`, "--exclude-from-outline"},
+		{`page_offset = 2`, "--page-offset 2"},
+		{`password = "secret"`, "--password secret"},
+		{`enable_plugins = true`, "--enable-plugins"},
+		{`post = { name = "value" }`, "--post name value"},
+		{`print_media_type = true`, "--print-media-type"},
+		{`proxy = "http://proxy:8080"`, "--proxy http://proxy:8080"},
+		{`radiobutton_checked_svg = "checked.svg"`, "--radiobutton-checked-svg checked.svg"},
+		{`radiobutton_svg = "unchecked.svg"`, "--radiobutton-svg unchecked.svg"},
+		{`run_script = { "init()" }`, "--run-script init()"},
+		{`disable_smart_shrinking = true`, "--disable-smart-shrinking"},
+		{`no_stop_slow_scripts = true`, "--no-stop-slow-scripts"},
+		{`enable_toc_back_links = true`, "--enable-toc-back-links"},
+		{`user_style_sheet = "style.css"`, "--user-style-sheet style.css"},
+		{`user_style_sheet_content = "h1 { color: red; }"`, "--user-style-sheet <tmpfile0.css>"},
+		{`username = "user"`, "--username user"},
+		{`viewport_size = "1280x1024"`, "--viewport-size 1280x1024"},
+		{`window_status = "ready"`, "--window-status ready"},
+		{`zoom = 1.5`, "--zoom 1.5"},
+	}
+
+	// the options are applied to a page, a cover and a toc.
+	parts := []struct {
+		config string
+		prefix string
+	}{
+		{`pages = { { input = "a.html", %s } }`, "page a.html "},
+		{`pages = { input = "a.html" }, cover = { input = "cover.html", %s }`, "cover cover.html "},
+		{`pages = { input = "a.html" }, toc = { %s }`, "toc "},
+	}
+
+	for _, p := range parts {
+		for _, c := range cases {
+			app := newTestApp(t)
+
+			config := strings.Replace(p.config, "%s", c.option, 1)
+			err := app.LoadRecipe(`pdf "a.pdf" { ` + config + ` }`)
+			var args string
+			if err == nil {
+				args, err = argsOf(app)
+			}
+			closeTestApp(app)
+
+			if err != nil {
+				t.Errorf("%s: %v", config, err)
+				continue
+			}
+			if args = strings.Replace(args, "\n", " ", -1); !strings.Contains(args, p.prefix+c.expected) {
+				t.Errorf("%s: expected args contain %q, but got %q", config, p.prefix+c.expected, args)
+			}
+		}
+	}
+}
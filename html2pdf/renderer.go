@@ -0,0 +1,391 @@
+package html2pdf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/kohkimakimoto/html2pdf/support/color"
+	"github.com/kohkimakimoto/html2pdf/support/gluamapper"
+	"github.com/kohkimakimoto/loglv"
+	"github.com/yuin/gopher-lua"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Renderer renders a resolved pdf config to a pdf.
+// The wkhtmltopdf is used by default, and App.Renderer replaces it.
+type Renderer interface {
+	Render(ctx context.Context, doc *ResolvedDocument) ([]byte, error)
+}
+
+// ResolvedDocument is a pdf config that the defaults, the inheritance and the components are resolved.
+// The contents like input_content are not written to temporary files yet. InputFile and HTMLFile of the parts write them.
+type ResolvedDocument struct {
+	Name string
+	// OutputFile is the output_file. It is "-" for stdout.
+	OutputFile string
+	Options    *GlobalOptions
+	Cover      *Cover
+	Pages      []*Page
+	TOC        *TOC
+
+	targetPdf *TargetPdf
+}
+
+// Resolve resolves the pdf config to render it.
+func (tp *TargetPdf) Resolve() (*ResolvedDocument, error) {
+	if _, err := tp.bases(); err != nil {
+		return nil, err
+	}
+	if tp.App.Strict {
+		if err := tp.checkKeys(); err != nil {
+			return nil, err
+		}
+	}
+
+	doc := &ResolvedDocument{
+		Name:       tp.Name,
+		OutputFile: tp.OutputFile(),
+		Options:    &GlobalOptions{},
+		targetPdf:  tp,
+	}
+
+	if options := tp.value("options"); options != lua.LNil {
+		if opttb, ok := options.(*lua.LTable); ok {
+			if err := gluamapper.Map(opttb, doc.Options); err != nil {
+				return nil, tp.configError("options", err)
+			}
+		}
+	}
+
+	cover, err := tp.Cover()
+	if err != nil {
+		return nil, err
+	}
+	doc.Cover = cover
+
+	pages, err := tp.Pages()
+	if err != nil {
+		return nil, err
+	}
+	doc.Pages = pages
+
+	toc, err := tp.TOC()
+	if err != nil {
+		return nil, err
+	}
+	doc.TOC = toc
+
+	return doc, nil
+}
+
+// renderer returns the renderer of the app. It is the wkhtmltopdf of app.WkhtmltopdfCmd if app.Renderer is nil.
+func (app *App) renderer() Renderer {
+	if app.Renderer != nil {
+		return app.Renderer
+	}
+
+	return &WkhtmltopdfRenderer{Cmd: app.WkhtmltopdfCmd}
+}
+
+// WkhtmltopdfRenderer renders the pdfs by wkhtmltopdf.
+type WkhtmltopdfRenderer struct {
+	// Cmd is the wkhtmltopdf command.
+	Cmd string
+}
+
+// Args returns the wkhtmltopdf args of the document.
+func (r *WkhtmltopdfRenderer) Args(doc *ResolvedDocument) ([]string, error) {
+	return newWkhtmltopdfArgs(r.Cmd, doc)
+}
+
+// Render runs wkhtmltopdf. wkhtmltopdf is killed if the ctx is done, and ctx.Err() is returned.
+func (r *WkhtmltopdfRenderer) Render(ctx context.Context, doc *ResolvedDocument) ([]byte, error) {
+	args, err := r.Args(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.run(ctx, doc, args)
+}
+
+// run runs wkhtmltopdf with the args of the document.
+func (r *WkhtmltopdfRenderer) run(ctx context.Context, doc *ResolvedDocument, args []string) ([]byte, error) {
+	if loglv.IsDebug() {
+		doc.targetPdf.logf("    (Debug) wkhtmltopdf args: %s", maskArgs(args))
+	}
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, r.Cmd, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &WkhtmltopdfError{Args: maskArgs(args), Stderr: strings.TrimSpace(stderr.String()), Err: err}
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// CommandRenderer renders the pdfs by an external command like another html to pdf engine.
+// The args are templates of text/template that are executed with CommandData.
+//
+//	&CommandRenderer{Command: []string{"weasyprint", "{{.Input}}", "{{.Output}}"}}
+//
+// An arg "{{.Inputs}}" is expanded to all the inputs. The pdf is read from the output file if an arg has ".Output",
+// and from stdout otherwise. The toc, the headers, the footers and the page options are not passed to the command,
+// so they are errors in the strict mode and warnings otherwise.
+type CommandRenderer struct {
+	Command []string
+}
+
+// CommandData is the data of the templates of CommandRenderer.
+type CommandData struct {
+	Name string
+	// Input is the first input. Inputs are the inputs of the cover and the pages.
+	// The contents like input_content are written to temporary files.
+	Input  string
+	Inputs []string
+	// Output is a temporary file that the command writes the pdf to.
+	Output  string
+	Options *GlobalOptions
+}
+
+// Args returns the command and the args of the document.
+func (r *CommandRenderer) Args(doc *ResolvedDocument) ([]string, string, error) {
+	if len(r.Command) == 0 {
+		return nil, "", fmt.Errorf("renderer command is empty")
+	}
+
+	data := &CommandData{Name: doc.Name, Options: doc.Options, Inputs: []string{}}
+	if doc.Cover != nil {
+		input, err := doc.Cover.InputFile()
+		if err != nil {
+			return nil, "", err
+		}
+		data.Inputs = append(data.Inputs, input)
+	}
+	for _, p := range doc.Pages {
+		input, err := p.InputFile()
+		if err != nil {
+			return nil, "", err
+		}
+		data.Inputs = append(data.Inputs, input)
+	}
+	if len(data.Inputs) > 0 {
+		data.Input = data.Inputs[0]
+	}
+
+	for _, arg := range r.Command {
+		if strings.Contains(arg, ".Output") {
+			output, err := doc.targetPdf.CreateTempPDFfile()
+			if err != nil {
+				return nil, "", err
+			}
+			data.Output = output
+			break
+		}
+	}
+
+	ret := []string{}
+	for _, arg := range r.Command {
+		if strings.TrimSpace(arg) == "{{.Inputs}}" {
+			ret = append(ret, data.Inputs...)
+			continue
+		}
+
+		t, err := template.New("arg").Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid renderer command %q: %v", arg, err)
+		}
+		buf := new(bytes.Buffer)
+		if err := t.Execute(buf, data); err != nil {
+			return nil, "", fmt.Errorf("invalid renderer command %q: %v", arg, err)
+		}
+		ret = append(ret, buf.String())
+	}
+
+	return ret, data.Output, nil
+}
+
+// unsupported returns the keys of the document that are not passed to the command like "toc" and "pages[1].header".
+func (r *CommandRenderer) unsupported(doc *ResolvedDocument) []string {
+	ret := []string{}
+
+	if doc.Cover != nil {
+		for _, k := range doc.Cover.setKeys() {
+			ret = append(ret, doc.Cover.path+"."+k)
+		}
+	}
+	for _, p := range doc.Pages {
+		for _, k := range p.setKeys() {
+			ret = append(ret, p.path+"."+k)
+		}
+		if p.Header != nil {
+			ret = append(ret, p.path+".header")
+		}
+		if p.Footer != nil {
+			ret = append(ret, p.path+".footer")
+		}
+	}
+	if doc.TOC != nil {
+		ret = append(ret, "toc")
+	}
+
+	return ret
+}
+
+// checkSupport checks the document has only the things that are passed to the command.
+// The others are an error in the strict mode, and a warning otherwise.
+func (r *CommandRenderer) checkSupport(doc *ResolvedDocument) error {
+	unsupported := r.unsupported(doc)
+	if len(unsupported) == 0 {
+		return nil
+	}
+
+	tp := doc.targetPdf
+	err := fmt.Errorf("the renderer command doesn't support %s", strings.Join(unsupported, ", "))
+	if tp.App.Strict {
+		return err
+	}
+
+	tp.logf(color.FgY("    warning: %v", err))
+	return nil
+}
+
+// Render runs the command. The command is killed if the ctx is done, and ctx.Err() is returned.
+func (r *CommandRenderer) Render(ctx context.Context, doc *ResolvedDocument) ([]byte, error) {
+	if err := r.checkSupport(doc); err != nil {
+		return nil, err
+	}
+
+	args, output, err := r.Args(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.run(ctx, doc, args, output)
+}
+
+// run runs the command of the args. The pdf is read from the output file if it is not empty.
+func (r *CommandRenderer) run(ctx context.Context, doc *ResolvedDocument, args []string, output string) ([]byte, error) {
+	if loglv.IsDebug() {
+		doc.targetPdf.logf("    (Debug) renderer command: %s", strings.Join(maskArgs(args), " "))
+	}
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s failed: %v: %s", args[0], err, msg)
+		}
+		return nil, fmt.Errorf("%s failed: %v", args[0], err)
+	}
+
+	if output == "" {
+		return stdout.Bytes(), nil
+	}
+
+	return ioutil.ReadFile(output)
+}
+
+// preparedRender is the rendering of a document that the command and the args are built beforehand.
+// The build state fingerprints the args, and the same args and temporary files are used to render the pdf.
+type preparedRender struct {
+	// args are the command and the args. They are empty if the renderer doesn't run a command like FakeRenderer.
+	args   []string
+	render func(ctx context.Context) ([]byte, error)
+}
+
+// prepareRender builds the command and the args of the document by the renderer of the app.
+func (app *App) prepareRender(doc *ResolvedDocument) (*preparedRender, error) {
+	switch r := app.renderer().(type) {
+	case *WkhtmltopdfRenderer:
+		args, err := r.Args(doc)
+		if err != nil {
+			return nil, err
+		}
+		return &preparedRender{
+			args:   append([]string{r.Cmd}, args...),
+			render: func(ctx context.Context) ([]byte, error) { return r.run(ctx, doc, args) },
+		}, nil
+	case *CommandRenderer:
+		if err := r.checkSupport(doc); err != nil {
+			return nil, err
+		}
+		args, output, err := r.Args(doc)
+		if err != nil {
+			return nil, err
+		}
+		return &preparedRender{
+			args:   args,
+			render: func(ctx context.Context) ([]byte, error) { return r.run(ctx, doc, args, output) },
+		}, nil
+	default:
+		return &preparedRender{
+			render: func(ctx context.Context) ([]byte, error) { return r.Render(ctx, doc) },
+		}, nil
+	}
+}
+
+// FakeRenderer is a renderer that doesn't run any commands, to test the scripts and the configs without wkhtmltopdf.
+// It records the rendered documents and returns a fake pdf that has a page for each of the cover, the pages and the toc.
+type FakeRenderer struct {
+	// Err is returned by Render if it is not nil.
+	Err error
+
+	mutex     sync.Mutex
+	documents []*ResolvedDocument
+}
+
+func (r *FakeRenderer) Render(ctx context.Context, doc *ResolvedDocument) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	r.documents = append(r.documents, doc)
+	r.mutex.Unlock()
+
+	if r.Err != nil {
+		return nil, r.Err
+	}
+
+	pages := len(doc.Pages)
+	if doc.Cover != nil {
+		pages++
+	}
+	if doc.TOC != nil {
+		pages++
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%%PDF-1.4\n%% fake pdf of %s\n", doc.Name)
+	for i := 1; i <= pages; i++ {
+		fmt.Fprintf(buf, "%d 0 obj\n<</Type /Page>>\nendobj\n", i)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Documents returns the rendered documents in the order.
+func (r *FakeRenderer) Documents() []*ResolvedDocument {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]*ResolvedDocument{}, r.documents...)
+}
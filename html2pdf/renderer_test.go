@@ -0,0 +1,214 @@
+package html2pdf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/kohkimakimoto/html2pdf/support/testutil"
+	"github.com/yuin/gopher-lua"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestFakeRenderer(t *testing.T) {
+	r := &FakeRenderer{}
+	app := newTestApp(t)
+	defer closeTestApp(app)
+	app.Renderer = r
+
+	out := filepath.Join(app.Cachedir, "handbook.pdf")
+	err := app.LoadRecipe(`
+local html2pdf = require "html2pdf"
+pages = 0
+
+html2pdf.defaults { options = { page_size = "Letter" } }
+html2pdf.on("after_build", function(target, result)
+    pages = result.pages
+end)
+
+pdf "handbook.pdf" {
+    output_file = "` + out + `",
+    cover = html2pdf.cover { input_content = "<h1>cover</h1>" },
+    toc = {},
+    pages = {
+        { input = "chapter1.html", footer = { center = "[page]" } },
+        html2pdf.page { input = "chapter2.html" },
+    },
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	docs := r.Documents()
+	if len(docs) != 1 {
+		t.Fatalf("expected 1 document, but got %d", len(docs))
+	}
+	doc := docs[0]
+	if doc.Name != "handbook.pdf" || doc.Options.PageSize != "Letter" || doc.Cover.InputContent != "<h1>cover</h1>" || doc.TOC == nil {
+		t.Errorf("unexpected document %+v", doc)
+	}
+	if len(doc.Pages) != 2 || doc.Pages[0].Footer.Center != "[page]" || doc.Pages[1].Input != "chapter2.html" {
+		t.Errorf("unexpected pages %+v", doc.Pages)
+	}
+
+	if b, err := ioutil.ReadFile(out); err != nil || !bytes.HasPrefix(b, []byte("%PDF")) {
+		t.Errorf("expected the fake pdf is written, but got %q (%v)", b, err)
+	}
+	if pages := app.LState.GetGlobal("pages"); pages != lua.LNumber(4) {
+		t.Errorf("expected 4 pages, but got %v", pages)
+	}
+}
+
+func TestFakeRendererError(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "html2pdf_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewConverter()
+	c.Cachedir = tmpdir
+	c.Renderer = &FakeRenderer{Err: fmt.Errorf("boom")}
+
+	err = c.Convert(context.Background(), ioutil.Discard, &Document{
+		Pages: []map[string]interface{}{{"input": "a.html"}},
+	})
+	if err == nil || err.Error() != "'document': boom" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestCommandRenderer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands are shell commands")
+	}
+
+	cases := []struct {
+		command  []string
+		expected string
+	}{
+		{[]string{"cat", "{{.Inputs}}"}, "<p>a</p><p>b</p>"},
+		{[]string{"sh", "-c", `cat "$1" > "$2"`, "sh", "{{.Input}}", "{{.Output}}"}, "<p>a</p>"},
+		{[]string{"echo", "-n", "{{.Name}} {{.Options.PageSize}}"}, "a.pdf A5"},
+	}
+
+	for _, c := range cases {
+		app := newTestApp(t)
+		app.WkhtmltopdfCmd = testutil.WriteFakeWkhtmltopdf(t, app.Cachedir)
+
+		err := app.LoadRecipe(`
+local html2pdf = require "html2pdf"
+html2pdf.settings { renderer = { [[` + strings.Join(c.command, `]], [[`) + `]] } }
+pdf "a.pdf" {
+    options = { page_size = "A5" },
+    pages = { { input_content = "<p>a</p>" }, { input_content = "<p>b</p>" } },
+}
+`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := app.prepareCachedirs(); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := new(bytes.Buffer)
+		if err := app.Targetpdfs[0].Render(context.Background(), buf); err != nil {
+			t.Errorf("%v: %v", c.command, err)
+		} else if buf.String() != c.expected {
+			t.Errorf("%v: expected %q, but got %q", c.command, c.expected, buf.String())
+		}
+		closeTestApp(app)
+	}
+}
+
+func TestCommandRendererErrors(t *testing.T) {
+	cases := []struct {
+		script string
+		err    string
+	}{
+		{
+			script: `html2pdf.settings { renderer = "weasyprint" }`,
+			err:    "settings 'renderer' must be a non-empty array of strings",
+		},
+		{
+			script: `html2pdf.settings { renderer = { "weasyprint", "{{.Unknown}}" } }
+pdf "a.pdf" { pages = { input = "a.html" } }`,
+			err: `invalid renderer command "{{.Unknown}}"`,
+		},
+	}
+
+	for _, c := range cases {
+		app := newTestApp(t)
+
+		err := app.LoadRecipe(`local html2pdf = require "html2pdf"
+` + c.script)
+		if err == nil {
+			_, err = app.DryRun()
+		}
+		closeTestApp(app)
+
+		if err == nil {
+			t.Errorf("%s: expected error", c.script)
+		} else if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error contains %q, but got %q", c.script, c.err, err.Error())
+		}
+	}
+}
+
+func TestCommandRendererUnsupported(t *testing.T) {
+	script := `
+local html2pdf = require "html2pdf"
+html2pdf.settings { renderer = { "weasyprint", "--password", "secret", "{{.Input}}", "-" } }
+pdf "a.pdf" {
+    cover = { input = "cover.html", zoom = 2 },
+    pages = {
+        { input = "a.html" },
+        { input = "b.html", print_media_type = true, header = { center = "[page]" } },
+    },
+    toc = {},
+}
+`
+	unsupported := "the renderer command doesn't support cover.zoom, pages[2].print_media_type, pages[2].header, toc"
+
+	app := newTestApp(t)
+	defer closeTestApp(app)
+	app.WkhtmltopdfCmd = testutil.WriteFakeWkhtmltopdf(t, app.Cachedir)
+
+	if err := app.LoadRecipe(script); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.DryRun(); err == nil || !strings.Contains(err.Error(), unsupported) {
+		t.Errorf("expected error contains %q, but got %v", unsupported, err)
+	}
+
+	// -no-strict warns and renders the inputs.
+	buf := new(bytes.Buffer)
+	app.Logger = log.New(buf, "", 0)
+	app.Strict = false
+
+	results, err := app.DryRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "warning: "+unsupported) {
+		t.Errorf("expected a warning %q, but got %q", unsupported, buf.String())
+	}
+
+	expected := "weasyprint --password ****** " + results[0].Args[2] + " -"
+	if actual := results[0].Command + " " + strings.Join(results[0].Args, " "); actual != expected {
+		t.Errorf("expected the password is masked like %q, but got %q", expected, actual)
+	}
+	if !strings.HasSuffix(results[0].Args[2], "cover.html") {
+		t.Errorf("expected the input is the cover, but got %q", results[0].Args[2])
+	}
+}
@@ -0,0 +1,642 @@
+package html2pdf
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	uintPattern        = `^[0-9]+$`
+	floatPattern       = `^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+)?$`
+	lengthPattern      = `^\s*([0-9]+(\.[0-9]*)?|\.[0-9]+)\s*([mM][mM]|[cC][mM]|[iI][nN]|[pP][tT]|[pP][xX])?\s*$`
+	indentationPattern = `^\s*([0-9]+(\.[0-9]*)?|\.[0-9]+)\s*([eE][mM])?\s*$`
+)
+
+// definitionNames are the names of the structs in the definitions of the schema.
+var definitionNames = map[reflect.Type]string{
+	reflect.TypeOf(GlobalOptions{}): "options",
+	reflect.TypeOf(Page{}):          "page",
+	reflect.TypeOf(Cover{}):         "cover",
+	reflect.TypeOf(TOC{}):           "toc",
+	reflect.TypeOf(HeaderFooter{}):  "header_footer",
+}
+
+// ConfigSchema returns the JSON Schema of a pdf config.
+// It is derived from the option structs, so the keys are the same as the keys that are accepted by the pdf function.
+// The "schema" tags of the fields describe the values that are written as strings:
+//
+//	uint            an unsigned integer like "10"
+//	float           a number like "0.8"
+//	positive_float  a number that is greater than 0
+//	length          an absolute length like "10mm" (mm, cm, in, pt or px. a number is mm)
+//	indentation     a length in em like "1.5em"
+//	enum=a|b        one of the values
+//	default=v       the default value of wkhtmltopdf
+func ConfigSchema() map[string]interface{} {
+	definitions := map[string]interface{}{}
+	for typ, name := range definitionNames {
+		definitions[name] = structSchema(typ)
+	}
+
+	// a page and a cover must have an input.
+	for _, name := range []string{"page", "cover"} {
+		definitions[name].(map[string]interface{})["anyOf"] = []interface{}{
+			map[string]interface{}{"required": []interface{}{"input"}},
+			map[string]interface{}{"required": []interface{}{"input_content"}},
+		}
+	}
+
+	return map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                "html2pdf pdf config",
+		"type":                 "object",
+		"properties":           targetPdfKeySchemas(nil),
+		"additionalProperties": false,
+		"definitions":          definitions,
+	}
+}
+
+// ManifestSchema returns the JSON Schema of a YAML or JSON manifest that has pdf configs by the names.
+// The schema of a pdf config is in the definitions as "pdf".
+func ManifestSchema() map[string]interface{} {
+	config := ConfigSchema()
+	definitions := config["definitions"].(map[string]interface{})
+	definitions["pdf"] = map[string]interface{}{
+		"type":                 "object",
+		"properties":           config["properties"],
+		"additionalProperties": false,
+	}
+	definitions["defaults"] = map[string]interface{}{
+		"type":                 "object",
+		"properties":           targetPdfKeySchemas(noInheritedKeys),
+		"additionalProperties": false,
+	}
+
+	return map[string]interface{}{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title":   "html2pdf manifest",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"settings": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"jobs":   map[string]interface{}{"type": "integer", "minimum": 1},
+					"strict": map[string]interface{}{"type": "boolean"},
+					"wkhtmltopdf": map[string]interface{}{
+						"type":        "string",
+						"minLength":   1,
+						"description": "The external wkhtmltopdf to use instead of the bundled one. -wkhtmltopdf option overrides it.",
+					},
+					"renderer": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"minItems":    1,
+						"description": "The command to render the pdfs instead of wkhtmltopdf. The args are Go templates like {{.Input}} and {{.Output}}.",
+					},
+				},
+				"additionalProperties": false,
+			},
+			"vars": map[string]interface{}{
+				"type":        "object",
+				"description": "The default variables that are used by ${name} in the strings. -var and -var-file options override them.",
+			},
+			"defaults": schemaRef("defaults"),
+			"pdfs": map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": schemaRef("pdf"),
+			},
+		},
+		"required":             []interface{}{"pdfs"},
+		"additionalProperties": false,
+		"definitions":          definitions,
+	}
+}
+
+// targetPdfKeySchemas returns the schemas of the top level keys of a pdf config.
+// The keys are targetPdfKeys that the loader accepts, except the excluded keys.
+func targetPdfKeySchemas(excluded []string) map[string]interface{} {
+	schemas := map[string]interface{}{
+		"options": schemaRef("options"),
+		"pages": map[string]interface{}{
+			"oneOf": []interface{}{
+				schemaRef("page"),
+				map[string]interface{}{"type": "array", "items": schemaRef("page")},
+			},
+		},
+		"cover":  schemaRef("cover"),
+		"toc":    schemaRef("toc"),
+		"header": schemaRef("header_footer"),
+		"footer": schemaRef("header_footer"),
+		"extends": map[string]interface{}{
+			"type":        "string",
+			"description": "The name of the pdf config to inherit. Its values are deep-merged under the values of this pdf config.",
+		},
+		"depends_on": map[string]interface{}{
+			"oneOf": []interface{}{
+				map[string]interface{}{"type": "string"},
+				map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			},
+			"description": "The names of the pdf configs that are built before this pdf config.",
+		},
+		"output_file": map[string]interface{}{
+			"type":        "string",
+			"description": "The output pdf file. '-' writes the pdf to stdout. The default is the name of the pdf config.",
+		},
+	}
+
+	ret := map[string]interface{}{}
+	for _, key := range targetPdfKeys {
+		if contains(excluded, key) {
+			continue
+		}
+		schema, ok := schemas[key]
+		if !ok {
+			panic(fmt.Sprintf("the schema of the pdf config key '%s' is not defined", key))
+		}
+		ret[key] = schema
+	}
+
+	return ret
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/definitions/" + name}
+}
+
+func structSchema(typ reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for key, f := range configFields(typ) {
+		properties[key] = fieldSchema(f)
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+func fieldSchema(f reflect.StructField) map[string]interface{} {
+	var kind, def string
+	var enum []interface{}
+	for _, part := range strings.Split(f.Tag.Get("schema"), ",") {
+		switch {
+		case strings.HasPrefix(part, "default="):
+			def = strings.TrimPrefix(part, "default=")
+		case strings.HasPrefix(part, "enum="):
+			for _, v := range strings.Split(strings.TrimPrefix(part, "enum="), "|") {
+				enum = append(enum, v)
+			}
+		default:
+			kind = part
+		}
+	}
+
+	var ret map[string]interface{}
+	switch f.Type.Kind() {
+	case reflect.Bool:
+		ret = map[string]interface{}{"type": "boolean"}
+	case reflect.Slice:
+		ret = map[string]interface{}{
+			"oneOf": []interface{}{
+				map[string]interface{}{"type": "string"},
+				map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			},
+		}
+	case reflect.Map:
+		ret = map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": map[string]interface{}{"type": []interface{}{"string", "number", "boolean"}},
+		}
+	case reflect.Ptr:
+		ret = schemaRef(definitionNames[f.Type.Elem()])
+	default:
+		ret = stringSchema(kind)
+	}
+
+	if enum != nil {
+		ret = map[string]interface{}{"type": "string", "enum": enum}
+	}
+	if def != "" {
+		ret["default"] = def
+	}
+
+	return ret
+}
+
+// stringSchema returns the schema of a value that is written as a string. A number is also accepted.
+func stringSchema(kind string) map[string]interface{} {
+	alternatives := func(number map[string]interface{}, pattern string, title string) []interface{} {
+		return []interface{}{
+			number,
+			map[string]interface{}{"type": "string", "pattern": pattern, "title": title},
+		}
+	}
+
+	switch kind {
+	case "uint":
+		return map[string]interface{}{
+			"oneOf": alternatives(map[string]interface{}{"type": "integer", "minimum": 0}, uintPattern, "uint"),
+		}
+	case "float":
+		return map[string]interface{}{
+			"oneOf": alternatives(map[string]interface{}{"type": "number"}, floatPattern, "float"),
+		}
+	case "positive_float":
+		return map[string]interface{}{
+			"oneOf": alternatives(map[string]interface{}{"type": "number", "exclusiveMinimum": 0}, floatPattern, "positive float"),
+		}
+	case "length":
+		return map[string]interface{}{
+			"oneOf":       alternatives(map[string]interface{}{"type": "number", "minimum": 0}, lengthPattern, "length"),
+			"description": "A length like 10mm (mm, cm, in, pt or px). A number is mm.",
+		}
+	case "indentation":
+		return map[string]interface{}{
+			"oneOf":       alternatives(map[string]interface{}{"type": "number", "minimum": 0}, indentationPattern, "length in em"),
+			"description": "A length in em like 1.5em. A number is em.",
+		}
+	}
+
+	return map[string]interface{}{"type": []interface{}{"string", "number"}}
+}
+
+// LoadConfigFile reads a JSON or YAML file by the extension. The maps of YAML are converted to map[string]interface{} like JSON.
+func LoadConfigFile(path string) (interface{}, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return v, nil
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(b, &v); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		v, err = normalizeYAML(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return v, nil
+	}
+
+	return nil, fmt.Errorf("%s: unsupported file type (.json, .yaml or .yml expected)", path)
+}
+
+func normalizeYAML(v interface{}) (interface{}, error) {
+	switch vv := v.(type) {
+	case map[interface{}]interface{}:
+		ret := map[string]interface{}{}
+		for k, item := range vv {
+			ks, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("a key must be string, but got %v", k)
+			}
+			n, err := normalizeYAML(item)
+			if err != nil {
+				return nil, err
+			}
+			ret[ks] = n
+		}
+		return ret, nil
+	case []interface{}:
+		ret := make([]interface{}, 0, len(vv))
+		for _, item := range vv {
+			n, err := normalizeYAML(item)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, n)
+		}
+		return ret, nil
+	}
+
+	return v, nil
+}
+
+// ValidateConfig validates a pdf config that is decoded from JSON or YAML against ConfigSchema.
+// It returns ConfigErrors that have the source.
+func ValidateConfig(source string, v interface{}) error {
+	return validateBySchema(ConfigSchema(), source, v)
+}
+
+// ValidateManifest validates a manifest against ManifestSchema.
+// The strings that have variables like "${name}" are not validated, because they are replaced when the manifest is loaded.
+func ValidateManifest(source string, v interface{}) error {
+	return validateBySchema(ManifestSchema(), source, v)
+}
+
+func validateBySchema(schema map[string]interface{}, source string, v interface{}) error {
+	sv := &schemaValidator{definitions: schema["definitions"].(map[string]interface{})}
+
+	errs := ConfigErrors{}
+	for _, e := range sv.validate(schema, v, "") {
+		path := e.path
+		if path == "" {
+			path = "config"
+		}
+		errs = append(errs, &ConfigError{Path: path, Source: source, Err: e.err})
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+
+	return errs
+}
+
+type schemaError struct {
+	path string
+	err  error
+}
+
+// schemaValidator validates values by the keywords of JSON Schema that ConfigSchema uses.
+type schemaValidator struct {
+	definitions map[string]interface{}
+}
+
+func (sv *schemaValidator) validate(schema map[string]interface{}, v interface{}, path string) []schemaError {
+	if ref, ok := schema["$ref"].(string); ok {
+		schema = sv.definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+	}
+
+	fail := func(format string, args ...interface{}) []schemaError {
+		return []schemaError{{path, fmt.Errorf(format, args...)}}
+	}
+
+	if str, ok := v.(string); ok && hasVariables(str) {
+		return nil
+	}
+
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		return sv.validateOneOf(oneOf, v, path)
+	}
+
+	if types, ok := schema["type"]; ok && !matchesType(types, v) {
+		return fail("%s expected, but got %s", typesString(types), jsonType(v))
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		for _, e := range enum {
+			if e == v {
+				return nil
+			}
+		}
+		return fail("'%v' (%s expected)", v, joinOr(enum))
+	}
+
+	switch vv := v.(type) {
+	case string:
+		if pattern, ok := schema["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(vv) {
+			title, _ := schema["title"].(string)
+			if title == "" {
+				title = "pattern " + pattern
+			}
+			return fail("'%s' (%s expected)", vv, title)
+		}
+	case map[string]interface{}:
+		return sv.validateObject(schema, vv, path)
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			errs := []schemaError{}
+			for i, item := range vv {
+				errs = append(errs, sv.validate(items, item, fmt.Sprintf("%s[%d]", path, i+1))...)
+			}
+			return errs
+		}
+	default:
+		if n, ok := toFloat(v); ok {
+			if min, ok := toFloat(schema["minimum"]); ok && n < min {
+				return fail("%v (minimum %v expected)", n, min)
+			}
+			if min, ok := toFloat(schema["exclusiveMinimum"]); ok && n <= min {
+				return fail("%v (greater than %v expected)", n, min)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (sv *schemaValidator) validateOneOf(oneOf []interface{}, v interface{}, path string) []schemaError {
+	candidates := [][]schemaError{}
+	types := []interface{}{}
+	for _, s := range oneOf {
+		schema := s.(map[string]interface{})
+		errs := sv.validate(schema, v, path)
+		if len(errs) == 0 {
+			return nil
+		}
+
+		t := schemaType(sv, schema)
+		types = append(types, t)
+		if matchesType(t, v) {
+			candidates = append(candidates, errs)
+		}
+	}
+
+	// report the errors of the alternative of the same type like "'x' (uint expected)".
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+
+	return []schemaError{{path, fmt.Errorf("%s expected, but got %s", typesString(types), jsonType(v))}}
+}
+
+func (sv *schemaValidator) validateObject(schema map[string]interface{}, v map[string]interface{}, path string) []schemaError {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	names := []string{}
+	for name := range properties {
+		names = append(names, name)
+	}
+
+	keys := []string{}
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	errs := []schemaError{}
+	for _, key := range keys {
+		if p, ok := properties[key].(map[string]interface{}); ok {
+			errs = append(errs, sv.validate(p, v[key], join(key))...)
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				err := fmt.Errorf("unknown key")
+				if s := suggestKey(key, names); s != "" {
+					err = fmt.Errorf("unknown key (did you mean '%s'?)", s)
+				}
+				errs = append(errs, schemaError{join(key), err})
+			}
+		case map[string]interface{}:
+			errs = append(errs, sv.validate(additional, v[key], join(key))...)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, k := range required {
+			if _, ok := v[k.(string)]; !ok {
+				return []schemaError{{path, fmt.Errorf("'%s' is required", k)}}
+			}
+		}
+	}
+
+	// only the alternatives of the required keys are supported.
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		required := []interface{}{}
+		for _, s := range anyOf {
+			keys, _ := s.(map[string]interface{})["required"].([]interface{})
+			found := true
+			for _, k := range keys {
+				if _, ok := v[k.(string)]; !ok {
+					found = false
+				}
+				required = append(required, fmt.Sprintf("'%s'", k))
+			}
+			if found {
+				return nil
+			}
+		}
+		return []schemaError{{path, fmt.Errorf("%s is required", joinOr(required))}}
+	}
+
+	return nil
+}
+
+// hasVariables returns true if the string has variables like "${name}".
+func hasVariables(str string) bool {
+	for _, m := range interpolationRe.FindAllStringSubmatch(str, -1) {
+		if m[1] != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// schemaType returns the type of the schema that may be a reference.
+func schemaType(sv *schemaValidator, schema map[string]interface{}) interface{} {
+	if ref, ok := schema["$ref"].(string); ok {
+		schema = sv.definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+	}
+
+	return schema["type"]
+}
+
+func matchesType(types interface{}, v interface{}) bool {
+	list, ok := types.([]interface{})
+	if !ok {
+		list = []interface{}{types}
+	}
+
+	t := jsonType(v)
+	for _, typ := range list {
+		if typ == t {
+			return true
+		}
+		if typ == "number" && t == "integer" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func typesString(types interface{}) string {
+	list, ok := types.([]interface{})
+	if !ok {
+		list = []interface{}{types}
+	}
+
+	flat := []interface{}{}
+	for _, t := range list {
+		if l, ok := t.([]interface{}); ok {
+			flat = append(flat, l...)
+		} else {
+			flat = append(flat, t)
+		}
+	}
+
+	return joinOr(flat)
+}
+
+// jsonType returns the type name of JSON Schema. A number that has no fraction is "integer".
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	if n, ok := toFloat(v); ok {
+		if n == math.Trunc(n) {
+			return "integer"
+		}
+		return "number"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+
+	return 0, false
+}
+
+// joinOr joins the values like "a, b or c".
+func joinOr(values []interface{}) string {
+	strs := []string{}
+	for _, v := range values {
+		strs = append(strs, fmt.Sprint(v))
+	}
+	if len(strs) <= 1 {
+		return strings.Join(strs, "")
+	}
+
+	return strings.Join(strs[:len(strs)-1], ", ") + " or " + strs[len(strs)-1]
+}
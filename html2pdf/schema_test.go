@@ -0,0 +1,127 @@
+package html2pdf
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestConfigSchemaKeys(t *testing.T) {
+	schema := ConfigSchema()
+
+	keys := []string{}
+	for k := range schema["properties"].(map[string]interface{}) {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	expected := append([]string{}, targetPdfKeys...)
+	sort.Strings(expected)
+
+	if strings.Join(keys, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v, but got %v", expected, keys)
+	}
+
+	if _, err := json.Marshal(schema); err != nil {
+		t.Fatal(err)
+	}
+
+	options := schema["definitions"].(map[string]interface{})["options"].(map[string]interface{})
+	marginLeft := options["properties"].(map[string]interface{})["margin_left"].(map[string]interface{})
+	if marginLeft["default"] != "10mm" {
+		t.Errorf("unexpected margin_left %v", marginLeft)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	cases := []struct {
+		config string
+		err    string
+	}{
+		{
+			config: `{"options": {"margin_top": "10mm", "copies": 2, "grayscale": true}, "pages": [{"input": "a.html", "allow": ["/a"], "cookies": {"a": "b"}}], "toc": {}}`,
+		},
+		{
+			config: `{"pages": {"input_content": "<h1>a</h1>", "header": {"font_size": "10", "spacing": 2}}, "cover": {"input": "cover.html"}}`,
+		},
+		{
+			config: `{"options": {"margin_left": "0.5in", "page_width": 215.9}, "pages": {"input": "a.html"}, "toc": {"toc_level_indentation": "1.5em"}}`,
+		},
+		{
+			config: `{"pags": {"input": "a.html"}}`,
+			err:    "invalid pags: unknown key (did you mean 'pages'?)",
+		},
+		{
+			config: `{"options": {"margin_tpo": "10mm"}}`,
+			err:    "invalid options.margin_tpo: unknown key (did you mean 'margin_top'?)",
+		},
+		{
+			config: `{"pages": [{"input": "a.html"}, {"input": "b.html", "page_offset": "x"}]}`,
+			err:    "invalid pages[2].page_offset: 'x' (uint expected)",
+		},
+		{
+			config: `{"pages": [{"zoom": "2"}]}`,
+			err:    "invalid pages[1]: 'input' or 'input_content' is required",
+		},
+		{
+			config: `{"options": {"margin_top": "10furlong"}}`,
+			err:    "invalid options.margin_top: '10furlong' (length expected)",
+		},
+		{
+			config: `{"pages": {"input": "a.html", "load_error_handling": "retry"}}`,
+			err:    "invalid pages.load_error_handling: 'retry' (abort, ignore or skip expected)",
+		},
+		{
+			config: `{"options": {"grayscale": "yes"}}`,
+			err:    "invalid options.grayscale: boolean expected, but got string",
+		},
+		{
+			config: `{"pages": "a.html"}`,
+			err:    "invalid pages: object or array expected, but got string",
+		},
+	}
+
+	for _, c := range cases {
+		var v interface{}
+		if err := json.Unmarshal([]byte(c.config), &v); err != nil {
+			t.Fatal(err)
+		}
+
+		err := ValidateConfig("a.json", v)
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.config, err)
+			}
+		} else if err == nil {
+			t.Errorf("%s: expected error", c.config)
+		} else if !strings.Contains(err.Error(), "a.json: "+c.err) {
+			t.Errorf("%s: expected error contains %q, but got %q", c.config, c.err, err.Error())
+		}
+	}
+}
+
+func TestLoadConfigFileYAML(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "html2pdf_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	file := filepath.Join(tmpdir, "a.yaml")
+	yml := "options:\n  page_size: A4\n  copies: 2\npages:\n  - input: a.html\n    header:\n      center: \"[page]\"\n"
+	if err := ioutil.WriteFile(file, []byte(yml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := LoadConfigFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateConfig(file, v); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,698 @@
+package html2pdf
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server renders pdfs on demand by a HTTP API.
+//
+//	GET  /health         health check
+//	POST /render         renders a pdf and responds the pdf
+//	POST /jobs           starts rendering a pdf and responds the job id
+//	GET  /jobs/{id}      responds the status of the job
+//	GET  /jobs/{id}/pdf  responds the pdf of the finished job
+//
+// The request is a JSON object or a multipart form of RenderRequest.
+// Each job is run by a fresh App, so the jobs don't share the lua states, the variables and the cookies.
+// The scripts are rejected unless EnableScript is set, and they run in a sandbox that can't access the files,
+// the commands, the environment and the network, and can't allocate more than MaxScriptMemory.
+// The requests can't use the local files by the options and the inputs, and the http(s) inputs must be of AllowedHosts.
+type Server struct {
+	// NewApp creates an app for a job. The server loads the lua libraries to it.
+	NewApp func() *App
+	// The number of the jobs that are rendered concurrently.
+	MaxJobs int
+	// The max size of a request body in bytes.
+	MaxRequestSize int64
+	// The time limit of a job including the time waiting for the other jobs.
+	Timeout time.Duration
+	// The finished jobs are kept for this duration to get their pdfs.
+	JobTTL time.Duration
+	// The max number of the jobs that are not finished. POST /jobs responds 503 if it is reached.
+	MaxPendingJobs int
+	// The max number of the finished jobs that are kept. The oldest ones are removed if it is exceeded.
+	MaxFinishedJobs int
+	// EnableScript accepts the requests that have lua scripts.
+	EnableScript bool
+	// The max bytes that a script can allocate. It is not limited if it is 0.
+	MaxScriptMemory int64
+	// The hosts of the http(s) inputs like "example.com" and "*.example.com". Any host is allowed if it is empty,
+	// so set it if the server can reach the internal hosts.
+	AllowedHosts []string
+
+	sem   chan struct{}
+	once  sync.Once
+	mutex sync.Mutex
+	jobs  map[string]*serverJob
+	// wkhtmltopdfCmd is the wkhtmltopdf that is prepared by Prepare. The jobs use it without verifying it again.
+	wkhtmltopdfCmd string
+}
+
+// RenderRequest is a request to render a pdf.
+// It has either a lua script with variables or raw html with options.
+type RenderRequest struct {
+	// Script is a lua script that defines pdf configs like a script file.
+	Script string `json:"script"`
+	// Vars are the variables of the script like -var option.
+	Vars map[string]interface{} `json:"vars"`
+	// Target selects the pdf config to render if the script defines multiple ones.
+	Target string `json:"target"`
+
+	// HTML is the content of the page.
+	HTML string `json:"html"`
+	// Options are the same as the 'options' of the DSL.
+	Options map[string]interface{} `json:"options"`
+	// PageOptions are the same as a page of the 'pages' of the DSL, like the header and footer.
+	PageOptions map[string]interface{} `json:"page_options"`
+	// CoverHTML is the content of the cover.
+	CoverHTML string `json:"cover_html"`
+	// TOC is the same as the 'toc' of the DSL. true adds the toc with default options.
+	TOC interface{} `json:"toc"`
+}
+
+const (
+	jobPending = "pending"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+type serverJob struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+	pdf      []byte
+}
+
+var (
+	errServerBusy    = errors.New("too many jobs")
+	errServerTimeout = errors.New("job timed out")
+)
+
+// requestError is an error of the request that is responded as 400 Bad Request.
+type requestError struct {
+	err error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func NewServer(newApp func() *App) *Server {
+	return &Server{
+		NewApp:          newApp,
+		MaxJobs:         runtime.NumCPU(),
+		MaxRequestSize:  10 << 20,
+		Timeout:         60 * time.Second,
+		JobTTL:          10 * time.Minute,
+		MaxPendingJobs:  100,
+		MaxFinishedJobs: 100,
+		MaxScriptMemory: 256 << 20,
+		jobs:            map[string]*serverJob{},
+	}
+}
+
+// Prepare creates the cache directories and the wkhtmltopdf command that are shared by the jobs.
+func (s *Server) Prepare() error {
+	app := s.NewApp()
+	defer app.Close()
+
+	if err := app.prepareCachedirs(); err != nil {
+		return err
+	}
+	if err := app.prepareWkhtmltopdf(); err != nil {
+		return err
+	}
+	s.wkhtmltopdfCmd = app.WkhtmltopdfCmd
+
+	return nil
+}
+
+// ListenAndServe prepares the wkhtmltopdf command and serves the API on the addr.
+func (s *Server) ListenAndServe(addr string) error {
+	if err := s.Prepare(); err != nil {
+		return err
+	}
+
+	log.Printf("==> Listening on %s", addr)
+
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/render", s.handleRender)
+	mux.HandleFunc("/jobs", s.handleJobs)
+	mux.HandleFunc("/jobs/", s.handleJob)
+
+	return mux
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "ok",
+		"version": Version,
+	})
+}
+
+func (s *Server) handleRender(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+
+	req, err := s.readRequest(w, r)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.Timeout)
+	defer cancel()
+
+	pdf, err := s.render(ctx, req, nil)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.WriteHeader(http.StatusOK)
+	w.Write(pdf)
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+
+	req, err := s.readRequest(w, r)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	job := &serverJob{ID: id, Status: jobPending, Created: time.Now()}
+
+	s.mutex.Lock()
+	s.removeExpiredJobs()
+	if s.pendingJobs() >= s.MaxPendingJobs {
+		s.mutex.Unlock()
+		writeError(w, statusOf(errServerBusy), errServerBusy)
+		return
+	}
+	s.jobs[id] = job
+	s.mutex.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+		defer cancel()
+
+		pdf, err := s.render(ctx, req, func() {
+			s.mutex.Lock()
+			job.Status = jobRunning
+			s.mutex.Unlock()
+		})
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		finished := time.Now()
+		job.Finished = &finished
+		if err != nil {
+			job.Status = jobFailed
+			job.Error = err.Error()
+		} else {
+			job.Status = jobDone
+			job.pdf = pdf
+		}
+		s.removeExpiredJobs()
+	}()
+
+	writeJSON(w, http.StatusAccepted, s.jobStatus(job))
+}
+
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	id := strings.TrimSuffix(path, "/pdf")
+
+	s.mutex.Lock()
+	s.removeExpiredJobs()
+	job, ok := s.jobs[id]
+	s.mutex.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("job '%s' is not found", id))
+		return
+	}
+
+	status := s.jobStatus(job)
+
+	if path == id {
+		writeJSON(w, http.StatusOK, status)
+		return
+	}
+	if path != id+"/pdf" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s is not found", r.URL.Path))
+		return
+	}
+
+	switch status.Status {
+	case jobDone:
+		w.Header().Set("Content-Type", "application/pdf")
+		w.WriteHeader(http.StatusOK)
+		w.Write(status.pdf)
+	case jobFailed:
+		writeError(w, http.StatusConflict, fmt.Errorf("job '%s' failed: %s", id, status.Error))
+	default:
+		writeError(w, http.StatusConflict, fmt.Errorf("job '%s' is %s", id, status.Status))
+	}
+}
+
+// jobStatus returns a copy of the job not to race with the goroutine that runs it.
+func (s *Server) jobStatus(job *serverJob) serverJob {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return *job
+}
+
+// removeExpiredJobs removes the finished jobs that are expired, and the oldest ones over MaxFinishedJobs.
+// It must be called with the mutex locked.
+func (s *Server) removeExpiredJobs() {
+	finished := []*serverJob{}
+	for id, job := range s.jobs {
+		if job.Finished == nil {
+			continue
+		}
+		if time.Since(*job.Finished) > s.JobTTL {
+			delete(s.jobs, id)
+			continue
+		}
+		finished = append(finished, job)
+	}
+
+	if len(finished) <= s.MaxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].Finished.Before(*finished[j].Finished)
+	})
+	for _, job := range finished[:len(finished)-s.MaxFinishedJobs] {
+		delete(s.jobs, job.ID)
+	}
+}
+
+// pendingJobs returns the number of the jobs that are not finished. It must be called with the mutex locked.
+func (s *Server) pendingJobs() int {
+	n := 0
+	for _, job := range s.jobs {
+		if job.Finished == nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// readRequest reads a RenderRequest from a JSON body or a multipart form.
+// The multipart form has the fields of the JSON keys. The object fields like 'vars' and 'options' are JSON strings.
+func (s *Server) readRequest(w http.ResponseWriter, r *http.Request) (*RenderRequest, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.MaxRequestSize)
+
+	req := &RenderRequest{}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(s.MaxRequestSize); err != nil {
+			return nil, &requestError{fmt.Errorf("invalid multipart form: %v", err)}
+		}
+
+		fields := map[string]interface{}{}
+		for key := range r.MultipartForm.Value {
+			fields[key] = r.MultipartForm.Value[key][0]
+		}
+		for key, files := range r.MultipartForm.File {
+			f, err := files[0].Open()
+			if err != nil {
+				return nil, err
+			}
+			b, err := ioutil.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			fields[key] = string(b)
+		}
+
+		// the object fields are JSON strings.
+		for _, key := range []string{"vars", "options", "page_options", "toc"} {
+			if str, ok := fields[key].(string); ok {
+				var v interface{}
+				if err := json.Unmarshal([]byte(str), &v); err != nil {
+					return nil, &requestError{fmt.Errorf("invalid %s: %v", key, err)}
+				}
+				fields[key] = v
+			}
+		}
+
+		b, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, req); err != nil {
+			return nil, &requestError{fmt.Errorf("invalid request: %v", err)}
+		}
+	} else {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, &requestError{err}
+		}
+		if err := json.Unmarshal(b, req); err != nil {
+			return nil, &requestError{fmt.Errorf("invalid request: %v", err)}
+		}
+	}
+
+	if req.Script == "" && req.HTML == "" {
+		return nil, &requestError{fmt.Errorf("'script' or 'html' is required")}
+	}
+	if req.Script != "" && req.HTML != "" {
+		return nil, &requestError{fmt.Errorf("'script' and 'html' can't be used together")}
+	}
+	if req.Script != "" && !s.EnableScript {
+		return nil, &requestError{fmt.Errorf("'script' is disabled on this server")}
+	}
+
+	return req, nil
+}
+
+// render runs a job within the concurrency limit and the context.
+// started is called when the job starts after waiting for the other jobs.
+func (s *Server) render(ctx context.Context, req *RenderRequest, started func()) ([]byte, error) {
+	s.once.Do(func() {
+		n := s.MaxJobs
+		if n < 1 {
+			n = 1
+		}
+		s.sem = make(chan struct{}, n)
+	})
+
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, errServerBusy
+	}
+
+	if started != nil {
+		started()
+	}
+
+	type result struct {
+		pdf []byte
+		err error
+	}
+	done := make(chan result, 1)
+
+	go func() {
+		// the slot is released when the job actually finishes, after wkhtmltopdf is killed by the timeout.
+		defer func() { <-s.sem }()
+
+		pdf, err := s.runJob(ctx, req)
+		done <- result{pdf, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.pdf, r.err
+	case <-ctx.Done():
+		return nil, errServerTimeout
+	}
+}
+
+func (s *Server) runJob(ctx context.Context, req *RenderRequest) ([]byte, error) {
+	app := s.NewApp()
+	defer app.Close()
+
+	// the logs of a job are output at once not to mix with the logs of other jobs.
+	logbuf := new(bytes.Buffer)
+	app.Logger = log.New(logbuf, "", 0)
+	defer func() {
+		if logbuf.Len() > 0 {
+			logMutex.Lock()
+			log.Print(strings.TrimRight(logbuf.String(), "\n"))
+			logMutex.Unlock()
+		}
+	}()
+
+	if app.WkhtmltopdfCmd == "" {
+		app.WkhtmltopdfCmd = s.wkhtmltopdfCmd
+	}
+	app.Sandbox = true
+	app.MaxScriptMemory = s.MaxScriptMemory
+	app.AllowedHosts = s.AllowedHosts
+	app.openLibs()
+	app.LState.SetContext(ctx)
+
+	tp, err := s.loadRequest(app, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errServerTimeout
+		}
+		return nil, &requestError{err}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := app.renderTargetPdf(ctx, tp, buf); err != nil {
+		if err == ctx.Err() {
+			return nil, errServerTimeout
+		}
+		if e, ok := err.(*TargetPdfError); ok {
+			if _, ok := e.Err.(*ConfigError); ok {
+				return nil, &requestError{err}
+			}
+		}
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// loadRequest loads the request to the app and returns the pdf config to render.
+func (s *Server) loadRequest(app *App, req *RenderRequest) (*TargetPdf, error) {
+	if req.Script != "" {
+		return app.LoadScript(&Script{
+			Source:   req.Script,
+			Filename: "script",
+			Vars:     req.Vars,
+			Target:   req.Target,
+		})
+	}
+
+	page := map[string]interface{}{}
+	for k, v := range req.PageOptions {
+		page[k] = v
+	}
+	page["input_content"] = req.HTML
+
+	doc := &Document{
+		Name:    "request",
+		Options: req.Options,
+		Pages:   []map[string]interface{}{page},
+	}
+
+	if req.CoverHTML != "" {
+		doc.Cover = map[string]interface{}{"input_content": req.CoverHTML}
+	}
+
+	switch toc := req.TOC.(type) {
+	case nil:
+	case bool:
+		if toc {
+			doc.TOC = map[string]interface{}{}
+		}
+	case map[string]interface{}:
+		doc.TOC = toc
+	default:
+		return nil, fmt.Errorf("'toc' must be a boolean or an object")
+	}
+
+	return app.LoadDocument(doc)
+}
+
+// errLocalAccess is the error of the options that have the paths of the server.
+var errLocalAccess = errors.New("not allowed in the requests")
+
+// checkLocalAccess returns an error if the document reads or writes the files on the server.
+// The inputs must be contents or http(s) urls of the allowed hosts, and the options that have paths are rejected.
+// wkhtmltopdf is also told not to read the local files from the pages.
+func checkLocalAccess(doc *ResolvedDocument) error {
+	tp := doc.targetPdf
+	checkURL := func(url string) error {
+		if url == "" {
+			return nil
+		}
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return fmt.Errorf("'%s' is not allowed in the requests (http or https url expected)", url)
+		}
+		if !allowedHost(tp.App.AllowedHosts, url) {
+			return fmt.Errorf("'%s' is not allowed in the requests (the host is not allowed)", url)
+		}
+		return nil
+	}
+
+	if doc.Options.CookieJar != "" {
+		return tp.configError("options.cookie_jar", errLocalAccess)
+	}
+
+	parts := []*PageOptions{}
+	if doc.Cover != nil {
+		if err := checkURL(doc.Cover.Input); err != nil {
+			return doc.Cover.configError("input", err)
+		}
+		parts = append(parts, &doc.Cover.PageOptions)
+	}
+	for _, p := range doc.Pages {
+		if err := checkURL(p.Input); err != nil {
+			return p.configError("input", err)
+		}
+		for _, h := range []*HeaderFooter{p.Header, p.Footer} {
+			if h == nil {
+				continue
+			}
+			if err := checkURL(h.HTML); err != nil {
+				return h.configError("html", err)
+			}
+		}
+		parts = append(parts, &p.PageOptions)
+	}
+	if doc.TOC != nil {
+		if doc.TOC.XslStyleSheet != "" {
+			return doc.TOC.configError("xsl_style_sheet", errLocalAccess)
+		}
+		parts = append(parts, &doc.TOC.PageOptions)
+	}
+
+	for _, po := range parts {
+		paths := []struct {
+			key   string
+			value string
+		}{
+			{"cache_dir", po.CacheDir},
+			{"checkbox_checked_svg", po.CheckboxCheckedSvg},
+			{"checkbox_svg", po.CheckboxSvg},
+			{"radiobutton_checked_svg", po.RadiobuttonCheckedSvg},
+			{"radiobutton_svg", po.RadiobuttonSvg},
+			{"user_style_sheet", po.UserStyleSheet},
+		}
+		for _, p := range paths {
+			if p.value != "" {
+				return po.configError(p.key, errLocalAccess)
+			}
+		}
+		if len(po.Allow) > 0 {
+			return po.configError("allow", errLocalAccess)
+		}
+		if po.EnableLocalFileAccess {
+			return po.configError("enable_local_file_access", errLocalAccess)
+		}
+
+		po.DisableLocalFileAccess = true
+	}
+
+	return nil
+}
+
+// allowedHost reports whether the host of the url matches one of the hosts like "example.com" and "*.example.com".
+// Any host is allowed if the hosts are empty.
+func allowedHost(hosts []string, rawurl string) bool {
+	if len(hosts) == 0 {
+		return true
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	host := u.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if host == "" {
+		return false
+	}
+
+	for _, h := range hosts {
+		h = strings.ToLower(h)
+		if host == h || strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func statusOf(err error) int {
+	if _, ok := err.(*requestError); ok {
+		if strings.Contains(err.Error(), "request body too large") {
+			return http.StatusRequestEntityTooLarge
+		}
+		return http.StatusBadRequest
+	}
+
+	switch err {
+	case errServerBusy:
+		return http.StatusServiceUnavailable
+	case errServerTimeout:
+		return http.StatusGatewayTimeout
+	}
+
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,365 @@
+package html2pdf
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kohkimakimoto/html2pdf/support/testutil"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server, func()) {
+	tmpdir, wk := testutil.NewFakeWkhtmltopdf(t)
+
+	s := NewServer(func() *App {
+		app := NewApp()
+		app.Cachedir = tmpdir
+		app.CacheTmpdir = tmpdir
+		app.CacheBindir = tmpdir
+		app.WkhtmltopdfCmd = wk
+		return app
+	})
+	s.EnableScript = true
+	ts := httptest.NewServer(s.Handler())
+
+	return s, ts, func() {
+		ts.Close()
+		os.RemoveAll(tmpdir)
+	}
+}
+
+func postJSON(t *testing.T, url string, body string) (*http.Response, string) {
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, string(b)
+}
+
+func TestServerHealth(t *testing.T) {
+	_, ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	resp, err := http.Get(ts.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, but got %d", resp.StatusCode)
+	}
+}
+
+func TestServerRender(t *testing.T) {
+	s, ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	s.Timeout = time.Second
+
+	cases := []struct {
+		body     string
+		status   int
+		contains string
+	}{
+		{
+			body:     `{"html": "<h1>hello</h1>", "options": {"page_size": "A4"}, "page_options": {"footer": {"center": "[page]"}}, "toc": true}`,
+			status:   http.StatusOK,
+			contains: "--page-size A4 toc --disable-local-file-access page",
+		},
+		{
+			body:     `{"script": "pdf 'a.pdf' { options = { title = var.title }, pages = { input = 'https://example.com' } }", "vars": {"title": "report"}}`,
+			status:   http.StatusOK,
+			contains: "--title report page https://example.com --disable-local-file-access -",
+		},
+		{
+			body:     `{"script": "pdf 'a.pdf' { pages = { input = 'https://example.com/a' } } pdf 'b.pdf' { pages = { input = 'https://example.com/b' } }", "target": "b.pdf"}`,
+			status:   http.StatusOK,
+			contains: "page https://example.com/b --disable-local-file-access -",
+		},
+		{
+			body:     `{"script": "pdf 'a.pdf' { pages = { input = 'a.html' } } pdf 'b.pdf' { pages = { input = 'b.html' } }"}`,
+			status:   http.StatusBadRequest,
+			contains: "select one by the target",
+		},
+		{
+			body:     `{"script": "local html2pdf = require 'html2pdf' html2pdf.settings { wkhtmltopdf = '/bin/sh' } pdf 'a.pdf' { pages = { input = 'a.html' } }"}`,
+			status:   http.StatusBadRequest,
+			contains: "settings 'wkhtmltopdf' is not allowed in the sandbox",
+		},
+		{
+			body:     `{"script": "error('boom')"}`,
+			status:   http.StatusBadRequest,
+			contains: "boom",
+		},
+		{
+			body:     `{}`,
+			status:   http.StatusBadRequest,
+			contains: "'script' or 'html' is required",
+		},
+		{
+			body:     `{"html": "<h1>slow</h1>", "options": {"title": "sleep"}}`,
+			status:   http.StatusGatewayTimeout,
+			contains: "timed out",
+		},
+	}
+
+	for _, c := range cases {
+		resp, body := postJSON(t, ts.URL+"/render", c.body)
+		if resp.StatusCode != c.status {
+			t.Errorf("%s: expected status %d, but got %d: %s", c.body, c.status, resp.StatusCode, body)
+		}
+		if !strings.Contains(body, c.contains) {
+			t.Errorf("%s: expected body contains %q, but got %q", c.body, c.contains, body)
+		}
+	}
+}
+
+func TestServerRenderMultipart(t *testing.T) {
+	_, ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+	fw, err := mw.CreateFormFile("html", "index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("<h1>hello</h1>"))
+	mw.WriteField("options", `{"orientation": "Landscape"}`)
+	mw.Close()
+
+	resp, err := http.Post(ts.URL+"/render", mw.FormDataContentType(), buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, but got %d: %s", resp.StatusCode, b)
+	}
+	if !strings.Contains(string(b), "--orientation Landscape page") {
+		t.Errorf("unexpected pdf: %s", b)
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	s, ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	s.MaxRequestSize = 64
+	resp, body := postJSON(t, ts.URL+"/render", `{"html": "`+strings.Repeat("x", 100)+`"}`)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, but got %d: %s", resp.StatusCode, body)
+	}
+
+	s.MaxRequestSize = 1 << 20
+	s.EnableScript = false
+	resp, body = postJSON(t, ts.URL+"/render", `{"script": "pdf 'a.pdf' { pages = { input = 'https://example.com' } }"}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400, but got %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestServerSandbox(t *testing.T) {
+	_, ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	cases := []struct {
+		body     string
+		contains string
+	}{
+		{`{"script": "os.execute('touch /tmp/html2pdf_sandbox')"}`, "execute"},
+		{`{"script": "io.open('/etc/passwd')"}`, "open"},
+		{`{"script": "dofile('/etc/passwd')"}`, "attempt to call a non-function object"},
+		{`{"script": "require 'fs'"}`, "module fs not found"},
+		{`{"script": "require 'env'"}`, "module env not found"},
+		{`{"script": "pdf 'a.pdf' { pages = { input = '/etc/passwd' } }"}`, "invalid pages.input: '/etc/passwd' is not allowed in the requests"},
+		{`{"html": "<h1>hello</h1>", "options": {"cookie_jar": "/tmp/cookies.txt"}}`, "invalid options.cookie_jar: not allowed in the requests"},
+		{`{"html": "<h1>hello</h1>", "page_options": {"user_style_sheet": "/etc/passwd"}}`, "user_style_sheet: not allowed in the requests"},
+		{`{"html": "<h1>hello</h1>", "page_options": {"allow": ["/"]}}`, "allow: not allowed in the requests"},
+		{`{"html": "<h1>hello</h1>", "page_options": {"enable_local_file_access": true}}`, "enable_local_file_access: not allowed in the requests"},
+		{`{"html": "<h1>hello</h1>", "page_options": {"footer": {"html": "file:///etc/passwd"}}}`, "footer.html: 'file:///etc/passwd' is not allowed in the requests"},
+		{`{"html": "<h1>hello</h1>", "toc": {"xsl_style_sheet": "/tmp/toc.xsl"}}`, "invalid toc.xsl_style_sheet: not allowed in the requests"},
+		{`{"script": "require('html2pdf').settings { renderer = { 'sh', '-c', 'id' } }"}`, "settings 'renderer' is not allowed in the sandbox"},
+		{`{"script": "require('html2pdf').settings { jobs = 1000 }"}`, "settings 'jobs' is not allowed in the sandbox"},
+	}
+
+	for _, c := range cases {
+		resp, body := postJSON(t, ts.URL+"/render", c.body)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, but got %d: %s", c.body, resp.StatusCode, body)
+		}
+		if !strings.Contains(body, c.contains) {
+			t.Errorf("%s: expected body contains %q, but got %q", c.body, c.contains, body)
+		}
+	}
+
+	if _, err := os.Stat("/tmp/html2pdf_sandbox"); err == nil {
+		t.Error("the script ran a command")
+	}
+}
+
+func TestServerSandboxLimits(t *testing.T) {
+	s, ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	s.MaxScriptMemory = 16 << 20
+	s.AllowedHosts = []string{"example.com", "*.example.org"}
+
+	cases := []struct {
+		body     string
+		status   int
+		contains string
+	}{
+		{`{"script": "local t = {} for i = 1, 1e6 do t[i] = string.rep('x', 1e6) end"}`, http.StatusBadRequest, "the script exceeded the memory limit of 16777216 bytes"},
+		{`{"script": "local s = ('x'):rep(1e10)"}`, http.StatusBadRequest, "string.rep: the result is larger than 16777216 bytes"},
+		{`{"script": "pdf 'a.pdf' { pages = { input = 'https://example.com:8443/a' } }"}`, http.StatusOK, "page https://example.com:8443/a"},
+		{`{"script": "pdf 'a.pdf' { pages = { input = 'https://docs.example.org/a' } }"}`, http.StatusOK, "page https://docs.example.org/a"},
+		{`{"script": "pdf 'a.pdf' { pages = { input = 'http://169.254.169.254/latest' } }"}`, http.StatusBadRequest, "'http://169.254.169.254/latest' is not allowed in the requests (the host is not allowed)"},
+		{`{"script": "pdf 'a.pdf' { pages = { input = 'https://example.com@internal/a' } }"}`, http.StatusBadRequest, "the host is not allowed"},
+		{`{"script": "pdf 'a.pdf' { pages = { input = 'https://badexample.org/a' } }"}`, http.StatusBadRequest, "the host is not allowed"},
+		{`{"html": "<h1>hello</h1>", "page_options": {"header": {"html": "http://localhost/header.html"}}}`, http.StatusBadRequest, "header.html: 'http://localhost/header.html' is not allowed in the requests"},
+	}
+
+	for _, c := range cases {
+		resp, body := postJSON(t, ts.URL+"/render", c.body)
+		if resp.StatusCode != c.status {
+			t.Errorf("%s: expected status %d, but got %d: %s", c.body, c.status, resp.StatusCode, body)
+		}
+		if !strings.Contains(body, c.contains) {
+			t.Errorf("%s: expected body contains %q, but got %q", c.body, c.contains, body)
+		}
+	}
+}
+
+func TestServerJobs(t *testing.T) {
+	_, ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	resp, body := postJSON(t, ts.URL+"/jobs", `{"html": "<h1>hello</h1>"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, but got %d: %s", resp.StatusCode, body)
+	}
+
+	job := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(body), &job); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := job["id"].(string)
+	if id == "" {
+		t.Fatalf("no job id: %s", body)
+	}
+
+	if status := waitJob(t, ts.URL, id); status != jobDone {
+		t.Fatalf("job is not done: %s", status)
+	}
+
+	resp, err := http.Get(ts.URL + "/jobs/" + id + "/pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(string(b), "%PDF") {
+		t.Errorf("unexpected response %d: %s", resp.StatusCode, b)
+	}
+
+	resp, err = http.Get(ts.URL + "/jobs/unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, but got %d", resp.StatusCode)
+	}
+}
+
+func TestServerJobLimits(t *testing.T) {
+	s, ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	s.Timeout = time.Second
+	s.MaxPendingJobs = 1
+	s.MaxFinishedJobs = 1
+
+	// the slow job blocks the next one until it is finished.
+	slow := startJob(t, ts.URL, `{"html": "<h1>slow</h1>", "options": {"title": "sleep"}}`)
+	resp, body := postJSON(t, ts.URL+"/jobs", `{"html": "<h1>hello</h1>"}`)
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, but got %d: %s", resp.StatusCode, body)
+	}
+	if status := waitJob(t, ts.URL, slow); status != jobFailed {
+		t.Errorf("expected the slow job is failed, but got %s", status)
+	}
+
+	// only the last finished job is kept.
+	first := startJob(t, ts.URL, `{"html": "<h1>first</h1>"}`)
+	if status := waitJob(t, ts.URL, first); status != jobDone {
+		t.Fatalf("job is not done: %s", status)
+	}
+	second := startJob(t, ts.URL, `{"html": "<h1>second</h1>"}`)
+	if status := waitJob(t, ts.URL, second); status != jobDone {
+		t.Fatalf("job is not done: %s", status)
+	}
+
+	resp, err := http.Get(ts.URL + "/jobs/" + first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the first job is removed, but got %d", resp.StatusCode)
+	}
+}
+
+// startJob posts a job and returns the id.
+func startJob(t *testing.T, url string, body string) string {
+	resp, b := postJSON(t, url+"/jobs", body)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, but got %d: %s", resp.StatusCode, b)
+	}
+
+	job := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(b), &job); err != nil {
+		t.Fatal(err)
+	}
+
+	return job["id"].(string)
+}
+
+// waitJob waits for the job to be finished and returns the status.
+func waitJob(t *testing.T, url string, id string) string {
+	job := map[string]interface{}{}
+	for i := 0; i < 50; i++ {
+		resp, err := http.Get(url + "/jobs/" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewDecoder(resp.Body).Decode(&job)
+		resp.Body.Close()
+
+		if job["status"] == jobDone || job["status"] == jobFailed {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	status, _ := job["status"].(string)
+	return status
+}
@@ -0,0 +1,319 @@
+package html2pdf
+
+import (
+	"fmt"
+	"github.com/yuin/gopher-lua"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// targetPdfKeys are the keys that are available at the top level of a pdf config.
+var targetPdfKeys = []string{
+	"options",
+	"pages",
+	"cover",
+	"toc",
+	"header",
+	"footer",
+	"output_file",
+	"extends",
+	"depends_on",
+}
+
+// ConfigErrors has all the errors that are found in a pdf config by the strict validation.
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	msgs := []string{}
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// checkKeys rejects the unknown keys and the values of unexpected types in the pdf config.
+// gluamapper ignores the unknown keys, so a typo like "margin_tpo" would be ignored silently without it.
+func (tp *TargetPdf) checkKeys() error {
+	errs := ConfigErrors{}
+	check := func(path string, lv lua.LValue, typ reflect.Type) {
+		errs = append(errs, tp.checkTableKeys(path, lv, typ)...)
+	}
+
+	for _, key := range tp.valueKeys() {
+		if !contains(targetPdfKeys, key) && !contains(hookKeys, key) {
+			errs = append(errs, tp.unknownKeyError(key, key, append(append([]string{}, targetPdfKeys...), hookKeys...)))
+		}
+	}
+
+	// report a header on a cover or a toc by the reason instead of an unknown key.
+	for _, key := range []string{"cover", "toc"} {
+		if tb, ok := tp.value(key).(*lua.LTable); ok {
+			if err := tp.checkNoHeaderAndFooter(key, tb); err != nil {
+				return err
+			}
+		}
+	}
+
+	check("options", tp.value("options"), reflect.TypeOf(GlobalOptions{}))
+	check("cover", tp.value("cover"), reflect.TypeOf(Cover{}))
+	check("toc", tp.value("toc"), reflect.TypeOf(TOC{}))
+	check("header", tp.value("header"), reflect.TypeOf(HeaderFooter{}))
+	check("footer", tp.value("footer"), reflect.TypeOf(HeaderFooter{}))
+
+	if pagesTb, ok := tp.value("pages").(*lua.LTable); ok {
+		if pagesTb.MaxN() == 0 {
+			check("pages", pagesTb, reflect.TypeOf(Page{}))
+		} else {
+			for i := 1; i <= pagesTb.MaxN(); i++ {
+				check(fmt.Sprintf("pages[%d]", i), pagesTb.RawGetInt(i), reflect.TypeOf(Page{}))
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+
+	return errs
+}
+
+// checkTableKeys checks the keys and the types of the values in the table that is mapped to the struct type.
+// It doesn't check the value if it is not a table, because the error is reported when the value is mapped.
+func (tp *TargetPdf) checkTableKeys(path string, lv lua.LValue, typ reflect.Type) ConfigErrors {
+	tb, ok := lv.(*lua.LTable)
+	if !ok || tb.MaxN() != 0 {
+		return nil
+	}
+
+	fields := configFields(typ)
+	names := []string{}
+	for name := range fields {
+		names = append(names, name)
+	}
+
+	keys := []string{}
+	var keyErr *ConfigError
+	tb.ForEach(func(k, v lua.LValue) {
+		if key, ok := toString(k); ok {
+			keys = append(keys, key)
+		} else if keyErr == nil {
+			keyErr = tp.configError(path, fmt.Errorf("a key must be string, but got %s", k.Type()))
+		}
+	})
+	if keyErr != nil {
+		return ConfigErrors{keyErr}
+	}
+	sort.Strings(keys)
+
+	errs := ConfigErrors{}
+	for _, key := range keys {
+		keyPath := path + "." + key
+
+		f, ok := fields[key]
+		if !ok {
+			errs = append(errs, tp.unknownKeyError(keyPath, key, names))
+			continue
+		}
+
+		ft := f.Type
+		v := tb.RawGetString(key)
+		if err := checkValueType(ft, v); err != nil {
+			errs = append(errs, tp.configError(keyPath, err))
+			continue
+		}
+
+		if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct {
+			errs = append(errs, tp.checkTableKeys(keyPath, v, ft.Elem())...)
+		}
+	}
+
+	return errs
+}
+
+func (tp *TargetPdf) unknownKeyError(path string, key string, candidates []string) *ConfigError {
+	if s := suggestKey(key, candidates); s != "" {
+		return tp.configError(path, fmt.Errorf("unknown key (did you mean '%s'?)", s))
+	}
+
+	return tp.configError(path, fmt.Errorf("unknown key"))
+}
+
+// checkValueType checks the lua value can be mapped to the type like gluamapper does with the weakly typed input.
+func checkValueType(typ reflect.Type, lv lua.LValue) error {
+	if lv == lua.LNil {
+		return nil
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		switch lv.(type) {
+		case lua.LString, lua.LNumber:
+			return nil
+		}
+		return fmt.Errorf("string expected, but got %s", lv.Type())
+	case reflect.Bool:
+		switch v := lv.(type) {
+		case lua.LBool:
+			return nil
+		case lua.LString:
+			if _, err := strconv.ParseBool(string(v)); err == nil {
+				return nil
+			}
+			return fmt.Errorf("boolean expected, but got '%s'", v)
+		}
+		return fmt.Errorf("boolean expected, but got %s", lv.Type())
+	case reflect.Slice:
+		switch v := lv.(type) {
+		case lua.LString, lua.LNumber:
+			return nil
+		case *lua.LTable:
+			if k, _ := v.Next(lua.LNil); v.MaxN() == 0 && k != lua.LNil {
+				return fmt.Errorf("array of strings expected, but got table")
+			}
+			for i := 1; i <= v.MaxN(); i++ {
+				if err := checkValueType(typ.Elem(), v.RawGetInt(i)); err != nil {
+					return fmt.Errorf("array of strings expected, but [%d] is %s", i, v.RawGetInt(i).Type())
+				}
+			}
+			return nil
+		}
+		return fmt.Errorf("string or array of strings expected, but got %s", lv.Type())
+	case reflect.Map, reflect.Ptr:
+		if tb, ok := lv.(*lua.LTable); ok && tb.MaxN() == 0 {
+			return nil
+		}
+		return fmt.Errorf("table expected, but got %s", lvalueTypeName(lv))
+	}
+
+	return nil
+}
+
+// lvalueTypeName returns the type name of the lua value. An array table is "array".
+func lvalueTypeName(lv lua.LValue) string {
+	if tb, ok := lv.(*lua.LTable); ok && tb.MaxN() != 0 {
+		return "array"
+	}
+
+	return lv.Type().String()
+}
+
+// configFields returns the fields of the struct by their keys in a pdf config like "margin_top".
+// The embedded structs that have the squash tag are flattened like gluamapper.
+func configFields(typ reflect.Type) map[string]reflect.StructField {
+	ret := map[string]reflect.StructField{}
+
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag := f.Tag.Get("gluamapper")
+
+		if f.Anonymous && strings.Contains(tag, "squash") {
+			for k, t := range configFields(f.Type) {
+				ret[k] = t
+			}
+			continue
+		}
+		if f.PkgPath != "" || tag == "-" {
+			// unexported
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = snakeCase(f.Name)
+		}
+		ret[name] = f
+	}
+
+	return ret
+}
+
+// snakeCase converts a Go field name to a key in a pdf config like "HTMLContent" to "html_content".
+func snakeCase(s string) string {
+	rs := []rune(s)
+	ret := []rune{}
+
+	for i, r := range rs {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(rs[i-1])
+			nextLower := i+1 < len(rs) && unicode.IsLower(rs[i+1])
+			if prevLower || (unicode.IsUpper(rs[i-1]) && nextLower) {
+				ret = append(ret, '_')
+			}
+		}
+		ret = append(ret, unicode.ToLower(r))
+	}
+
+	return string(ret)
+}
+
+// suggestKey returns the closest key in the candidates, or "" if no key is close enough.
+func suggestKey(key string, candidates []string) string {
+	best := ""
+	bestDistance := len(key)/3 + 2
+
+	sorted := append([]string{}, candidates...)
+	sort.Strings(sorted)
+	for _, c := range sorted {
+		if d := editDistance(key, c); d < bestDistance {
+			best = c
+			bestDistance = d
+		}
+	}
+	if best != "" {
+		return best
+	}
+
+	// a shortened key like "toc_header" for "toc_header_text".
+	for _, c := range sorted {
+		if len(key) >= 3 && strings.HasPrefix(c, key) {
+			return c
+		}
+	}
+
+	return ""
+}
+
+// editDistance returns the Damerau-Levenshtein distance (optimal string alignment) that counts a transposition as one edit.
+func editDistance(a string, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := 0; j <= len(b); j++ {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min3(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+
+	return d[len(a)][len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+
+	return a
+}
@@ -0,0 +1,109 @@
+package html2pdf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStrictErrors(t *testing.T) {
+	cases := []struct {
+		script string
+		err    string
+	}{
+		{
+			script: `pdf "a.pdf" { pags = { input = "a.html" } }`,
+			err:    "'a.pdf' invalid pags: unknown key (did you mean 'pages'?)",
+		},
+		{
+			script: `pdf "a.pdf" { options = { margin_tpo = "10mm" }, pages = { input = "a.html" } }`,
+			err:    "invalid options.margin_tpo: unknown key (did you mean 'margin_top'?)",
+		},
+		{
+			script: `pdf "a.pdf" { pages = { { input = "a.html" }, { input = "b.html", zooom = "2" } } }`,
+			err:    "invalid pages[2].zooom: unknown key (did you mean 'zoom'?)",
+		},
+		{
+			script: `pdf "a.pdf" { pages = { input = "a.html", footer = { centre = "[page]" } } }`,
+			err:    "invalid pages.footer.centre: unknown key (did you mean 'center'?)",
+		},
+		{
+			script: `pdf "a.pdf" { cover = { inptu = "a.html" }, toc = { toc_header = "x" }, pages = { input = "a.html" } }`,
+			err:    "invalid cover.inptu: unknown key (did you mean 'input'?)\n<string>:1: 'a.pdf' invalid toc.toc_header: unknown key (did you mean 'toc_header_text'?)",
+		},
+		{
+			script: `pdf "a.pdf" { pages = { input = "a.html", xyz = 1 } }`,
+			err:    "invalid pages.xyz: unknown key",
+		},
+		{
+			script: `pdf "a.pdf" { options = { grayscale = { true } }, pages = { input = "a.html" } }`,
+			err:    "invalid options.grayscale: boolean expected, but got table",
+		},
+		{
+			script: `pdf "a.pdf" { options = { title = true }, pages = { input = "a.html" } }`,
+			err:    "invalid options.title: string expected, but got boolean",
+		},
+		{
+			script: `pdf "a.pdf" { pages = { input = "a.html", allow = { a = "b" } } }`,
+			err:    "invalid pages.allow: array of strings expected, but got table",
+		},
+		{
+			script: `pdf "a.pdf" { pages = { input = "a.html", cookies = { "a" } } }`,
+			err:    "invalid pages.cookies: table expected, but got array",
+		},
+	}
+
+	for _, c := range cases {
+		app := newTestApp(t)
+
+		if err := app.LoadRecipe(c.script); err != nil {
+			t.Errorf("%s: %v", c.script, err)
+			closeTestApp(app)
+			continue
+		}
+
+		_, err := argsOf(app)
+		closeTestApp(app)
+		if err == nil {
+			t.Errorf("%s: expected error", c.script)
+		} else if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error contains %q, but got %q", c.script, c.err, err.Error())
+		}
+	}
+}
+
+func TestStrictOptOut(t *testing.T) {
+	scripts := []string{
+		`local html2pdf = require "html2pdf"
+html2pdf.settings { strict = false }
+pdf "a.pdf" { pags = { input = "a.html" }, options = { margin_tpo = "10mm" } }`,
+		`pdf "a.pdf" { pages = { input = "a.html", allow = "/a", grayscale_ = nil, no_background = "true" } }`,
+	}
+
+	for _, script := range scripts {
+		app := newTestApp(t)
+
+		if err := app.LoadRecipe(script); err != nil {
+			t.Errorf("%s: %v", script, err)
+		} else if _, err := argsOf(app); err != nil {
+			t.Errorf("%s: unexpected error %v", script, err)
+		}
+
+		closeTestApp(app)
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	cases := map[string]string{
+		"HTMLContent":         "html_content",
+		"HTML":                "html",
+		"TocLevelIndentation": "toc_level_indentation",
+		"Dpi":                 "dpi",
+		"NoPdfCompression":    "no_pdf_compression",
+	}
+
+	for in, expected := range cases {
+		if actual := snakeCase(in); actual != expected {
+			t.Errorf("%s: expected %s, but got %s", in, expected, actual)
+		}
+	}
+}
@@ -1,83 +1,286 @@
 package html2pdf
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/SebastiaanKlippert/go-wkhtmltopdf"
 	"github.com/kohkimakimoto/html2pdf/support/color"
 	"github.com/kohkimakimoto/html2pdf/support/gluamapper"
 	"github.com/kohkimakimoto/loglv"
 	"github.com/yuin/gopher-lua"
+	"io"
+	"io/ioutil"
 	"log"
-	"strconv"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 type TargetPdf struct {
-	Name          string
-	LValues       map[string]lua.LValue
-	App           *App
+	Name    string
+	LValues map[string]lua.LValue
+	App     *App
+	// Source is the location like "build.lua:12" where the pdf config is defined. It is empty if it is not defined by lua.
+	Source string
+	// sources are the locations where the keys are set.
+	sources map[string]string
+	// defaults are the values of html2pdf.defaults when the pdf config is registered.
+	defaults map[string]lua.LValue
+	// extended is the pdf config that is extended by the extend method.
+	extended *TargetPdf
+	// logger outputs the logs of the pdf config. The standard logger is used if it is nil.
+	logger *log.Logger
 }
 
 func NewTargetPdf(name string, app *App) *TargetPdf {
-	return &TargetPdf{
-		Name:          name,
-		LValues:       map[string]lua.LValue{},
-		App:           app,
+	tp := &TargetPdf{
+		Name:    name,
+		LValues: map[string]lua.LValue{},
+		App:     app,
+		sources: map[string]string{},
 	}
+
+	tp.defaults = map[string]lua.LValue{}
+	for k, v := range app.defaults {
+		tp.defaults[k] = v
+	}
+
+	return tp
+}
+
+// ConfigError is an error of a value in a pdf config.
+type ConfigError struct {
+	// Target is the name of the pdf config. It is empty if the config is not registered like a validated file.
+	Target string
+	// Path is the key path of the value like "pages[3].page_offset".
+	Path string
+	// Source is the location like "build.lua:12" where the value is set. It may be empty.
+	Source string
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	msg := fmt.Sprintf("invalid %s: %v", e.Path, e.Err)
+	if e.Target != "" {
+		msg = fmt.Sprintf("'%s' %s", e.Target, msg)
+	}
+	if e.Source != "" {
+		msg = e.Source + ": " + msg
+	}
+
+	return msg
 }
 
+// configError returns a ConfigError of the key path.
+// The source is the location where the top level key is set, or where the pdf config is defined.
+func (tp *TargetPdf) configError(path string, err error) *ConfigError {
+	top := path
+	if i := strings.IndexAny(path, ".["); i >= 0 {
+		top = path[:i]
+	}
+
+	source := tp.sources[top]
+	if source == "" {
+		source = tp.Source
+	}
+
+	return &ConfigError{Target: tp.Name, Path: path, Source: source, Err: err}
+}
+
+// Run renders the pdf and writes it to the output_file. The hooks are not called and the pdf is always built.
 func (tp *TargetPdf) Run() error {
-	log.Print(color.FgBold(fmt.Sprintf("==> Processing: %s", tp.Name)))
-	log.Print(fmt.Sprintf("    output_file: %s", tp.OutputFile()))
+	tp.logf(color.FgBold(fmt.Sprintf("==> Processing: %s", tp.Name)))
+	tp.logf("    output_file: %s", tp.OutputFile())
 
-	wkhtmltopdf.SetPath(tp.App.WkhtmltopdfCmd)
-	pdfg, err := wkhtmltopdf.NewPDFGenerator()
+	doc, err := tp.Resolve()
 	if err != nil {
 		return err
 	}
 
-	// parse global options
-	globaOptions := &GlobalOptions{}
-	if options, ok := tp.LValues["options"]; ok {
-		if opttb, ok := options.(*lua.LTable); ok {
-			if err := gluamapper.Map(opttb, globaOptions); err != nil {
-				return err
-			}
+	p, err := tp.App.prepareRender(doc)
+	if err != nil {
+		return err
+	}
+
+	_, err = tp.build(doc, p)
+	return err
+}
+
+// build renders the document by the prepared render and writes it to the output_file.
+func (tp *TargetPdf) build(doc *ResolvedDocument, p *preparedRender) (*BuildResult, error) {
+	start := time.Now()
+
+	pdf, err := p.render(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(pdf)
+
+	if doc.OutputFile == "-" {
+		if _, err := tp.App.Stdout.Write(buf.Bytes()); err != nil {
+			return nil, err
 		}
+	} else if err := ioutil.WriteFile(doc.OutputFile, buf.Bytes(), 0666); err != nil {
+		return nil, err
+	}
+
+	return &BuildResult{
+		OutputFile: doc.OutputFile,
+		Size:       buf.Len(),
+		Duration:   time.Since(start),
+		Pages:      countPdfPages(buf.Bytes()),
+	}, nil
+}
+
+// Render renders the pdf by the renderer of the app and writes it to w. The output_file is not used.
+// The renderer is stopped if the ctx is done, and ctx.Err() is returned.
+func (tp *TargetPdf) Render(ctx context.Context, w io.Writer) error {
+	doc, err := tp.Resolve()
+	if err != nil {
+		return err
+	}
+
+	return tp.render(ctx, doc, w)
+}
+
+func (tp *TargetPdf) render(ctx context.Context, doc *ResolvedDocument, w io.Writer) error {
+	pdf, err := tp.App.renderer().Render(ctx, doc)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(pdf)
+	return err
+}
+
+// WkhtmltopdfError is an error that wkhtmltopdf exited with.
+type WkhtmltopdfError struct {
+	// Args are the args of wkhtmltopdf. The secrets are masked.
+	Args   []string
+	Stderr string
+	Err    error
+}
+
+func (e *WkhtmltopdfError) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("wkhtmltopdf failed: %v: %s", e.Err, e.Stderr)
+	}
+
+	return fmt.Sprintf("wkhtmltopdf failed: %v", e.Err)
+}
+
+// wkhtmltopdf.SetPath sets the path to the package global variable.
+var wkhtmltopdfMutex sync.Mutex
+
+func newPDFGenerator(cmd string) (*wkhtmltopdf.PDFGenerator, error) {
+	wkhtmltopdfMutex.Lock()
+	defer wkhtmltopdfMutex.Unlock()
+
+	wkhtmltopdf.SetPath(cmd)
+	return wkhtmltopdf.NewPDFGenerator()
+}
+
+// WkhtmltopdfArgs returns the wkhtmltopdf args of the pdf config.
+func (tp *TargetPdf) WkhtmltopdfArgs() ([]string, error) {
+	doc, err := tp.Resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	return newWkhtmltopdfArgs(tp.App.WkhtmltopdfCmd, doc)
+}
+
+// newWkhtmltopdfArgs returns the args of the wkhtmltopdf command that is configured by the document.
+// The args are built by go-wkhtmltopdf, and the contents like input_content are written to temporary files.
+func newWkhtmltopdfArgs(cmd string, doc *ResolvedDocument) ([]string, error) {
+	tp := doc.targetPdf
+
+	pdfg, err := newPDFGenerator(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// lengths are the length options that go-wkhtmltopdf only takes as whole millimeters.
+	// They are set to 0 in the PDFGenerator, and replaced by the lengths with the unit in the args.
+	lengths := map[string]string{}
+
+	globaOptions := doc.Options
+
+	// uintOption and lengthOption parse the global options and report the errors with the key.
+	uintOption := func(key string, str string, set func(uint)) error {
+		v, err := parseUint(str)
+		if err != nil {
+			return tp.configError("options."+key, err)
+		}
+		set(v)
+		return nil
+	}
+	lengthOption := func(key string, str string, set func(uint)) error {
+		v, err := lengthArg(str)
+		if err != nil {
+			return tp.configError("options."+key, err)
+		}
+		set(0)
+		lengths["--"+strings.Replace(key, "_", "-", -1)] = v
+		return nil
 	}
 
 	// gloabal options
-	if globaOptions.CookieJar != "" {
-		pdfg.CookieJar.Set(globaOptions.CookieJar)
+	cookieJar, err := tp.CookieJarFile(globaOptions.CookieJar)
+	if err != nil {
+		return nil, err
+	}
+	if cookieJar != "" {
+		pdfg.CookieJar.Set(cookieJar)
 	}
 	if globaOptions.Copies != "" {
-		pdfg.Copies.Set(parseUint(globaOptions.Copies))
+		if err := uintOption("copies", globaOptions.Copies, pdfg.Copies.Set); err != nil {
+			return nil, err
+		}
 	}
 	if globaOptions.Dpi != "" {
-		pdfg.Dpi.Set(parseUint(globaOptions.Dpi))
+		if err := uintOption("dpi", globaOptions.Dpi, pdfg.Dpi.Set); err != nil {
+			return nil, err
+		}
 	}
 	if globaOptions.Grayscale {
 		pdfg.Grayscale.Set(globaOptions.Grayscale)
 	}
 	if globaOptions.ImageDpi != "" {
-		pdfg.ImageDpi.Set(parseUint(globaOptions.ImageDpi))
+		if err := uintOption("image_dpi", globaOptions.ImageDpi, pdfg.ImageDpi.Set); err != nil {
+			return nil, err
+		}
 	}
 	if globaOptions.ImageQuality != "" {
-		pdfg.ImageQuality.Set(parseUint(globaOptions.ImageQuality))
+		if err := uintOption("image_quality", globaOptions.ImageQuality, pdfg.ImageQuality.Set); err != nil {
+			return nil, err
+		}
 	}
 	if globaOptions.Lowquality {
 		pdfg.Lowquality.Set(globaOptions.Lowquality)
 	}
 	if globaOptions.MarginBottom != "" {
-		pdfg.MarginBottom.Set(parseUint(globaOptions.MarginBottom))
+		if err := lengthOption("margin_bottom", globaOptions.MarginBottom, pdfg.MarginBottom.Set); err != nil {
+			return nil, err
+		}
 	}
 	if globaOptions.MarginLeft != "" {
-		pdfg.MarginLeft.Set(parseUint(globaOptions.MarginLeft))
+		if err := lengthOption("margin_left", globaOptions.MarginLeft, pdfg.MarginLeft.Set); err != nil {
+			return nil, err
+		}
 	}
 	if globaOptions.MarginRight != "" {
-		pdfg.MarginRight.Set(parseUint(globaOptions.MarginRight))
+		if err := lengthOption("margin_right", globaOptions.MarginRight, pdfg.MarginRight.Set); err != nil {
+			return nil, err
+		}
 	}
 	if globaOptions.MarginTop != "" {
-		pdfg.MarginTop.Set(parseUint(globaOptions.MarginTop))
+		if err := lengthOption("margin_top", globaOptions.MarginTop, pdfg.MarginTop.Set); err != nil {
+			return nil, err
+		}
 	}
 	if globaOptions.Orientation != "" {
 		pdfg.Orientation.Set(globaOptions.Orientation)
@@ -86,13 +289,17 @@ func (tp *TargetPdf) Run() error {
 		pdfg.NoCollate.Set(globaOptions.NoCollate)
 	}
 	if globaOptions.PageHeight != "" {
-		pdfg.MarginLeft.Set(parseUint(globaOptions.PageHeight))
+		if err := lengthOption("page_height", globaOptions.PageHeight, pdfg.PageHeight.Set); err != nil {
+			return nil, err
+		}
 	}
 	if globaOptions.PageSize != "" {
 		pdfg.PageSize.Set(globaOptions.PageSize)
 	}
 	if globaOptions.PageWidth != "" {
-		pdfg.PageWidth.Set(parseUint(globaOptions.PageWidth))
+		if err := lengthOption("page_width", globaOptions.PageWidth, pdfg.PageWidth.Set); err != nil {
+			return nil, err
+		}
 	}
 	if globaOptions.NoPdfCompression {
 		pdfg.NoPdfCompression.Set(globaOptions.NoPdfCompression)
@@ -106,58 +313,121 @@ func (tp *TargetPdf) Run() error {
 		pdfg.NoOutline.Set(globaOptions.NoOutline)
 	}
 	if globaOptions.OutlineDepth != "" {
-		pdfg.OutlineDepth.Set(parseUint(globaOptions.OutlineDepth))
-	}
-	
-	// add cover
-	cover, err := tp.Cover()
-	if err != nil {
-		return err
+		if err := uintOption("outline_depth", globaOptions.OutlineDepth, pdfg.OutlineDepth.Set); err != nil {
+			return nil, err
+		}
 	}
-	if cover != nil {
-		pdfg.Cover.Input = cover.InputFile()
 
-		if cover.Encoding != "" {
-			pdfg.Cover.Encoding.Set(cover.Encoding)
-		}
-		if cover.PageOffset != "" {
-			pdfg.Cover.PageOffset.Set(parseUint(cover.PageOffset))
+	// add cover
+	if cover := doc.Cover; cover != nil {
+		input, err := cover.InputFile()
+		if err != nil {
+			return nil, err
 		}
-		if style := cover.UserStyleSheetFile(); style != "" {
-			pdfg.Cover.UserStyleSheet.Set(style)
+		pdfg.Cover.Input = input
+
+		if err := cover.PageOptions.apply(coverSetters(pdfg)); err != nil {
+			return nil, err
 		}
 	}
 
 	// add pages
-	pages, err := tp.Pages()
-	if err != nil {
-		return err
-	}
-	if pages != nil && len(pages) > 0 {
-		for _, p := range pages {
-			page := wkhtmltopdf.NewPage(p.InputFile())
+	for _, p := range doc.Pages {
+		input, err := p.InputFile()
+		if err != nil {
+			return nil, err
+		}
+		page := wkhtmltopdf.NewPage(input)
+
+		if err := p.PageOptions.apply(pageSetters(&page.PageOptions)); err != nil {
+			return nil, err
+		}
 
-			if p.Encoding != "" {
-				page.Encoding.Set(p.Encoding)
+		// header options
+		if h := p.Header; h != nil {
+			if h.Left != "" {
+				page.HeaderLeft.Set(h.Left)
 			}
-			if p.PageOffset != "" {
-				page.PageOffset.Set(parseUint(p.PageOffset))
+			if h.Center != "" {
+				page.HeaderCenter.Set(h.Center)
 			}
-			if style := p.UserStyleSheetFile(); style != "" {
-				page.UserStyleSheet.Set(style)
+			if h.Right != "" {
+				page.HeaderRight.Set(h.Right)
+			}
+			if h.FontName != "" {
+				page.HeaderFontName.Set(h.FontName)
+			}
+			if h.FontSize != "" {
+				v, err := parseUint(h.FontSize)
+				if err != nil {
+					return nil, h.configError("font_size", err)
+				}
+				page.HeaderFontSize.Set(v)
+			}
+			if h.Spacing != "" {
+				v, err := parseLength(h.Spacing)
+				if err != nil {
+					return nil, h.configError("spacing", err)
+				}
+				page.HeaderSpacing.Set(v)
 			}
+			if h.Line {
+				page.HeaderLine.Set(h.Line)
+			}
+			html, err := h.HTMLFile()
+			if err != nil {
+				return nil, err
+			}
+			if html != "" {
+				page.HeaderHTML.Set(html)
+			}
+		}
 
-			pdfg.AddPage(page)
+		// footer options
+		if f := p.Footer; f != nil {
+			if f.Left != "" {
+				page.FooterLeft.Set(f.Left)
+			}
+			if f.Center != "" {
+				page.FooterCenter.Set(f.Center)
+			}
+			if f.Right != "" {
+				page.FooterRight.Set(f.Right)
+			}
+			if f.FontName != "" {
+				page.FooterFontName.Set(f.FontName)
+			}
+			if f.FontSize != "" {
+				v, err := parseUint(f.FontSize)
+				if err != nil {
+					return nil, f.configError("font_size", err)
+				}
+				page.FooterFontSize.Set(v)
+			}
+			if f.Spacing != "" {
+				v, err := parseLength(f.Spacing)
+				if err != nil {
+					return nil, f.configError("spacing", err)
+				}
+				page.FooterSpacing.Set(v)
+			}
+			if f.Line {
+				page.FooterLine.Set(f.Line)
+			}
+			html, err := f.HTMLFile()
+			if err != nil {
+				return nil, err
+			}
+			if html != "" {
+				page.FooterHTML.Set(html)
+			}
 		}
-	}
 
-	// add TOC
-	toc, err := tp.TOC()
-	if err != nil {
-		return err
+		pdfg.AddPage(page)
 	}
 
-	if cover != nil {
+	// add TOC
+	if toc := doc.TOC; toc != nil {
 		pdfg.TOC.Include = true
 
 		if toc.DisableDottedLines {
@@ -170,35 +440,202 @@ func (tp *TargetPdf) Run() error {
 			pdfg.TOC.TocHeaderText.Set(toc.TocHeaderText)
 		}
 		if toc.TocLevelIndentation != "" {
-			pdfg.TOC.TocLevelIndentation.Set(parseUint(toc.TocLevelIndentation))
+			v, err := parseIndentation(toc.TocLevelIndentation)
+			if err != nil {
+				return nil, tp.configError("toc.toc_level_indentation", err)
+			}
+			pdfg.TOC.TocLevelIndentation.Set(0)
+			lengths["--toc-level-indentation"] = v
 		}
-		if toc.Encoding != "" {
-			pdfg.TOC.Encoding.Set(toc.Encoding)
+		if toc.TocTextSizeShrink != "" {
+			v, err := parseFloat(toc.TocTextSizeShrink)
+			if err != nil {
+				return nil, tp.configError("toc.toc_text_size_shrink", err)
+			}
+			pdfg.TOC.TocTextSizeShrink.Set(v)
 		}
-		if toc.PageOffset != "" {
-			pdfg.TOC.PageOffset.Set(parseUint(toc.PageOffset))
+		if toc.XslStyleSheet != "" {
+			pdfg.TOC.XslStyleSheet.Set(toc.XslStyleSheet)
 		}
-		if style := toc.UserStyleSheetFile(); style != "" {
-			pdfg.TOC.UserStyleSheet.Set(style)
+
+		if err := toc.PageOptions.apply(tocSetters(pdfg)); err != nil {
+			return nil, err
 		}
+	}
 
+	args := setLengthArgs(wkhtmltopdfArgs(pdfg), lengths)
+	if err := tp.checkWkhtmltopdfSupport(cmd, args); err != nil {
+		return nil, err
+	}
+
+	return args, nil
+}
+
+// secretArgs is the wkhtmltopdf options that have secrets, and the number of their values.
+var secretArgs = map[string]int{
+	"--password":      1,
+	"--cookie":        2,
+	"--custom-header": 2,
+	"--post":          2,
+}
+
+// maskArgs hides the secrets in wkhtmltopdf args to output them to logs.
+// It masks the password and the values of cookies, custom headers and post fields, but leaves their names.
+func maskArgs(args []string) []string {
+	ret := make([]string, len(args))
+	copy(ret, args)
+
+	for i := 0; i < len(ret); i++ {
+		n, ok := secretArgs[ret[i]]
+		if !ok {
+			continue
+		}
+
+		i += n
+		if i < len(ret) {
+			ret[i] = "******"
+		}
+	}
+
+	return ret
+}
+
+// setLengthArgs replaces the values of the options in the args by the lengths in place.
+func setLengthArgs(args []string, lengths map[string]string) []string {
+	for i := 0; i+1 < len(args); i++ {
+		if v, ok := lengths[args[i]]; ok {
+			args[i+1] = v
+			i++
+		}
+	}
+
+	return args
+}
+
+// mapArgs is the wkhtmltopdf options that take a name and a value.
+var mapArgs = map[string]bool{
+	"--cookie":        true,
+	"--custom-header": true,
+	"--post":          true,
+}
+
+// wkhtmltopdfArgs returns the args of the PDFGenerator.
+// go-wkhtmltopdf outputs the options like cookies in the order of a map, so they are sorted by the names to make the args stable.
+func wkhtmltopdfArgs(pdfg *wkhtmltopdf.PDFGenerator) []string {
+	return sortMapArgs(pdfg.Args())
+}
+
+// sortMapArgs sorts the runs of the same option of mapArgs by the names in place.
+func sortMapArgs(args []string) []string {
+	for i := 0; i < len(args); i++ {
+		if !mapArgs[args[i]] {
+			continue
+		}
+
+		// a run of the same option, like "--cookie a 1 --cookie b 2".
+		end := i
+		for end+2 < len(args) && args[end] == args[i] {
+			end += 3
+		}
+		if end == i {
+			break
+		}
+
+		triples := [][]string{}
+		for j := i; j < end; j += 3 {
+			triples = append(triples, []string{args[j], args[j+1], args[j+2]})
+		}
+		sort.SliceStable(triples, func(a, b int) bool { return triples[a][1] < triples[b][1] })
+		for n, t := range triples {
+			copy(args[i+n*3:], t)
+		}
+
+		i = end - 1
+	}
+
+	return args
+}
+
+// CookieJarFile returns the cookie jar file that wkhtmltopdf uses.
+// If the cookies are set by the http lua module, they are written to the file.
+// When the config doesn't have 'cookie_jar', a temporary file is used.
+func (tp *TargetPdf) CookieJarFile(cookieJar string) (string, error) {
+	jar := tp.App.CookieJar
+	if jar == nil || jar.Len() == 0 {
+		return cookieJar, nil
+	}
+
+	if cookieJar == "" {
+		t, err := tp.CreateTempCookieJarfile()
+		if err != nil {
+			return "", err
+		}
+		cookieJar = t
+	}
+
+	if err := jar.WriteFile(cookieJar); err != nil {
+		return "", tp.configError("options.cookie_jar", fmt.Errorf("failed to write cookies to '%s': %v", cookieJar, err))
 	}
 
 	if loglv.IsDebug() {
-		log.Printf("    (Debug) wkhtmltopdf args: %s", pdfg.Args())
+		tp.logf("    (Debug) wrote %d cookies to the cookie jar: %s", jar.Len(), cookieJar)
 	}
 
-	err = pdfg.Create()
-	if err != nil {
-		return err
+	return cookieJar, nil
+}
+
+// LocalFiles returns the absolute paths of the local files that the pdf config reads,
+// like inputs, user style sheets and html of headers and footers.
+func (tp *TargetPdf) LocalFiles() []string {
+	files := []string{}
+
+	if cover, err := tp.Cover(); err == nil && cover != nil {
+		files = append(files, cover.Input, cover.UserStyleSheet)
+	}
+	if toc, err := tp.TOC(); err == nil && toc != nil {
+		files = append(files, toc.UserStyleSheet, toc.XslStyleSheet)
+	}
+	if pages, err := tp.Pages(); err == nil {
+		for _, p := range pages {
+			files = append(files, p.Input, p.UserStyleSheet)
+			if p.Header != nil {
+				files = append(files, p.Header.HTML)
+			}
+			if p.Footer != nil {
+				files = append(files, p.Footer.HTML)
+			}
+		}
 	}
 
-	err = pdfg.WriteFile(tp.OutputFile())
-	if err != nil {
-		return err
+	ret := []string{}
+	for _, f := range files {
+		if f == "" || f == "-" {
+			continue
+		}
+		if strings.HasPrefix(f, "file://") {
+			f = strings.TrimPrefix(f, "file://")
+		} else if strings.Contains(f, "://") {
+			continue
+		}
+		if abs, err := filepath.Abs(f); err == nil {
+			f = abs
+		}
+		if !contains(ret, f) {
+			ret = append(ret, f)
+		}
 	}
 
-	return nil
+	return ret
+}
+
+// ConfigString returns the string representation of the config to detect the changes.
+func (tp *TargetPdf) ConfigString() string {
+	tb := &lua.LTable{}
+	for _, k := range tp.valueKeys() {
+		tb.RawSetString(k, tp.value(k))
+	}
+
+	return lvalueString(tb)
 }
 
 func (tp *TargetPdf) OutputFile() string {
@@ -212,8 +649,8 @@ func (tp *TargetPdf) OutputFile() string {
 func (tp *TargetPdf) Pages() ([]*Page, error) {
 	ret := []*Page{}
 
-	pages, ok := tp.LValues["pages"]
-	if !ok {
+	pages := tp.value("pages")
+	if pages == lua.LNil {
 		return ret, nil
 	}
 	pagesTb, ok := pages.(*lua.LTable)
@@ -223,235 +660,342 @@ func (tp *TargetPdf) Pages() ([]*Page, error) {
 
 	maxn := pagesTb.MaxN()
 	if maxn == 0 { // table
-		p := &Page{}
-		p.targetPdf = tp
-		if err := gluamapper.Map(pagesTb, p); err != nil {
+		p, err := tp.page("pages", pagesTb)
+		if err != nil {
 			return nil, err
 		}
 
 		ret = append(ret, p)
 	} else {
 		// array
-		pagesTb.ForEach(func(k, v lua.LValue) {
-			if lp, ok := v.(*lua.LTable); ok {
-				p := &Page{}
-				p.targetPdf = tp
+		for i := 1; i <= maxn; i++ {
+			path := fmt.Sprintf("pages[%d]", i)
 
-				if err := gluamapper.Map(lp, p); err != nil {
-					panic(err)
-				}
+			lp, ok := pagesTb.RawGetInt(i).(*lua.LTable)
+			if !ok {
+				return nil, tp.configError(path, fmt.Errorf("table expected, but got %s", pagesTb.RawGetInt(i).Type()))
+			}
+			if lp.MaxN() != 0 {
+				return nil, tp.configError(path, fmt.Errorf("pages can't support nested array table"))
+			}
 
-				ret = append(ret, p)
-			} else {
-				panic(fmt.Sprintf("'%s' invalid data format: pages can't support nested array table.", tp.Name))
+			p, err := tp.page(path, lp)
+			if err != nil {
+				return nil, err
+			}
+
+			ret = append(ret, p)
+		}
+	}
+
+	return ret, nil
+}
+
+func (tp *TargetPdf) page(path string, tb *lua.LTable) (*Page, error) {
+	p := &Page{}
+	p.targetPdf = tp
+	p.path = path
+
+	if err := gluamapper.Map(tb, p); err != nil {
+		return nil, tp.configError(path, err)
+	}
+	if p.Input == "" && p.InputContent == "" {
+		return nil, tp.configError(path, fmt.Errorf("page must have 'input' or 'input_content'"))
+	}
+	if err := p.setupNameValues(tb); err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if err := tp.setupHeaderAndFooter(p, tb); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// setupHeaderAndFooter sets the header and footer of the page.
+// The pdf level 'header' and 'footer' are used as defaults and the page level ones override them by each key.
+func (tp *TargetPdf) setupHeaderAndFooter(p *Page, pageTb *lua.LTable) error {
+	header, err := tp.headerFooter("header", p.path, pageTb)
+	if err != nil {
+		return err
+	}
+	p.Header = header
+
+	footer, err := tp.headerFooter("footer", p.path, pageTb)
+	if err != nil {
+		return err
+	}
+	p.Footer = footer
+
+	return nil
+}
+
+func (tp *TargetPdf) headerFooter(key string, pagePath string, pageTb *lua.LTable) (*HeaderFooter, error) {
+	var ret *HeaderFooter
+
+	levels := []struct {
+		path string
+		lv   lua.LValue
+	}{
+		{key, tp.value(key)},
+		{pagePath + "." + key, pageTb.RawGetString(key)},
+	}
+
+	for _, level := range levels {
+		if level.lv == nil || level.lv == lua.LNil {
+			continue
+		}
+
+		tb, ok := level.lv.(*lua.LTable)
+		if !ok || tb.MaxN() != 0 {
+			return nil, tp.configError(level.path, fmt.Errorf("%s only support table", key))
+		}
+
+		if ret == nil {
+			ret = &HeaderFooter{}
+			ret.targetPdf = tp
+			ret.paths = map[string]string{}
+		}
+
+		if err := gluamapper.Map(tb, ret); err != nil {
+			return nil, tp.configError(level.path, err)
+		}
+
+		// remember which level each key comes from to report the errors.
+		tb.ForEach(func(k, v lua.LValue) {
+			if ks, ok := toString(k); ok {
+				ret.paths[ks] = level.path + "." + ks
 			}
 		})
+		ret.path = level.path
 	}
 
 	return ret, nil
 }
 
 func (tp *TargetPdf) Cover() (*Cover, error) {
-	cover, ok := tp.LValues["cover"]
-	if !ok {
+	cover := tp.value("cover")
+	if cover == lua.LNil {
 		return nil, nil
 	}
 
 	coverTb, ok := cover.(*lua.LTable)
 	if !ok {
-		return nil, fmt.Errorf("'%s' invalid data format: cover only support table.", tp.Name)
+		return nil, tp.configError("cover", fmt.Errorf("cover only support table"))
 	}
 
 	ret := &Cover{}
 	ret.targetPdf = tp
+	ret.path = "cover"
+
+	if err := tp.checkNoHeaderAndFooter("cover", coverTb); err != nil {
+		return nil, err
+	}
 
 	maxn := coverTb.MaxN()
 	if maxn == 0 { // table
 		if err := gluamapper.Map(coverTb, ret); err != nil {
+			return nil, tp.configError("cover", err)
+		}
+		if ret.Input == "" && ret.InputContent == "" {
+			return nil, tp.configError("cover", fmt.Errorf("cover must have 'input' or 'input_content'"))
+		}
+		if err := ret.setupNameValues(coverTb); err != nil {
+			return nil, err
+		}
+		if err := ret.Validate(); err != nil {
 			return nil, err
 		}
 	} else {
-		return nil, fmt.Errorf("'%s' invalid data format: cover can't support array table.", tp.Name)
+		return nil, tp.configError("cover", fmt.Errorf("cover can't support array table"))
 	}
 
 	return ret, nil
 }
 
 func (tp *TargetPdf) TOC() (*TOC, error) {
-	toc, ok := tp.LValues["toc"]
-	if !ok {
+	toc := tp.value("toc")
+	if toc == lua.LNil {
 		return nil, nil
 	}
 
 	tocTb, ok := toc.(*lua.LTable)
 	if !ok {
-		return nil, fmt.Errorf("'%s' invalid data format: toc only support table.", tp.Name)
+		return nil, tp.configError("toc", fmt.Errorf("toc only support table"))
 	}
 
 	ret := &TOC{}
 	ret.targetPdf = tp
+	ret.path = "toc"
+
+	if err := tp.checkNoHeaderAndFooter("toc", tocTb); err != nil {
+		return nil, err
+	}
 
 	maxn := tocTb.MaxN()
 	if maxn == 0 { // table
 		if err := gluamapper.Map(tocTb, ret); err != nil {
+			return nil, tp.configError("toc", err)
+		}
+		if err := ret.setupNameValues(tocTb); err != nil {
+			return nil, err
+		}
+		if err := ret.Validate(); err != nil {
 			return nil, err
 		}
 	} else {
-		return nil, fmt.Errorf("'%s' invalid data format: toc can't support array table.", tp.Name)
+		return nil, tp.configError("toc", fmt.Errorf("toc can't support array table"))
 	}
 
 	return ret, nil
 }
 
+// wkhtmltopdf doesn't print headers and footers on a cover, and go-wkhtmltopdf doesn't support them on a toc.
+func (tp *TargetPdf) checkNoHeaderAndFooter(key string, tb *lua.LTable) error {
+	for _, k := range []string{"header", "footer"} {
+		if tb.RawGetString(k) != lua.LNil {
+			return tp.configError(key+"."+k, fmt.Errorf("%s can't have %s", key, k))
+		}
+	}
+
+	return nil
+}
+
 func (tp *TargetPdf) CreateTempHTMLfileByContent(content []byte) (string, error) {
-	return tp.App.CreateTempHTMLfileByContent(content)
+	return tp.createdTempfile(tp.App.CreateTempHTMLfileByContent(content))
 }
 
 func (tp *TargetPdf) CreateTempCSSfileByContent(content []byte) (string, error) {
-	return tp.App.CreateTempCSSfileByContent(content)
+	return tp.createdTempfile(tp.App.CreateTempCSSfileByContent(content))
 }
 
-
-type Cover struct {
-	targetPdf    *TargetPdf
-	Input        string
-	InputContent string
-
-	// page options
-	Encoding       string //Set the default text encoding, for input
-	UserStyleSheet string //Specify a user style sheet, to load with every page
-	UserStyleSheetContent string //Specify a user style sheet, to load with every page
-	PageOffset     string // (actually uint)Set the starting page number (default 0)
+func (tp *TargetPdf) CreateTempCookieJarfile() (string, error) {
+	return tp.createdTempfile(tp.App.CreateTempCookieJarfile())
 }
 
-func (p *Cover) InputFile() string {
-	var inputfile string
+func (tp *TargetPdf) CreateTempPDFfile() (string, error) {
+	return tp.createdTempfile(tp.App.CreateTempPDFfile())
+}
 
-	tp := p.targetPdf
+func (tp *TargetPdf) createdTempfile(name string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
 
-	if p.InputContent != "" {
-		t, err := tp.CreateTempHTMLfileByContent([]byte(p.InputContent))
-		if err != nil {
-			panic(err)
-		}
-		inputfile = t
-	} else if p.Input != "" {
-		inputfile = p.Input
-	} else {
-		panic(fmt.Sprintf("'%s': page must have 'input' or 'input_content'.", tp.Name))
+	if loglv.IsDebug() {
+		tp.logf("    (Debug) Created tmpfile: %s", name)
 	}
 
-	return inputfile
+	return name, nil
 }
 
-func (p *Cover) UserStyleSheetFile() string {
-	var inputfile string
-
-	tp := p.targetPdf
+func (tp *TargetPdf) logf(format string, v ...interface{}) {
+	if tp.logger != nil {
+		tp.logger.Printf(format, v...)
+	} else {
+		tp.App.logf(format, v...)
+	}
+}
 
-	if p.UserStyleSheetContent != "" {
-		t, err := tp.CreateTempCSSfileByContent([]byte(p.UserStyleSheetContent))
+// inputFile returns the input, or a temporary file that has the content.
+func (po *PageOptions) inputFile(input string, content string) (string, error) {
+	if content != "" {
+		t, err := po.targetPdf.CreateTempHTMLfileByContent([]byte(content))
 		if err != nil {
-			panic(err)
+			return "", po.configError("input_content", err)
 		}
-		inputfile = t
-	} else if p.UserStyleSheet != "" {
-		inputfile = p.UserStyleSheet
-	} else {
-		return ""
+		return t, nil
 	}
 
-	return inputfile
+	return input, nil
 }
 
-type Page struct {
-	targetPdf    *TargetPdf
+type Cover struct {
 	Input        string
 	InputContent string
 
-	// page options
-	Encoding       string //Set the default text encoding, for input
-	UserStyleSheet string //Specify a user style sheet, to load with every page
-	UserStyleSheetContent string //Specify a user style sheet, to load with every page
-	PageOffset     string // (actually uint)Set the starting page number (default 0)
+	PageOptions `gluamapper:",squash"`
 }
 
-func (p *Page) InputFile() string {
-	var inputfile string
+func (p *Cover) InputFile() (string, error) {
+	return p.inputFile(p.Input, p.InputContent)
+}
 
-	tp := p.targetPdf
+type Page struct {
+	Input        string
+	InputContent string
 
-	if p.InputContent != "" {
-		t, err := tp.CreateTempHTMLfileByContent([]byte(p.InputContent))
-		if err != nil {
-			panic(err)
-		}
-		inputfile = t
-	} else if p.Input != "" {
-		inputfile = p.Input
-	} else {
-		panic(fmt.Sprintf("'%s': page must have 'input' or 'input_content'.", tp.Name))
-	}
+	PageOptions `gluamapper:",squash"`
 
-	return inputfile
+	// header and footer options
+	Header *HeaderFooter
+	Footer *HeaderFooter
 }
 
-func (p *Page) UserStyleSheetFile() string {
-	var inputfile string
+func (p *Page) InputFile() (string, error) {
+	return p.inputFile(p.Input, p.InputContent)
+}
 
-	tp := p.targetPdf
+type HeaderFooter struct {
+	targetPdf *TargetPdf
+	// path is the key path of the most specific level, and paths are the key paths of the keys.
+	path  string
+	paths map[string]string
+
+	Left        string // Left aligned text
+	Center      string // Centered text
+	Right       string // Right aligned text
+	FontName    string `schema:"default=Arial"`    // Set font name (default Arial)
+	FontSize    string `schema:"uint,default=12"`  // (actually uint) Set font size (default 12)
+	Spacing     string `schema:"length,default=0"` // (actually dimension) Spacing between the header or footer and content (default 0)
+	Line        bool   // Display line below the header or above the footer
+	HTML        string // Adds a html header or footer
+	HTMLContent string // Adds a html header or footer by the content
+}
 
-	if p.UserStyleSheetContent != "" {
-		t, err := tp.CreateTempCSSfileByContent([]byte(p.UserStyleSheetContent))
+func (h *HeaderFooter) HTMLFile() (string, error) {
+	if h.HTMLContent != "" {
+		t, err := h.targetPdf.CreateTempHTMLfileByContent([]byte(h.HTMLContent))
 		if err != nil {
-			panic(err)
+			return "", h.configError("html_content", err)
 		}
-		inputfile = t
-	} else if p.UserStyleSheet != "" {
-		inputfile = p.UserStyleSheet
-	} else {
-		return ""
+		return t, nil
+	}
+
+	return h.HTML, nil
+}
+
+func (h *HeaderFooter) configError(key string, err error) *ConfigError {
+	path, ok := h.paths[key]
+	if !ok {
+		path = h.path + "." + key
 	}
 
-	return inputfile
+	return h.targetPdf.configError(path, err)
 }
 
 type TOC struct {
-	targetPdf    *TargetPdf
 	DisableDottedLines  bool   //Do not use dotted lines in the toc
-	TocHeaderText       string //The header text of the toc (default Table of Contents)
-	TocLevelIndentation string // (actually uint) For each level of headings in the toc indent by this length (default 1em)
+	TocHeaderText       string `schema:"default=Table of Contents"` //The header text of the toc (default Table of Contents)
+	TocLevelIndentation string `schema:"indentation,default=1em"`   // (actually dimension) For each level of headings in the toc indent by this length (default 1em)
 	DisableTocLinks     bool   //Do not link from toc to sections
+	TocTextSizeShrink   string `schema:"float,default=0.8"` // (actually float) For each level of headings in the toc the font is scaled by this factor (default 0.8)
+	XslStyleSheet       string //Use the supplied xsl style sheet for printing the table of content
 
-	// TODO: suppot following options
-	// TocTextSizeShrink   floatOption  //For each level of headings in the toc the font is scaled by this factor
-	// XslStyleSheet       string //Use the supplied xsl style sheet for printing the table of content
-
-	// page options
-	Encoding       string //Set the default text encoding, for input
-	UserStyleSheet string //Specify a user style sheet, to load with every page
-	UserStyleSheetContent string //Specify a user style sheet, to load with every page
-	PageOffset     string // (actually uint)Set the starting page number (default 0)
+	PageOptions `gluamapper:",squash"`
 }
 
-func (p *TOC) UserStyleSheetFile() string {
-	var inputfile string
-
-	tp := p.targetPdf
-
-	if p.UserStyleSheetContent != "" {
-		t, err := tp.CreateTempCSSfileByContent([]byte(p.UserStyleSheetContent))
-		if err != nil {
-			panic(err)
+func (p *TOC) Validate() error {
+	if p.TocTextSizeShrink != "" {
+		if _, err := parseFloat(p.TocTextSizeShrink); err != nil {
+			return p.configError("toc_text_size_shrink", err)
 		}
-		inputfile = t
-	} else if p.UserStyleSheet != "" {
-		inputfile = p.UserStyleSheet
-	} else {
-		return ""
 	}
 
-	return inputfile
+	return p.PageOptions.Validate()
 }
 
 // see also
@@ -460,26 +1004,26 @@ func (p *TOC) UserStyleSheetFile() string {
 
 type GlobalOptions struct {
 	CookieJar string // Read and write cookies from and to the supplied cookie jar file
-	Copies    string // (actually uint) Number of copies to print into the pdf file (default 1)
-	Dpi       string // (actually uint) Change the dpi explicitly (this has no effect on X11 based systems)
+	Copies    string `schema:"uint,default=1"` // (actually uint) Number of copies to print into the pdf file (default 1)
+	Dpi       string `schema:"uint"`           // (actually uint) Change the dpi explicitly (this has no effect on X11 based systems)
 	//	ExtendedHelp      bool   // Display more extensive help, detailing less common command switches
 	Grayscale bool // PDF will be generated in grayscale
 	//	Help              bool   // Display help
 	//	HTMLDoc           bool   // Output program html help
-	ImageDpi     string // (actually uint) When embedding images scale them down to this dpi (default 600)
-	ImageQuality string // (actually uint) When jpeg compressing images use this quality (default 94)
+	ImageDpi     string `schema:"uint,default=600"` // (actually uint) When embedding images scale them down to this dpi (default 600)
+	ImageQuality string `schema:"uint,default=94"`  // (actually uint) When jpeg compressing images use this quality (default 94)
 	//	License           bool   // Output license information and exit
 	Lowquality bool // Generates lower quality pdf/ps. Useful to shrink the result document space
 	//	ManPage           bool   // Output program man page
-	MarginBottom     string // (actually uint) Set the page bottom margin
-	MarginLeft       string // (actually uint) Set the page left margin (default 10mm)
-	MarginRight      string // (actually uint) Set the page right margin (default 10mm)
-	MarginTop        string // (actually uint) Set the page top margin
-	Orientation      string // Set orientation to Landscape or Portrait (default Portrait)
+	MarginBottom     string `schema:"length"`              // (actually dimension) Set the page bottom margin
+	MarginLeft       string `schema:"length,default=10mm"` // (actually dimension) Set the page left margin (default 10mm)
+	MarginRight      string `schema:"length,default=10mm"` // (actually dimension) Set the page right margin (default 10mm)
+	MarginTop        string `schema:"length"`              // (actually dimension) Set the page top margin
+	Orientation      string `schema:"default=Portrait"`    // Set orientation to Landscape or Portrait (default Portrait)
 	NoCollate        bool   // Do not collate when printing multiple copies (default collate)
-	PageHeight       string // (actually uint) Page height
-	PageSize         string // Set paper size to: A4, Letter, etc. (default A4)
-	PageWidth        string // (actually uint) Page width
+	PageHeight       string `schema:"length"`     // (actually dimension) Page height
+	PageSize         string `schema:"default=A4"` // Set paper size to: A4, Letter, etc. (default A4)
+	PageWidth        string `schema:"length"`     // (actually dimension) Page width
 	NoPdfCompression bool   // Do not use lossless compression on pdf objects
 	//	Quiet             bool   // Be less verbose
 	//	ReadArgsFromStdin bool   // Read command line arguments from stdin
@@ -490,14 +1034,5 @@ type GlobalOptions struct {
 	// outlineOptions
 
 	NoOutline    bool   //Do not put an outline into the pdf
-	OutlineDepth string // (actually uint) Set the depth of the outline (default 4)
-}
-
-func parseUint(str string) uint {
-	v, err := strconv.ParseUint(str, 10, 0)
-	if err != nil {
-		panic(fmt.Sprintf("detected invalid parameter (uint expected): %v", err))
-	}
-
-	return uint(v)
+	OutlineDepth string `schema:"uint,default=4"` // (actually uint) Set the depth of the outline (default 4)
 }
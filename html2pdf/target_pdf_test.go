@@ -0,0 +1,286 @@
+package html2pdf
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func newTestApp(t *testing.T) *App {
+	tmpdir, err := ioutil.TempDir("", "html2pdf_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := NewApp()
+	app.SetCachedir(tmpdir)
+	app.CacheTmpdir = tmpdir
+	app.WkhtmltopdfCmd = "wkhtmltopdf"
+	app.Logger = log.New(ioutil.Discard, "", 0)
+	app.openLibs()
+
+	return app
+}
+
+func closeTestApp(app *App) {
+	app.Close()
+	os.RemoveAll(app.Cachedir)
+}
+
+// argsOf returns wkhtmltopdf args of all the pdf configs. It replaces the paths of tmpfiles to be comparable.
+func argsOf(app *App) (string, error) {
+	buf := new(bytes.Buffer)
+	for _, tp := range app.Targetpdfs {
+		args, err := tp.WkhtmltopdfArgs()
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(buf, "# %s\n", tp.Name)
+		for _, arg := range args {
+			fmt.Fprintln(buf, arg)
+		}
+	}
+
+	ret := buf.String()
+	for i, f := range app.Tmpfiles {
+		ret = strings.Replace(ret, f, fmt.Sprintf("<tmpfile%d%s>", i, filepath.Ext(f)), -1)
+	}
+
+	return ret, nil
+}
+
+func TestTargetPdfArgs(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "args", "*.lua"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		app := newTestApp(t)
+
+		if err := app.LoadVariableFromJSON(`{"token": "xyz"}`); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.LoadScriptFile(file); err != nil {
+			t.Errorf("%s: %v", file, err)
+			closeTestApp(app)
+			continue
+		}
+
+		actual, err := argsOf(app)
+		closeTestApp(app)
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+
+		golden := strings.TrimSuffix(file, ".lua") + ".golden"
+		if *update {
+			if err := ioutil.WriteFile(golden, []byte(actual), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+
+		if actual != string(expected) {
+			t.Errorf("%s: args mismatch\n--- expected\n%s\n--- actual\n%s", file, expected, actual)
+		}
+	}
+}
+
+func TestTargetPdfArgsErrors(t *testing.T) {
+	cases := []struct {
+		script string
+		err    string
+	}{
+		{
+			script: `pdf "a.pdf" { options = { margin_top = "15furlong" }, pages = { input = "a.html" } }`,
+			err:    "<string>:1: 'a.pdf' invalid options.margin_top: '15furlong'",
+		},
+		{
+			script: `pdf "a.pdf" { toc = { toc_level_indentation = "2mm" }, pages = { input = "a.html" } }`,
+			err:    "invalid toc.toc_level_indentation",
+		},
+		{
+			script: `pdf "a.pdf" { pages = { input = "a.html", zoom = "large" } }`,
+			err:    "invalid pages.zoom",
+		},
+		{
+			script: `pdf "a.pdf" { pages = { input = "a.html", load_error_handling = "retry" } }`,
+			err:    "invalid pages.load_error_handling",
+		},
+		{
+			script: `pdf "a.pdf" { cover = { input = "a.html", header = { left = "x" } } }`,
+			err:    "invalid cover.header: cover can't have header",
+		},
+		{
+			script: "pdf \"a.pdf\" {\n  pages = {\n    { input = \"a.html\" },\n    { input = \"b.html\", page_offset = \"x\" },\n  },\n}",
+			err:    "<string>:1: 'a.pdf' invalid pages[2].page_offset: 'x' (uint expected)",
+		},
+		{
+			script: "local a = pdf \"a.pdf\"\na.pages = { { input = \"a.html\" }, { zoom = \"2\" } }",
+			err:    "<string>:2: 'a.pdf' invalid pages[2]: page must have 'input' or 'input_content'",
+		},
+		{
+			script: `pdf "a.pdf" { header = { font_size = "big" }, pages = { { input = "a.html", header = { spacing = "2mm" } } } }`,
+			err:    "invalid header.font_size: 'big' (uint expected)",
+		},
+		{
+			script: `pdf "a.pdf" { header = { font_size = "10" }, pages = { { input = "a.html", header = { font_size = "big" } } } }`,
+			err:    "invalid pages[1].header.font_size: 'big' (uint expected)",
+		},
+	}
+
+	for _, c := range cases {
+		app := newTestApp(t)
+
+		if err := app.LoadRecipe(c.script); err != nil {
+			t.Errorf("%s: %v", c.script, err)
+			closeTestApp(app)
+			continue
+		}
+
+		_, err := argsOf(app)
+		closeTestApp(app)
+		if err == nil {
+			t.Errorf("%s: expected error", c.script)
+		} else if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error contains %q, but got %q", c.script, c.err, err.Error())
+		}
+	}
+}
+
+func TestMaskArgs(t *testing.T) {
+	args := []string{
+		"--custom-header", "Authorization", "Bearer xyz",
+		"--cookie", "session", "abc123",
+		"--post", "lang", "en",
+		"--username", "user",
+		"--password", "secret",
+		"page", "https://example.com/report",
+		"-",
+	}
+	expected := []string{
+		"--custom-header", "Authorization", "******",
+		"--cookie", "session", "******",
+		"--post", "lang", "******",
+		"--username", "user",
+		"--password", "******",
+		"page", "https://example.com/report",
+		"-",
+	}
+
+	actual := maskArgs(args)
+	if strings.Join(actual, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, but got %v", expected, actual)
+	}
+	if args[2] != "Bearer xyz" {
+		t.Errorf("maskArgs must not modify the original args")
+	}
+}
+
+func TestSortMapArgs(t *testing.T) {
+	cases := []struct {
+		args     string
+		expected string
+	}{
+		{
+			"--cookie b 2 --cookie a 1 --cookie c 3 page a.html -",
+			"--cookie a 1 --cookie b 2 --cookie c 3 page a.html -",
+		},
+		{
+			"--post y 2 --post x 1 --custom-header B 2 --custom-header A 1 page --cookie s 1 a.html -",
+			"--post x 1 --post y 2 --custom-header A 1 --custom-header B 2 page --cookie s 1 a.html -",
+		},
+		{
+			"page a.html --custom-header",
+			"page a.html --custom-header",
+		},
+	}
+
+	for _, c := range cases {
+		actual := strings.Join(sortMapArgs(strings.Fields(c.args)), " ")
+		if actual != c.expected {
+			t.Errorf("%s: expected %q, but got %q", c.args, c.expected, actual)
+		}
+	}
+}
+
+func TestHeaderFooterArgs(t *testing.T) {
+	cases := []struct {
+		config   string
+		expected string
+		err      string
+	}{
+		{
+			config:   `pages = { { input = "a.html", header = { left = "[title]", center = "c", right = "[date]" } } }`,
+			expected: "page a.html --header-center c --header-left [title] --header-right [date]",
+		},
+		{
+			config:   `pages = { { input = "a.html", footer = { font_name = "Helvetica", font_size = 9, spacing = "5mm", line = true } } }`,
+			expected: "page a.html --footer-font-name Helvetica --footer-font-size 9 --footer-line --footer-spacing 5",
+		},
+		{
+			config:   `pages = { { input = "a.html", header = { html = "header.html" }, footer = { html_content = "<p>footer</p>" } } }`,
+			expected: "page a.html --footer-html <tmpfile0.html> --header-html header.html",
+		},
+		{
+			// the header of the pdf config is merged into the headers of the pages.
+			config:   `header = { center = "[page]", font_size = 9 }, pages = { { input = "a.html" }, { input = "b.html", header = { center = "b" } } }`,
+			expected: "page a.html --header-center [page] --header-font-size 9 page b.html --header-center b --header-font-size 9",
+		},
+		{
+			config: `pages = { { input = "a.html", footer = { font_size = "x" } } }`,
+			err:    "'a.pdf' invalid pages[1].footer.font_size: 'x' (uint expected)",
+		},
+		{
+			config: `header = { font_size = -1 }, pages = { { input = "a.html" } }`,
+			err:    "'a.pdf' invalid header.font_size",
+		},
+		{
+			config: `pages = { { input = "a.html", header = "[page]" } }`,
+			err:    "'a.pdf' invalid pages[1].header: table expected, but got string",
+		},
+		{
+			config: `pages = { input = "a.html" }, cover = { input = "cover.html", footer = { center = "x" } }`,
+			err:    "'a.pdf' invalid cover.footer: cover can't have footer",
+		},
+	}
+
+	for _, c := range cases {
+		app := newTestApp(t)
+
+		err := app.LoadRecipe(`pdf "a.pdf" { ` + c.config + ` }`)
+		var args string
+		if err == nil {
+			args, err = argsOf(app)
+		}
+		closeTestApp(app)
+
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected error contains %q, but got %v", c.config, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.config, err)
+		} else if args = strings.Replace(args, "\n", " ", -1); !strings.Contains(args, c.expected) {
+			t.Errorf("%s: expected args contain %q, but got %q", c.config, c.expected, args)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+pdf "cover.pdf" {
+    cover = {
+        input_content = "<h1>cover</h1>",
+        allow = { "/tmp/assets" },
+        no_background = true,
+        bypass_proxy_for = { "localhost" },
+        cache_dir = "/tmp/cache",
+        checkbox_checked_svg = "checked.svg",
+        checkbox_svg = "checkbox.svg",
+        debug_javascript = true,
+        default_header = true,
+        encoding = "utf-8",
+        disable_external_links = true,
+        enable_forms = true,
+        no_images = true,
+        disable_internal_links = true,
+        disable_javascript = true,
+        javascript_delay = 500,
+        load_error_handling = "ignore",
+        load_media_error_handling = "skip",
+        enable_local_file_access = true,
+        minimum_font_size = 8,
+        exclude_from_outline = true,
+        page_offset = 1,
+        enable_plugins = true,
+        print_media_type = true,
+        proxy = "http://proxy:3128",
+        radiobutton_checked_svg = "radio_checked.svg",
+        radiobutton_svg = "radio.svg",
+        run_script = { "console.log(1)" },
+        disable_smart_shrinking = true,
+        no_stop_slow_scripts = true,
+        enable_toc_back_links = true,
+        user_style_sheet = "cover.css",
+        viewport_size = "1280x1024",
+        window_status = "ready",
+        zoom = 1.5,
+    },
+    pages = {
+        input = "page.html",
+    },
+}
@@ -0,0 +1,20 @@
+local html2pdf = require "html2pdf"
+
+local doc = html2pdf.pdf "cover_and_toc.pdf"
+doc.output_file = "out.pdf"
+doc.cover = {
+    input = "cover.html",
+}
+doc.toc = {
+    toc_header_text = "Contents",
+}
+doc.pages = {
+    { input = "page1.html" },
+    { input = "page2.html" },
+}
+
+pdf "second.pdf" {
+    pages = {
+        input = "second.html",
+    },
+}
@@ -0,0 +1,25 @@
+pdf "global_options.pdf" {
+    options = {
+        cookie_jar = "cookies.txt",
+        copies = 2,
+        dpi = 300,
+        grayscale = true,
+        image_dpi = 600,
+        image_quality = 94,
+        lowquality = true,
+        margin_bottom = "1cm",
+        margin_left = "0.5in",
+        margin_right = 10,
+        margin_top = "15mm",
+        orientation = "Landscape",
+        no_collate = true,
+        page_size = "A4",
+        no_pdf_compression = true,
+        title = "Global Options",
+        no_outline = true,
+        outline_depth = 3,
+    },
+    pages = {
+        input = "page.html",
+    },
+}
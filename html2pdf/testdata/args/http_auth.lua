@@ -0,0 +1,17 @@
+pdf "http_auth.pdf" {
+    pages = {
+        input = "https://example.com/report",
+        custom_headers = {
+            Authorization = "Bearer " .. var.token,
+        },
+        custom_header_propagation = true,
+        cookies = {
+            session = "abc123",
+        },
+        post = {
+            lang = "en",
+        },
+        username = "user",
+        password = "secret",
+    },
+}
@@ -0,0 +1,9 @@
+pdf "page_size.pdf" {
+    options = {
+        page_width = "210mm",
+        page_height = "11in",
+    },
+    pages = {
+        input = "page.html",
+    },
+}
@@ -0,0 +1,38 @@
+pdf "pages.pdf" {
+    footer = {
+        center = "[page] / [topage]",
+        font_size = 9,
+    },
+    pages = {
+        {
+            input = "page1.html",
+            encoding = "utf-8",
+            page_offset = 2,
+            user_style_sheet_content = "body { color: red; }",
+            disable_local_file_access = true,
+            allow = { "/tmp/a", "/tmp/b" },
+            header = {
+                left = "[title]",
+                center = "center",
+                right = "[date]",
+                font_name = "Helvetica",
+                font_size = 10,
+                spacing = "2.5mm",
+                line = true,
+            },
+            footer = {
+                spacing = 3,
+                line = true,
+            },
+        },
+        {
+            input_content = "<p>page2</p>",
+            header = {
+                html_content = "<!DOCTYPE html><html><body>header</body></html>",
+            },
+            footer = {
+                html = "footer.html",
+            },
+        },
+    },
+}
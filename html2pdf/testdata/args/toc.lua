@@ -0,0 +1,16 @@
+pdf "toc.pdf" {
+    toc = {
+        disable_dotted_lines = true,
+        toc_header_text = "Contents",
+        toc_level_indentation = "2em",
+        disable_toc_links = true,
+        toc_text_size_shrink = 0.9,
+        xsl_style_sheet = "toc.xsl",
+        encoding = "utf-8",
+        page_offset = 1,
+        user_style_sheet_content = "h1 { font-size: 20px; }",
+    },
+    pages = {
+        input = "page.html",
+    },
+}
@@ -3,6 +3,9 @@ package html2pdf
 import (
 	"fmt"
 	"github.com/yuin/gopher-lua"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // This code inspired by https://github.com/yuin/gluamapper/blob/master/gluamapper.go
@@ -70,3 +73,86 @@ func toString(v lua.LValue) (string, bool) {
 		return "", false
 	}
 }
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func toStringMap(lv lua.LValue) (map[string]string, error) {
+	if lv == lua.LNil {
+		return nil, nil
+	}
+
+	tb, ok := lv.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("table expected, but got %s", lv.Type())
+	}
+
+	var err error
+	ret := map[string]string{}
+	tb.ForEach(func(k, v lua.LValue) {
+		key, ok := toString(k)
+		if !ok {
+			err = fmt.Errorf("a key must be string, but got %s", k.Type())
+			return
+		}
+
+		switch v.(type) {
+		case lua.LString, lua.LNumber, lua.LBool:
+			ret[key] = v.String()
+		default:
+			err = fmt.Errorf("'%s' must be string, but got %s", key, v.Type())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// lvalueString returns the string representation of the lua value. The keys of tables are sorted.
+func lvalueString(lv lua.LValue) string {
+	switch v := lv.(type) {
+	case lua.LString:
+		return strconv.Quote(string(v))
+	case *lua.LTable:
+		keys := []string{}
+		values := map[string]string{}
+		v.ForEach(func(key, value lua.LValue) {
+			k := lvalueString(key)
+			keys = append(keys, k)
+			values[k] = lvalueString(value)
+		})
+		sort.Strings(keys)
+
+		fields := make([]string, 0, len(keys))
+		for _, k := range keys {
+			fields = append(fields, "["+k+"]="+values[k])
+		}
+
+		return "{" + strings.Join(fields, ",") + "}"
+	case *lua.LFunction:
+		// the address differs in every evaluation.
+		return "function"
+	default:
+		return lv.String()
+	}
+}
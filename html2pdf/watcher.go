@@ -0,0 +1,265 @@
+package html2pdf
+
+import (
+	"github.com/kohkimakimoto/html2pdf/support/color"
+	"github.com/kohkimakimoto/loglv"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Watcher rebuilds the pdf configs when the files that they depend on are changed.
+// It polls the modification times of the files, so it works on any platform and filesystem.
+type Watcher struct {
+	// NewApp creates an app that has loaded the script.
+	// It is called every time the script or the files loaded by the script are changed.
+	// It may return the app with an error to keep watching the files loaded before the error.
+	NewApp func() (*App, error)
+	// Files that are always watched, like the script file and the variable file.
+	Files []string
+	// Interval of polling.
+	Interval time.Duration
+	// Rebuilding waits until the files stop changing for this duration.
+	Debounce time.Duration
+
+	app *App
+	// files loaded by the script, like the script itself and the files read by require, dofile and fs.
+	scriptFiles []string
+	// config strings of the pdf configs to detect which ones are changed.
+	configs map[string]string
+	mtimes  map[string]time.Time
+}
+
+func NewWatcher(newApp func() (*App, error), files []string) *Watcher {
+	// the files loaded by the script are recorded in absolute paths.
+	absFiles := []string{}
+	for _, f := range files {
+		if abs, err := filepath.Abs(f); err == nil {
+			f = abs
+		}
+		absFiles = append(absFiles, f)
+	}
+
+	return &Watcher{
+		NewApp:   newApp,
+		Files:    absFiles,
+		Interval: 500 * time.Millisecond,
+		Debounce: 300 * time.Millisecond,
+		configs:  map[string]string{},
+		mtimes:   map[string]time.Time{},
+	}
+}
+
+// Run builds the pdf configs and rebuilds them on changes until stop is closed.
+// Errors in the script and in rendering are logged and don't stop watching.
+func (w *Watcher) Run(stop <-chan struct{}) error {
+	w.reload(nil)
+	w.mtimes = w.stat()
+	w.logWatching()
+
+	for {
+		select {
+		case <-stop:
+			if w.app != nil {
+				w.app.Close()
+			}
+			return nil
+		case <-time.After(w.Interval):
+		}
+
+		if len(changedFiles(w.mtimes, w.stat())) == 0 {
+			continue
+		}
+
+		// debounce: wait until the files stop changing.
+		mtimes := w.stat()
+		for {
+			time.Sleep(w.Debounce)
+			current := w.stat()
+			if len(changedFiles(mtimes, current)) == 0 {
+				break
+			}
+			mtimes = current
+		}
+
+		// the files changed during the debounce are also included.
+		changed := changedFiles(w.mtimes, mtimes)
+		for _, f := range changed {
+			log.Printf("==> Changed: %s", f)
+		}
+
+		if w.app == nil || containsAny(append(w.scriptFiles, w.Files...), changed) {
+			w.reload(changed)
+		} else {
+			w.rebuild(changed)
+		}
+
+		// the files changed during the build are rebuilt on the next poll, and the new files to watch are recorded as they are.
+		current := w.stat()
+		for f, mtime := range mtimes {
+			if _, ok := current[f]; ok {
+				current[f] = mtime
+			}
+		}
+		w.mtimes = current
+		w.logWatching()
+	}
+}
+
+// reload evaluates the script again and builds the pdf configs that are new or changed,
+// the ones that read the changed files and the ones that depend on them.
+func (w *Watcher) reload(changed []string) {
+	app, err := w.NewApp()
+	if err != nil {
+		log.Print(color.FgRB("==> Failed to load the script: %v", err))
+		if app != nil {
+			// keep watching the files loaded before the error.
+			w.scriptFiles = app.LoadedFiles()
+			app.Close()
+		}
+		return
+	}
+
+	if w.app != nil {
+		w.app.Close()
+	}
+	w.app = app
+	w.scriptFiles = app.LoadedFiles()
+
+	targetpdfs, err := app.TargetPdfsToBuild()
+	if err != nil {
+		log.Print(color.FgRB("==> %v", err))
+		return
+	}
+
+	configs := map[string]string{}
+	affected := []*TargetPdf{}
+	for _, tp := range targetpdfs {
+		configs[tp.Name] = tp.ConfigString()
+		prev, ok := w.configs[tp.Name]
+		if !ok || prev != configs[tp.Name] || containsAny(tp.LocalFiles(), changed) || dependsOnAny(tp, affected) {
+			affected = append(affected, tp)
+		}
+	}
+	w.configs = configs
+
+	if len(affected) == 0 {
+		log.Print("==> No pdf configs are changed.")
+		return
+	}
+
+	w.build(affected)
+}
+
+// rebuild builds the pdf configs that read the changed files and the ones that depend on them.
+func (w *Watcher) rebuild(changed []string) {
+	targetpdfs, err := w.app.TargetPdfsToBuild()
+	if err != nil {
+		log.Print(color.FgRB("==> %v", err))
+		return
+	}
+
+	// the pdf configs are in the build order, so the ones that depend on the affected ones are also affected.
+	affected := []*TargetPdf{}
+	for _, tp := range targetpdfs {
+		if containsAny(tp.LocalFiles(), changed) || dependsOnAny(tp, affected) {
+			affected = append(affected, tp)
+		}
+	}
+
+	w.build(affected)
+}
+
+func (w *Watcher) build(targetpdfs []*TargetPdf) {
+	app := w.app
+
+	if err := app.prepareCachedirs(); err != nil {
+		log.Print(color.FgRB("==> %v", err))
+		return
+	}
+	if err := app.prepareWkhtmltopdf(); err != nil {
+		log.Print(color.FgRB("==> %v", err))
+		return
+	}
+
+	if err := app.runTargetPdfs(targetpdfs); err != nil {
+		log.Print(color.FgRB("==> %v", err))
+		return
+	}
+
+	log.Print("==> Complete!")
+}
+
+// watchedFiles returns the files to watch.
+func (w *Watcher) watchedFiles() []string {
+	files := []string{}
+	files = append(files, w.Files...)
+	files = append(files, w.scriptFiles...)
+
+	if w.app != nil {
+		if targetpdfs, err := w.app.TargetPdfsToBuild(); err == nil {
+			for _, tp := range targetpdfs {
+				files = append(files, tp.LocalFiles()...)
+			}
+		}
+	}
+
+	ret := []string{}
+	for _, f := range files {
+		if !contains(ret, f) {
+			ret = append(ret, f)
+		}
+	}
+	sort.Strings(ret)
+
+	return ret
+}
+
+func (w *Watcher) stat() map[string]time.Time {
+	mtimes := map[string]time.Time{}
+	for _, f := range w.watchedFiles() {
+		if fi, err := os.Stat(f); err == nil {
+			mtimes[f] = fi.ModTime()
+		} else {
+			// the file doesn't exist.
+			mtimes[f] = time.Time{}
+		}
+	}
+
+	return mtimes
+}
+
+// changedFiles returns the files that have different modification times in current, or are new in current.
+func changedFiles(prev map[string]time.Time, current map[string]time.Time) []string {
+	changed := []string{}
+	for f, mtime := range current {
+		if p, ok := prev[f]; !ok || !p.Equal(mtime) {
+			changed = append(changed, f)
+		}
+	}
+	sort.Strings(changed)
+
+	return changed
+}
+
+func (w *Watcher) logWatching() {
+	files := w.watchedFiles()
+	log.Printf("==> Watching %d files for changes...", len(files))
+	if loglv.IsDebug() {
+		for _, f := range files {
+			log.Printf("    (Debug) watching: %s", f)
+		}
+	}
+}
+
+func containsAny(list []string, items []string) bool {
+	for _, item := range items {
+		if contains(list, item) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,175 @@
+package html2pdf
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "html2pdf_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	path := func(name string) string {
+		return filepath.Join(tmpdir, name)
+	}
+
+	// write writes the file with a new modification time, because the watcher compares them.
+	mtime := time.Now()
+	write := func(name string, content string) {
+		if err := ioutil.WriteFile(path(name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime = mtime.Add(time.Second)
+		if err := os.Chtimes(path(name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	script := `
+local common = dofile "` + path("common.lua") + `"
+
+pdf "a.pdf" {
+    output_file = "` + path("a.pdf") + `",
+    pages = { { input = "` + path("a.html") + `", user_style_sheet = "` + path("style.css") + `" } },
+}
+pdf "b.pdf" {
+    output_file = "` + path("b.pdf") + `",
+    options = { title = common.title },
+    pages = { { input = "` + path("b.html") + `" } },
+}
+pdf "book.pdf" {
+    output_file = "` + path("book.pdf") + `",
+    depends_on = "a.pdf",
+    pages = { { input = "` + path("book.html") + `" } },
+}
+`
+	write("html2pdf.lua", script)
+	write("common.lua", `return { title = "B" }`)
+	for _, name := range []string{"a.html", "b.html", "book.html", "style.css"} {
+		write(name, name)
+	}
+
+	r := &FakeRenderer{}
+	w := NewWatcher(func() (*App, error) {
+		app := NewApp()
+		app.SetCachedir(path("cache"))
+		app.Renderer = r
+		app.Logger = log.New(ioutil.Discard, "", 0)
+		// rebuild the affected pdf configs even if the build state says they are up to date.
+		app.Force = true
+		app.openLibs()
+
+		return app, app.LoadScriptFile(path("html2pdf.lua"))
+	}, []string{path("html2pdf.lua")})
+	w.Interval = 10 * time.Millisecond
+	w.Debounce = 200 * time.Millisecond
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- w.Run(stop)
+	}()
+
+	// rendered waits until the watcher renders the count of pdf configs, and returns their names in order.
+	rendered := 0
+	waitRendered := func(count int) string {
+		deadline := time.Now().Add(5 * time.Second)
+		for len(r.Documents()) < rendered+count && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		// wait more to catch the extra renders.
+		time.Sleep(w.Debounce + 5*w.Interval)
+
+		names := []string{}
+		for _, doc := range r.Documents()[rendered:] {
+			names = append(names, doc.Name)
+		}
+		rendered += len(names)
+		sort.Strings(names)
+
+		return strings.Join(names, ",")
+	}
+
+	steps := []struct {
+		name     string
+		change   func()
+		count    int
+		expected string
+	}{
+		{name: "first", change: func() {}, count: 3, expected: "a.pdf,b.pdf,book.pdf"},
+		{name: "input changed", change: func() { write("b.html", "changed") }, count: 1, expected: "b.pdf"},
+		{
+			name:     "stylesheet changed",
+			change:   func() { write("style.css", "changed") },
+			count:    2,
+			expected: "a.pdf,book.pdf",
+		},
+		{
+			name: "changed repeatedly",
+			change: func() {
+				for i := 0; i < 4; i++ {
+					write("a.html", strings.Repeat("changed", i+1))
+					time.Sleep(20 * time.Millisecond)
+				}
+			},
+			count:    2,
+			expected: "a.pdf,book.pdf",
+		},
+		{
+			name:     "file loaded by the script changed",
+			change:   func() { write("common.lua", `return { title = "changed" }`) },
+			count:    1,
+			expected: "b.pdf",
+		},
+		{
+			name: "changed during the debounce",
+			change: func() {
+				write("a.html", "debounced")
+				time.Sleep(w.Debounce / 2)
+				write("b.html", "debounced")
+			},
+			count:    3,
+			expected: "a.pdf,b.pdf,book.pdf",
+		},
+		{
+			name: "script and input changed together",
+			change: func() {
+				write("html2pdf.lua", strings.Replace(script, "common.title", `"combined"`, 1))
+				write("a.html", "combined")
+			},
+			count:    3,
+			expected: "a.pdf,b.pdf,book.pdf",
+		},
+		{name: "script broken", change: func() { write("html2pdf.lua", script+"pdf {") }, count: 0, expected: ""},
+		{
+			name:     "script fixed",
+			change:   func() { write("html2pdf.lua", strings.Replace(script, "common.title", `"fixed"`, 1)) },
+			count:    1,
+			expected: "b.pdf",
+		},
+	}
+
+	for _, step := range steps {
+		step.change()
+		if actual := waitRendered(step.count); actual != step.expected {
+			t.Errorf("%s: expected %q are rendered, but got %q", step.name, step.expected, actual)
+		}
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,228 @@
+package html2pdf
+
+import (
+	"fmt"
+	"github.com/kohkimakimoto/html2pdf/support/color"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// WkhtmltopdfEnv is the environment variable that the command reads to use an external wkhtmltopdf instead of the bundled one.
+const WkhtmltopdfEnv = "HTML2PDF_WKHTMLTOPDF"
+
+// wkhtmltopdfInfo is the version and the capabilities of a wkhtmltopdf that are detected by probeWkhtmltopdf.
+type wkhtmltopdfInfo struct {
+	// Version is the first line of "wkhtmltopdf --version" like "wkhtmltopdf 0.12.6 (with patched qt)".
+	Version string
+	// Patched is false if wkhtmltopdf is built against the unpatched qt that lacks some features.
+	// It is false unless the version or the help tells it is patched.
+	Patched bool
+	// Options are the supported options and the number of their values. It is nil if "--extended-help" can't be parsed,
+	// and then the options are unknown.
+	Options map[string]int
+	// patchedOptions are the options that are marked as they need the patched qt.
+	patchedOptions map[string]bool
+}
+
+// patchedQtPrefixes are the options that need the patched qt even if they are not marked in the help.
+var patchedQtPrefixes = []string{
+	"--header-",
+	"--footer-",
+	"--outline",
+	"--toc-",
+	"--disable-smart-shrinking",
+	"--print-media-type",
+}
+
+// helpOptionRe matches an option line of "wkhtmltopdf --extended-help" like
+// "  -T, --margin-top <unitreal>       Set the page top margin".
+// The description starts with "*" if the option needs the patched qt.
+var helpOptionRe = regexp.MustCompile(`^\s*(?:-\w,\s+)?(--[\w-]+)((?:\s+<[^>]+>)*)(?:\s+(\*))?`)
+
+// parseWkhtmltopdfHelp parses the output of "wkhtmltopdf --extended-help".
+// The help that has no options like an empty one doesn't tell the qt is patched.
+func parseWkhtmltopdfHelp(version string, help string) *wkhtmltopdfInfo {
+	info := &wkhtmltopdfInfo{
+		Version:        version,
+		Patched:        strings.Contains(version, "patched qt"),
+		patchedOptions: map[string]bool{},
+	}
+
+	for _, line := range strings.Split(help, "\n") {
+		m := helpOptionRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		if info.Options == nil {
+			info.Options = map[string]int{}
+		}
+		info.Options[m[1]] = strings.Count(m[2], "<")
+		if m[3] == "*" {
+			info.patchedOptions[m[1]] = true
+		}
+	}
+
+	if info.Options != nil && !strings.Contains(help, "Reduced Functionality") {
+		info.Patched = true
+	}
+
+	return info
+}
+
+// needsPatchedQt returns true if the option can't be used with the unpatched qt.
+func (info *wkhtmltopdfInfo) needsPatchedQt(option string) bool {
+	if info.patchedOptions[option] {
+		return true
+	}
+	for _, prefix := range patchedQtPrefixes {
+		if strings.HasPrefix(option, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unsupported returns the features in the wkhtmltopdf args that the wkhtmltopdf doesn't support.
+func (info *wkhtmltopdfInfo) unsupported(args []string) []string {
+	ret := []string{}
+	add := func(feature string) {
+		if !contains(ret, feature) {
+			ret = append(ret, feature)
+		}
+	}
+
+	documents := 0
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "page" || arg == "cover":
+			documents++
+			if arg == "cover" && !info.Patched {
+				add("cover (needs the patched qt)")
+			}
+			// skip the input.
+			i++
+		case arg == "toc":
+			documents++
+			if !info.Patched {
+				add("toc (needs the patched qt)")
+			}
+		case strings.HasPrefix(arg, "--"):
+			if info.Options == nil {
+				continue
+			}
+
+			n, ok := info.Options[arg]
+			if !ok {
+				add(arg)
+				continue
+			}
+			if !info.Patched && info.needsPatchedQt(arg) {
+				add(arg + " (needs the patched qt)")
+			}
+			i += n
+		}
+	}
+
+	if documents > 1 && !info.Patched {
+		add("multiple pages (needs the patched qt)")
+	}
+
+	return ret
+}
+
+// wkhtmltopdfProbes caches the probed wkhtmltopdf by the path, the size and the modification time.
+var wkhtmltopdfProbes = struct {
+	sync.Mutex
+	m map[string]*wkhtmltopdfInfo
+}{m: map[string]*wkhtmltopdfInfo{}}
+
+func wkhtmltopdfProbeKey(cmd string) (string, error) {
+	path, err := exec.LookPath(cmd)
+	if err != nil {
+		return "", err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s:%d:%d", path, fi.Size(), fi.ModTime().UnixNano()), nil
+}
+
+// probeWkhtmltopdf runs "wkhtmltopdf --version" and "wkhtmltopdf --extended-help" to detect the capabilities.
+// The result is cached until the file is changed.
+func probeWkhtmltopdf(cmd string) (*wkhtmltopdfInfo, error) {
+	key, err := wkhtmltopdfProbeKey(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("wkhtmltopdf '%s' is not found: %v", cmd, err)
+	}
+
+	wkhtmltopdfProbes.Lock()
+	defer wkhtmltopdfProbes.Unlock()
+
+	if info, ok := wkhtmltopdfProbes.m[key]; ok {
+		return info, nil
+	}
+
+	out, err := exec.Command(cmd, "--version").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run wkhtmltopdf '%s': %v", cmd, err)
+	}
+	version := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+
+	// the support of the options is unknown if the help can't be read.
+	help, _ := exec.Command(cmd, "--extended-help").Output()
+
+	info := parseWkhtmltopdfHelp(version, string(help))
+	wkhtmltopdfProbes.m[key] = info
+
+	return info, nil
+}
+
+// probedWkhtmltopdf returns the capabilities of the wkhtmltopdf if it has been probed. It doesn't run wkhtmltopdf.
+func probedWkhtmltopdf(cmd string) *wkhtmltopdfInfo {
+	key, err := wkhtmltopdfProbeKey(cmd)
+	if err != nil {
+		return nil
+	}
+
+	wkhtmltopdfProbes.Lock()
+	defer wkhtmltopdfProbes.Unlock()
+
+	return wkhtmltopdfProbes.m[key]
+}
+
+// checkWkhtmltopdfSupport checks the wkhtmltopdf supports the args of the pdf config.
+// The unsupported options are errors in the strict mode, and warnings otherwise.
+// The strict mode also fails if the supported options are unknown because the help can't be parsed.
+func (tp *TargetPdf) checkWkhtmltopdfSupport(cmd string, args []string) error {
+	info := probedWkhtmltopdf(cmd)
+	if info == nil {
+		return nil
+	}
+
+	if info.Options == nil && tp.App.Strict {
+		return fmt.Errorf("the options that %s supports are unknown because its --extended-help can't be parsed", info.Version)
+	}
+
+	unsupported := info.unsupported(args)
+	if len(unsupported) == 0 {
+		return nil
+	}
+
+	err := fmt.Errorf("%s doesn't support %s", info.Version, strings.Join(unsupported, ", "))
+	if tp.App.Strict {
+		return err
+	}
+
+	tp.logf(color.FgY("    warning: %v", err))
+	return nil
+}
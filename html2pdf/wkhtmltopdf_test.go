@@ -0,0 +1,190 @@
+package html2pdf
+
+import (
+	"bytes"
+	"github.com/kohkimakimoto/html2pdf/support/testutil"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// unpatchedHelp is a part of "wkhtmltopdf --extended-help" that is built against the unpatched qt.
+const unpatchedHelp = `Name:
+  wkhtmltopdf 0.12.5
+
+Global Options:
+      --collate                       Collate when printing multiple copies
+                                      (default)
+  -g, --grayscale                     PDF will be generated in grayscale
+  -s, --page-size <Size>              Set paper size to: A4, Letter, etc.
+                                      (default A4)
+      --title <text>                  The title of the generated pdf file (The
+                                      title of the first document is used if not
+                                      specified)
+
+Page Options:
+      --custom-header <name> <value>  Set an additional HTTP header (repeatable)
+      --footer-center <text>          * Centered footer text
+
+Reduced Functionality:
+  This version of wkhtmltopdf has been compiled against a version of QT without
+  the wkhtmltopdf patches.
+`
+
+func TestParseWkhtmltopdfHelp(t *testing.T) {
+	info := parseWkhtmltopdfHelp("wkhtmltopdf 0.12.5", unpatchedHelp)
+
+	if info.Patched {
+		t.Error("expected unpatched")
+	}
+	expected := map[string]int{"--collate": 0, "--grayscale": 0, "--page-size": 1, "--title": 1, "--custom-header": 2, "--footer-center": 1}
+	if len(info.Options) != len(expected) {
+		t.Errorf("expected %v, but got %v", expected, info.Options)
+	}
+	for k, v := range expected {
+		if n, ok := info.Options[k]; !ok || n != v {
+			t.Errorf("%s: expected %d values, but got %d (%v)", k, v, n, ok)
+		}
+	}
+
+	cases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--page-size", "A4", "--title", "--dpi", "page", "a.html", "-"}, ""},
+		{[]string{"--dpi", "96", "page", "a.html", "--footer-center", "[page]", "-"}, "--dpi, --footer-center (needs the patched qt)"},
+		{[]string{"cover", "cover.html", "toc", "page", "a.html", "-"}, "cover (needs the patched qt), toc (needs the patched qt), multiple pages (needs the patched qt)"},
+	}
+	for _, c := range cases {
+		if actual := strings.Join(info.unsupported(c.args), ", "); actual != c.expected {
+			t.Errorf("%v: expected %q, but got %q", c.args, c.expected, actual)
+		}
+	}
+
+	info = parseWkhtmltopdfHelp("wkhtmltopdf 0.12.6 (with patched qt)", testutil.WkhtmltopdfHelp)
+	if !info.Patched || info.Options["--cookie"] != 2 || info.Options["--load-media-error-handling"] != 1 || info.Options["--outline"] != 0 {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	// the options are unknown if the help can't be parsed, and the qt is patched only if the version tells it.
+	info = parseWkhtmltopdfHelp("wkhtmltopdf 0.12.6 (with patched qt)", "")
+	if !info.Patched || info.Options != nil {
+		t.Errorf("unexpected info %+v", info)
+	}
+	if unsupported := info.unsupported([]string{"--unknown", "cover", "c.html", "toc", "-"}); len(unsupported) != 0 {
+		t.Errorf("expected no unsupported options, but got %v", unsupported)
+	}
+	for _, help := range []string{"", "wkhtmltopdf: unrecognized option '--extended-help'"} {
+		info = parseWkhtmltopdfHelp("wkhtmltopdf 0.12.6", help)
+		if info.Patched || info.Options != nil {
+			t.Errorf("%q: expected unpatched without the options, but got %+v", help, info)
+		}
+	}
+}
+
+func TestExternalWkhtmltopdf(t *testing.T) {
+	tmpdir, wk := testutil.NewFakeWkhtmltopdf(t)
+	defer os.RemoveAll(tmpdir)
+
+	// the external wkhtmltopdf answers the version and the help, and outputs the args as a pdf otherwise.
+	external := filepath.Join(tmpdir, "external-wkhtmltopdf")
+	script := `#!/bin/sh
+case "$1" in
+--version) echo "wkhtmltopdf 0.12.5"; exit 0;;
+--extended-help) cat <<'EOF'
+` + unpatchedHelp + `EOF
+exit 0;;
+esac
+exec ` + wk + ` "$@"
+`
+	if err := ioutil.WriteFile(external, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(recipe string, strict bool) (string, error) {
+		buf := new(bytes.Buffer)
+
+		app := NewApp()
+		defer app.Close()
+		app.SetCachedir(tmpdir)
+		app.Logger = log.New(buf, "", 0)
+		app.Stdout = ioutil.Discard
+		app.openLibs()
+
+		if err := app.LoadRecipe(`local html2pdf = require "html2pdf"
+html2pdf.settings { wkhtmltopdf = "` + external + `" }
+` + recipe); err != nil {
+			t.Fatal(err)
+		}
+		app.Strict = strict
+
+		err := app.Run()
+		return buf.String(), err
+	}
+
+	logs, err := run(`pdf "a.pdf" { pages = { input = "a.html" }, options = { page_size = "A4" }, output_file = "-" }`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs, "==> Using wkhtmltopdf 0.12.5: "+external) {
+		t.Errorf("expected the version in the logs, but got\n%s", logs)
+	}
+
+	footer := `pdf "a.pdf" { pages = { input = "a.html", footer = { center = "[page]" } }, output_file = "-" }`
+	_, err = run(footer, true)
+	if err == nil || !strings.Contains(err.Error(), "'a.pdf': wkhtmltopdf 0.12.5 doesn't support --footer-center (needs the patched qt)") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	logs, err = run(footer, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs, "warning: wkhtmltopdf 0.12.5 doesn't support --footer-center") {
+		t.Errorf("expected the warning in the logs, but got\n%s", logs)
+	}
+
+	// the external wkhtmltopdf that doesn't have the help.
+	script = `#!/bin/sh
+case "$1" in
+--version) echo "wkhtmltopdf 0.12.7"; exit 0;;
+--extended-help) exit 1;;
+esac
+exec ` + wk + ` "$@"
+`
+	if err := ioutil.WriteFile(external, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	page := `pdf "a.pdf" { pages = { input = "a.html" }, output_file = "-" }`
+	_, err = run(page, true)
+	if err == nil || !strings.Contains(err.Error(), "the options that wkhtmltopdf 0.12.7 supports are unknown because its --extended-help can't be parsed") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	logs, err = run(page, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs, "The options that the wkhtmltopdf supports are unknown") || !strings.Contains(logs, "built without the patched qt") {
+		t.Errorf("expected the warnings in the logs, but got\n%s", logs)
+	}
+}
+
+func TestNewAppDoesNotReadEnv(t *testing.T) {
+	defer setenv(t, WkhtmltopdfEnv, "/opt/wkhtmltopdf/bin/wkhtmltopdf")()
+	defer setenv(t, CachedirEnv, "/custom/cache")()
+
+	app := NewApp()
+	defer app.Close()
+
+	if app.WkhtmltopdfCmd != "" {
+		t.Errorf("expected $%s is read only by the command, but got %s", WkhtmltopdfEnv, app.WkhtmltopdfCmd)
+	}
+	if app.Cachedir != DefaultCachedir() || app.Cachedir == "/custom/cache" {
+		t.Errorf("expected $%s is read only by the command, but got %s", CachedirEnv, app.Cachedir)
+	}
+}